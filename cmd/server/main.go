@@ -1,55 +1,242 @@
 package main
 
 import (
+    "context"
+    "database/sql"
+    "errors"
+    "flag"
+    "fmt"
     "log"
+    "net"
     "net/http"
+    "os"
+    "os/signal"
+    "path/filepath"
+    "strings"
+    "syscall"
+    "time"
 
     "github.com/valorm/snapurl/internal/api"
     "github.com/valorm/snapurl/internal/config"
     "github.com/valorm/snapurl/internal/datastore"
-    "github.com/valorm/snapurl/internal/limiter"
+    "github.com/valorm/snapurl/internal/service"
     "github.com/valorm/snapurl/internal/telemetry"
+    "github.com/valorm/snapurl/internal/tlsconfig"
 )
 
 func main() {
-    // Load config
-    cfg, err := config.LoadConfig()
+    // Load config: file, environment overlay, env vars, then flags
+    flags := config.NewFlags(flag.CommandLine)
+    flag.Parse()
+    cfg, err := flags.Load()
     if err != nil {
         log.Fatal(err)
     }
+    if err := cfg.Validate(); err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(1)
+    }
 
-    // Open (and migrate) DB
-    db, err := datastore.OpenDB(cfg.DBPath)
+    // Open DB, migrating it or checking that it is current
+    store, err := datastore.Connect(cfg.DBPath, datastore.ConfigOptions(cfg))
+    if err != nil {
+        log.Fatal(err)
+    }
+    defer store.Close()
+    if cfg.AutoMigrate {
+        err = datastore.RunMigrations(store.Write)
+    } else {
+        err = datastore.CheckSchema(store.Read)
+    }
+    if errors.Is(err, datastore.ErrSchemaBehind) {
+        log.Fatalf(`%v; run "snapurlctl migrate up" or start with -auto-migrate`, err)
+    }
     if err != nil {
         log.Fatal(err)
     }
-    defer db.Close()
+    if n, err := service.BackfillNormalizedURLs(store.Write); err != nil {
+        log.Fatal(err)
+    } else if n > 0 {
+        log.Printf("Normalized the target URLs of %d older links", n)
+    }
+    if err := checkAdminKeys(cfg, store.Read); err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(1)
+    }
 
-    // Initialize rate limiter & telemetry
-    rateLimiter := limiter.NewIPRateLimiter(cfg.RateLimit)
+    // Initialize telemetry
     telemetry.Init()
 
-    // Build router
-    mux := http.NewServeMux()
+    // Build the router, rate limiter and blocklist from the config; the
+    // blocklist file is watched for changes
+    srv, err := newServer(flags, cfg, store)
+    if err != nil {
+        log.Fatal(err)
+    }
 
-    // Public endpoints
-    mux.Handle("/shorten", api.ShortenHandler(db))
-    mux.Handle("/{shortcode}", api.RedirectHandler(db))
-    mux.Handle("/health", api.HealthHandler())
-    mux.Handle("/metrics", api.MetricsHandler(db))
+    // Reload the config on SIGHUP and when its files change
+    hup := make(chan os.Signal, 1)
+    signal.Notify(hup, syscall.SIGHUP)
+    go func() {
+        for range hup {
+            srv.reload("SIGHUP")
+        }
+    }()
+    if cfg.ConfigReloadInterval > 0 {
+        go config.WatchFiles(flags.Files(), cfg.ConfigReloadInterval, nil, func() {
+            srv.reload("file changed")
+        })
+    }
 
-    // Protected endpoint with authentication middleware
-    mux.Handle("/"+cfg.APIKeys[0], api.AuthMiddleware(cfg, api.RevokeHandler(db, cfg.APIKeys)))
+    // Scheduled online backups
+    if cfg.BackupInterval > 0 && cfg.BackupDir != "" {
+        go datastore.ScheduleBackups(context.Background(), store.Read, cfg.BackupDir, cfg.BackupInterval, cfg.BackupRetention)
+        log.Printf("Backing up to %s every %s", cfg.BackupDir, cfg.BackupInterval)
+    }
+
+    // Archive or delete long-expired and revoked links
+    if cfg.JanitorInterval > 0 {
+        go service.RunJanitor(context.Background(), store.Write, cfg.JanitorInterval, api.JanitorOptions(cfg))
+    }
 
-    // Apply middleware: recovery → logging → rate limiting
-    handler := rateLimiter.Middleware(
+    // Apply middleware: recovery → logging → rate limiting, plus HSTS
+    // when serving HTTPS
+    handler := srv.limiter.Middleware(
         api.RecoveryMiddleware(
-            api.LoggingMiddleware(mux),
+            api.LoggingMiddleware(&srv.public),
         ),
     )
+    httpServer := &http.Server{Addr: cfg.Port, Handler: handler}
+    servers := []*http.Server{httpServer}
+    errc := make(chan error, 3) // one per listener
 
-    log.Printf("Starting server on %s", cfg.Port)
-    if err := http.ListenAndServe(cfg.Port, handler); err != nil {
-        log.Fatal(err)
+    // Health, metrics, pprof and the management API on their own listener,
+    // without rate limiting
+    if cfg.AdminAddr != "" {
+        ln, err := listenAdmin(cfg.AdminAddr)
+        if err != nil {
+            log.Fatal(err)
+        }
+        adminServer := &http.Server{Handler: api.RecoveryMiddleware(api.LoggingMiddleware(&srv.admin))}
+        servers = append(servers, adminServer)
+        log.Printf("Serving admin endpoints on %s", cfg.AdminAddr)
+        go func() {
+            errc <- fmt.Errorf("admin listener: %w", adminServer.Serve(ln))
+        }()
+    }
+
+    if cfg.TLSCertFile == "" {
+        log.Printf("Starting server on %s", cfg.Port)
+        go func() {
+            errc <- httpServer.ListenAndServe()
+        }()
+    } else {
+        // HTTPS, reloading the certificate when its files are replaced
+        cert, err := tlsconfig.LoadCertificate(cfg.TLSCertFile, cfg.TLSKeyFile)
+        if err != nil {
+            log.Fatal(err)
+        }
+        if cfg.TLSReloadInterval > 0 {
+            go cert.Watch(cfg.TLSReloadInterval, nil)
+        }
+        httpServer.TLSConfig, err = tlsconfig.New(cfg.TLSMinVersion, cfg.TLSCipherSuites, cert)
+        if err != nil {
+            log.Fatal(err)
+        }
+        httpServer.Handler = api.HSTSMiddleware(cfg, handler)
+
+        if cfg.HTTPRedirectAddr != "" {
+            redirectServer := &http.Server{Addr: cfg.HTTPRedirectAddr, Handler: api.HTTPSRedirectHandler(cfg.Port)}
+            servers = append(servers, redirectServer)
+            log.Printf("Redirecting HTTP on %s to HTTPS", cfg.HTTPRedirectAddr)
+            go func() {
+                errc <- fmt.Errorf("HTTP redirect listener: %w", redirectServer.ListenAndServe())
+            }()
+        }
+
+        log.Printf("Starting server on %s (TLS)", cfg.Port)
+        go func() {
+            errc <- httpServer.ListenAndServeTLS("", "")
+        }()
+    }
+
+    // Serve until a listener fails or SIGINT/SIGTERM arrives, then let
+    // running requests finish and remove the admin socket
+    stop := make(chan os.Signal, 1)
+    signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+    var failed error
+    select {
+    case failed = <-errc:
+    case sig := <-stop:
+        log.Printf("Received %s, shutting down", sig)
+    }
+    shutdown(servers, cfg.AdminAddr, srv.hits)
+    if failed != nil {
+        store.Close()
+        log.Fatal(failed)
+    }
+}
+
+// shutdownTimeout bounds how long shutdown waits for running requests.
+const shutdownTimeout = 10 * time.Second
+
+// shutdown stops the servers, writes the hits of the requests they served
+// and removes the admin socket, if any.
+func shutdown(servers []*http.Server, adminAddr string, hits *service.HitCounter) {
+    ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+    defer cancel()
+    for _, s := range servers {
+        if err := s.Shutdown(ctx); err != nil {
+            log.Printf("shutdown: %v", err)
+        }
+    }
+    if err := hits.Flush(); err != nil {
+        log.Printf("shutdown: %v", err)
+    }
+    if path, ok := strings.CutPrefix(adminAddr, config.AdminSocketPrefix); ok {
+        if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+            log.Printf("remove admin socket: %v", err)
+        }
+    }
+}
+
+// checkAdminKeys makes sure the server can be managed: without api_keys,
+// the database must hold an active admin key.
+func checkAdminKeys(cfg *config.Config, db *sql.DB) error {
+    if len(cfg.APIKeys) > 0 {
+        return nil
+    }
+    ok, err := service.HasAdminKey(db)
+    if err != nil {
+        return err
+    }
+    if !ok {
+        return errors.New(`no admin key: set api_keys, or create one with "snapurlctl keys create -scope admin <name>"`)
+    }
+    return nil
+}
+
+// listenAdmin listens on a TCP address or, with the "unix:" prefix, on a
+// Unix socket that only the server's user and group can connect to. A
+// socket file left behind by a previous run is replaced.
+func listenAdmin(addr string) (net.Listener, error) {
+    path, ok := strings.CutPrefix(addr, config.AdminSocketPrefix)
+    if !ok {
+        return net.Listen("tcp", addr)
+    }
+    if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+        return nil, err
+    }
+    if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+        return nil, err
+    }
+    ln, err := net.Listen("unix", path)
+    if err != nil {
+        return nil, err
+    }
+    if err := os.Chmod(path, 0o660); err != nil {
+        ln.Close()
+        return nil, err
     }
-}
\ No newline at end of file
+    return ln, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+    "net/http"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/valorm/snapurl/internal/config"
+    "github.com/valorm/snapurl/internal/datastore"
+    "github.com/valorm/snapurl/internal/models"
+    "github.com/valorm/snapurl/internal/service"
+)
+
+func TestShutdown(t *testing.T) {
+    dir := t.TempDir()
+    store, err := datastore.Connect(filepath.Join(dir, "snapurl.db"), datastore.DefaultOptions())
+    if err != nil {
+        t.Fatalf("Connect: %v", err)
+    }
+    defer store.Close()
+    if err := datastore.RunMigrations(store.Write); err != nil {
+        t.Fatalf("migrations: %v", err)
+    }
+    link, _, err := service.CreateLink(store.Write, "https://example.com", service.CreateLinkOptions{})
+    if err != nil {
+        t.Fatalf("CreateLink: %v", err)
+    }
+
+    // Pending hits are written and the admin socket is removed
+    hits := service.NewHitCounter(store.Write, time.Hour)
+    hits.Add(models.DefaultWorkspaceID, link.Shortcode)
+    hits.Add(models.DefaultWorkspaceID, link.Shortcode)
+    addr := config.AdminSocketPrefix + filepath.Join(dir, "admin.sock")
+    ln, err := listenAdmin(addr)
+    if err != nil {
+        t.Fatalf("listenAdmin: %v", err)
+    }
+    admin := &http.Server{}
+    go admin.Serve(ln)
+
+    shutdown([]*http.Server{admin}, addr, hits)
+
+    got, err := service.GetLink(store.Read, models.DefaultWorkspaceID, link.Shortcode, "")
+    if err != nil || got.Hits != 2 {
+        t.Errorf("hits after shutdown: want 2, got %d (%v)", got.Hits, err)
+    }
+    if _, err := os.Stat(filepath.Join(dir, "admin.sock")); !os.IsNotExist(err) {
+        t.Errorf("admin socket left behind: %v", err)
+    }
+}
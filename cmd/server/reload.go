@@ -0,0 +1,159 @@
+package main
+
+import (
+    "log"
+    "net/http"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "github.com/valorm/snapurl/internal/api"
+    "github.com/valorm/snapurl/internal/blocklist"
+    "github.com/valorm/snapurl/internal/config"
+    "github.com/valorm/snapurl/internal/datastore"
+    "github.com/valorm/snapurl/internal/limiter"
+    "github.com/valorm/snapurl/internal/logging"
+    "github.com/valorm/snapurl/internal/service"
+)
+
+// server serves the routers built from the current configuration: public,
+// and admin when admin_addr is set. A reload builds new routers and swaps
+// them in, so each request sees either the old or the new configuration,
+// never a mix.
+type server struct {
+    flags   *config.Flags
+    store   *datastore.DB
+    limiter *limiter.IPRateLimiter
+    hits    *service.HitCounter // shared by the routers of every reload
+    public  router
+    admin   router
+
+    mu     sync.Mutex // serializes reloads
+    cfg    *config.Config
+    bl     *blocklist.List
+    stopBL chan struct{}
+}
+
+// hitFlushDelay is how long redirect hits are collected before they are
+// written in one transaction.
+const hitFlushDelay = time.Second
+
+func newServer(flags *config.Flags, cfg *config.Config, store *datastore.DB) (*server, error) {
+    if err := logging.SetLevel(cfg.LogLevel); err != nil {
+        return nil, err
+    }
+    s := &server{
+        flags:   flags,
+        store:   store,
+        limiter: limiter.NewIPRateLimiter(cfg.RateLimit),
+        hits:    service.NewHitCounter(store.Write, hitFlushDelay),
+        cfg:     cfg,
+    }
+    bl, stop, err := startBlocklist(cfg)
+    if err != nil {
+        return nil, err
+    }
+    s.bl, s.stopBL = bl, stop
+    s.setRouters(cfg, bl)
+    return s, nil
+}
+
+// router serves the ServeMux most recently stored in it.
+type router struct {
+    mux atomic.Pointer[http.ServeMux]
+}
+
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    rt.mux.Load().ServeHTTP(w, r)
+}
+
+// setRouters builds the routers for cfg. With admin_addr unset, the
+// public listener serves every endpoint.
+func (s *server) setRouters(cfg *config.Config, bl *blocklist.List) {
+    if cfg.AdminAddr == "" {
+        s.public.mux.Store(api.NewRouter(cfg, s.store, bl, s.hits))
+        return
+    }
+    s.public.mux.Store(api.NewPublicRouter(cfg, s.store, bl, s.hits))
+    s.admin.mux.Store(api.NewAdminRouter(cfg, s.store, bl))
+}
+
+// startBlocklist loads the blocklist of cfg, if any, and watches its file
+// until the returned channel is closed.
+func startBlocklist(cfg *config.Config) (*blocklist.List, chan struct{}, error) {
+    if cfg.BlocklistPath == "" {
+        return nil, nil, nil
+    }
+    bl, err := blocklist.Load(cfg.BlocklistPath)
+    if err != nil {
+        return nil, nil, err
+    }
+    interval := cfg.BlocklistReloadInterval
+    if interval <= 0 {
+        interval = 30 * time.Second
+    }
+    stop := make(chan struct{})
+    go bl.Watch(interval, stop)
+    log.Printf("Loaded %d blocklist rules from %s", bl.Len(), cfg.BlocklistPath)
+    return bl, stop, nil
+}
+
+// reload reads the configuration again and applies it. A configuration
+// that is invalid or changes restart-only options is rejected as a whole,
+// leaving the running one in place.
+func (s *server) reload(reason string) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    cfg, err := s.flags.Load()
+    if err == nil {
+        err = cfg.Validate()
+    }
+    if err == nil {
+        err = checkAdminKeys(cfg, s.store.Read)
+    }
+    if err == nil {
+        err = config.CheckReload(s.cfg, cfg)
+    }
+    if err != nil {
+        log.Printf("Config reload (%s) rejected: %v", reason, err)
+        return
+    }
+
+    // Reread the blocklist, or switch to another file
+    bl, stop := s.bl, s.stopBL
+    if cfg.BlocklistPath != s.cfg.BlocklistPath {
+        if bl, stop, err = startBlocklist(cfg); err != nil {
+            log.Printf("Config reload (%s) rejected: %v", reason, err)
+            return
+        }
+        if s.stopBL != nil {
+            close(s.stopBL)
+        }
+    } else if bl != nil {
+        if reloaded, err := bl.Reload(); err != nil {
+            log.Printf("blocklist: %v", err)
+        } else if reloaded {
+            log.Printf("blocklist: reloaded %d rules from %s", bl.Len(), cfg.BlocklistPath)
+        }
+    }
+
+    changes := config.Diff(s.cfg, cfg)
+    logging.SetLevel(cfg.LogLevel)
+    if cfg.RateLimit != s.cfg.RateLimit {
+        s.limiter.SetRate(cfg.RateLimit)
+    }
+    s.setRouters(cfg, bl)
+    s.cfg, s.bl, s.stopBL = cfg, bl, stop
+
+    if len(changes) == 0 {
+        log.Printf("Config reloaded (%s): no changes", reason)
+        return
+    }
+    lines := make([]string, len(changes))
+    for i, c := range changes {
+        lines[i] = c.String()
+    }
+    log.Printf("Config reloaded (%s):\n  %s", reason, strings.Join(lines, "\n  "))
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+    "context"
+    "flag"
+    "fmt"
+    "os"
+
+    "github.com/valorm/snapurl/internal/datastore"
+)
+
+func runBackup(args []string) error {
+    fs := flag.NewFlagSet("backup", flag.ExitOnError)
+    dbPath := fs.String("db", defaultDBPath(), "database to back up")
+    out := fs.String("out", "", `backup file, or "-" for stdout`)
+    fs.Parse(args)
+    if *out == "" {
+        return fmt.Errorf("backup: -out is required")
+    }
+
+    db, err := openExisting(*dbPath)
+    if err != nil {
+        return err
+    }
+    defer db.Close()
+
+    ctx := context.Background()
+    if *out == "-" {
+        return datastore.BackupTo(ctx, db, os.Stdout)
+    }
+    if err := datastore.Backup(ctx, db, *out); err != nil {
+        return err
+    }
+    fmt.Fprintf(os.Stderr, "backup written to %s\n", *out)
+    return nil
+}
+
+func runRestore(args []string) error {
+    fs := flag.NewFlagSet("restore", flag.ExitOnError)
+    dbPath := fs.String("db", defaultDBPath(), "database to replace")
+    from := fs.String("from", "", "backup file to restore")
+    fs.Parse(args)
+    if *from == "" || *dbPath == "" {
+        return fmt.Errorf("restore: -from and -db are required")
+    }
+
+    previous, err := datastore.Restore(*from, *dbPath)
+    if err != nil {
+        return err
+    }
+    fmt.Fprintf(os.Stderr, "restored %s from %s\n", *dbPath, *from)
+    if previous != "" {
+        fmt.Fprintf(os.Stderr, "previous database kept as %s\n", previous)
+    }
+    return nil
+}
+
+func runVerify(args []string) error {
+    fs := flag.NewFlagSet("verify", flag.ExitOnError)
+    dbPath := fs.String("db", defaultDBPath(), "database or backup file to check")
+    fs.Parse(args)
+
+    if err := datastore.Verify(*dbPath); err != nil {
+        return err
+    }
+    fmt.Fprintf(os.Stderr, "%s: ok\n", *dbPath)
+    return nil
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "net"
+    "net/http"
+    "net/url"
+    "os"
+    "strings"
+
+    "github.com/valorm/snapurl/internal/api"
+    "github.com/valorm/snapurl/internal/blocklist"
+    "github.com/valorm/snapurl/internal/config"
+    "github.com/valorm/snapurl/internal/datastore"
+)
+
+// target selects where commands run: against a server's HTTP API when
+// -server is set, else directly against the database file.
+type target struct {
+    dbPath string
+    server string
+    key    string
+}
+
+func targetFlags(fs *flag.FlagSet) *target {
+    t := &target{}
+    fs.StringVar(&t.dbPath, "db", defaultDBPath(), "database file (local mode)")
+    fs.StringVar(&t.server, "server", os.Getenv("SNAPURL_SERVER"), "server base URL, e.g. https://sn.ap, or unix:/path/to/admin.sock (remote mode)")
+    fs.StringVar(&t.key, "key", os.Getenv("SNAPURL_API_KEY"), "API key (remote mode)")
+    return t
+}
+
+// apiClient calls the snapurl HTTP API, either over the network or
+// in-process through the server's own router.
+type apiClient struct {
+    base  string
+    key   string
+    http  *http.Client
+    store *datastore.DB // set in local mode
+}
+
+// client connects to the chosen target. In local mode the server's router
+// runs in-process with a throwaway admin key, so both modes share the same
+// validation, scoping and output; like the server, it refuses a database
+// with pending migrations.
+func (t *target) client() (*apiClient, error) {
+    if t.server != "" {
+        if t.key == "" {
+            return nil, fmt.Errorf("remote mode needs an API key; use -key or SNAPURL_API_KEY")
+        }
+        if path, ok := strings.CutPrefix(t.server, config.AdminSocketPrefix); ok {
+            return &apiClient{base: "http://localhost", key: t.key, http: unixClient(path)}, nil
+        }
+        return &apiClient{base: strings.TrimSuffix(t.server, "/"), key: t.key, http: http.DefaultClient}, nil
+    }
+
+    if t.dbPath == "" {
+        return nil, fmt.Errorf("no database path; use -db")
+    }
+    if _, err := os.Stat(t.dbPath); err != nil {
+        return nil, err
+    }
+    cfg, err := config.LoadConfig()
+    if err != nil {
+        cfg = &config.Config{}
+    }
+    store, err := datastore.Connect(t.dbPath, datastore.ConfigOptions(cfg))
+    if err != nil {
+        return nil, err
+    }
+    if err := datastore.CheckSchema(store.Read); err != nil {
+        store.Close()
+        if errors.Is(err, datastore.ErrSchemaBehind) {
+            return nil, fmt.Errorf(`%w; run "snapurlctl migrate up"`, err)
+        }
+        return nil, err
+    }
+    var bl *blocklist.List
+    if cfg.BlocklistPath != "" {
+        if bl, err = blocklist.Load(cfg.BlocklistPath); err != nil {
+            store.Close()
+            return nil, err
+        }
+    }
+
+    secret := make([]byte, 16)
+    if _, err := rand.Read(secret); err != nil {
+        store.Close()
+        return nil, err
+    }
+    key := "local-" + hex.EncodeToString(secret)
+    cfg.APIKeys = []string{key}
+
+    router := api.NewRouter(cfg, store, bl, nil)
+    return &apiClient{
+        base:  "http://localhost",
+        key:   key,
+        http:  &http.Client{Transport: handlerTransport{router}},
+        store: store,
+    }, nil
+}
+
+func (c *apiClient) Close() error {
+    if c.store != nil {
+        return c.store.Close()
+    }
+    return nil
+}
+
+// unixClient sends every request to the server's admin socket at path.
+func unixClient(path string) *http.Client {
+    var d net.Dialer
+    return &http.Client{Transport: &http.Transport{
+        DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+            return d.DialContext(ctx, "unix", path)
+        },
+    }}
+}
+
+// handlerTransport serves requests with an http.Handler instead of the
+// network. The handler runs in its own goroutine and its output is piped
+// into the response body, so large responses are not held in memory.
+type handlerTransport struct {
+    h http.Handler
+}
+
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+    pr, pw := io.Pipe()
+    w := &pipeResponseWriter{header: http.Header{}, pw: pw, ready: make(chan struct{})}
+    go func() {
+        defer pw.Close()
+        defer w.WriteHeader(http.StatusOK) // handlers that never write
+        t.h.ServeHTTP(w, req)
+    }()
+    <-w.ready
+    return &http.Response{
+        Status:     fmt.Sprintf("%d %s", w.status, http.StatusText(w.status)),
+        StatusCode: w.status,
+        Proto:      "HTTP/1.1",
+        ProtoMajor: 1,
+        ProtoMinor: 1,
+        Header:     w.sent,
+        Body:       pr,
+        Request:    req,
+    }, nil
+}
+
+// pipeResponseWriter is the http.ResponseWriter of handlerTransport.
+type pipeResponseWriter struct {
+    header http.Header
+    sent   http.Header // header as of WriteHeader
+    status int
+    pw     *io.PipeWriter
+    ready  chan struct{} // closed by the first WriteHeader
+}
+
+func (w *pipeResponseWriter) Header() http.Header { return w.header }
+
+func (w *pipeResponseWriter) WriteHeader(status int) {
+    if w.status != 0 {
+        return
+    }
+    w.status, w.sent = status, w.header.Clone()
+    close(w.ready)
+}
+
+func (w *pipeResponseWriter) Write(p []byte) (int, error) {
+    w.WriteHeader(http.StatusOK)
+    return w.pw.Write(p)
+}
+
+// send sends a request and returns the response for the caller to read
+// and close. Responses other than 2xx are turned into errors carrying the
+// server's message.
+func (c *apiClient) send(method, path string, query url.Values, contentType string, body io.Reader) (*http.Response, error) {
+    u := c.base + path
+    if len(query) > 0 {
+        u += "?" + query.Encode()
+    }
+    req, err := http.NewRequest(method, u, body)
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("X-API-Key", c.key)
+    if contentType != "" {
+        req.Header.Set("Content-Type", contentType)
+    }
+
+    resp, err := c.http.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    if resp.StatusCode < 200 || resp.StatusCode > 299 {
+        defer resp.Body.Close()
+        data, _ := io.ReadAll(resp.Body)
+        return nil, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(data)))
+    }
+    return resp, nil
+}
+
+// do sends a request and returns the response body, see send.
+func (c *apiClient) do(method, path string, query url.Values, contentType string, body io.Reader) ([]byte, error) {
+    resp, err := c.send(method, path, query, contentType, body)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    return io.ReadAll(resp.Body)
+}
+
+// doJSON sends v (if not nil) as a JSON body.
+func (c *apiClient) doJSON(method, path string, query url.Values, v any) ([]byte, error) {
+    if v == nil {
+        return c.do(method, path, query, "", nil)
+    }
+    body, err := json.Marshal(v)
+    if err != nil {
+        return nil, err
+    }
+    return c.do(method, path, query, "application/json", bytes.NewReader(body))
+}
+
+// printJSON pretty-prints a JSON response on stdout.
+func printJSON(data []byte) error {
+    var out bytes.Buffer
+    if err := json.Indent(&out, data, "", "  "); err != nil {
+        _, err = os.Stdout.Write(data)
+        return err
+    }
+    out.WriteByte('\n')
+    _, err := out.WriteTo(os.Stdout)
+    return err
+}
+
+// parseArgs parses flags around a single positional argument, which may
+// come before or after the flags.
+func parseArgs(fs *flag.FlagSet, args []string, argName string) (string, error) {
+    var arg string
+    if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+        arg, args = args[0], args[1:]
+    }
+    fs.Parse(args)
+    if arg == "" && fs.NArg() > 0 {
+        arg = fs.Arg(0)
+    }
+    if arg == "" {
+        return "", fmt.Errorf("%s: %s is required", fs.Name(), argName)
+    }
+    return arg, nil
+}
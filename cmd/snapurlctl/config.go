@@ -0,0 +1,59 @@
+package main
+
+import (
+    "encoding/json"
+    "flag"
+    "fmt"
+    "os"
+
+    "github.com/valorm/snapurl/internal/config"
+)
+
+const configUsage = `usage: snapurlctl config <command> [flags]
+
+commands:
+  print     show the effective server configuration and where each value
+            comes from, with secrets redacted
+`
+
+func runConfig(args []string) error {
+    if len(args) == 0 {
+        fmt.Fprint(os.Stderr, configUsage)
+        os.Exit(2)
+    }
+    switch cmd, args := args[0], args[1:]; cmd {
+    case "print":
+        return runConfigPrint(args)
+    default:
+        return fmt.Errorf("unknown config command %q", cmd)
+    }
+}
+
+// runConfigPrint loads the configuration the way the server does, taking
+// the same -config, -env and option flags, and prints the result.
+func runConfigPrint(args []string) error {
+    fs := flag.NewFlagSet("config print", flag.ExitOnError)
+    flags := config.NewFlags(fs)
+    asJSON := fs.Bool("json", false, "print the settings as JSON")
+    fs.Parse(args)
+
+    cfg, err := flags.Load()
+    if err != nil {
+        return err
+    }
+    settings := flags.Settings()
+    if *asJSON {
+        enc := json.NewEncoder(os.Stdout)
+        enc.SetIndent("", "  ")
+        if err := enc.Encode(settings); err != nil {
+            return err
+        }
+    } else if err := config.WriteSettings(os.Stdout, settings); err != nil {
+        return err
+    }
+
+    if err := cfg.Validate(); err != nil {
+        fmt.Fprintln(os.Stderr, err)
+    }
+    return nil
+}
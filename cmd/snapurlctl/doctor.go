@@ -0,0 +1,92 @@
+package main
+
+import (
+    "encoding/json"
+    "flag"
+    "fmt"
+    "net/url"
+    "os"
+
+    "github.com/valorm/snapurl/internal/datastore"
+)
+
+// runDoctor checks the database through the admin endpoint, locally or on
+// a server, and fails when any check failed.
+func runDoctor(args []string) error {
+    fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+    t := targetFlags(fs)
+    vacuum := fs.Bool("vacuum", false, "run VACUUM if all checks pass")
+    analyze := fs.Bool("analyze", false, "run ANALYZE if all checks pass")
+    asJSON := fs.Bool("json", false, "print the report as JSON")
+    fs.Parse(args)
+
+    c, err := t.client()
+    if err != nil {
+        return err
+    }
+    defer c.Close()
+
+    method, q := "GET", url.Values{}
+    if *vacuum || *analyze {
+        method = "POST"
+        q.Set("vacuum", fmt.Sprint(*vacuum))
+        q.Set("analyze", fmt.Sprint(*analyze))
+    }
+    data, err := c.do(method, "/api/v1/admin/doctor", q, "", nil)
+    if err != nil {
+        return err
+    }
+    var report datastore.DoctorReport
+    if err := json.Unmarshal(data, &report); err != nil {
+        return err
+    }
+
+    if *asJSON {
+        if err := printJSON(data); err != nil {
+            return err
+        }
+    } else {
+        printReport(report)
+    }
+    if !report.OK {
+        return fmt.Errorf("database has problems")
+    }
+    return nil
+}
+
+func printReport(r datastore.DoctorReport) {
+    if r.Path != "" {
+        fmt.Printf("database %s\n", r.Path)
+    }
+    for _, c := range r.Checks {
+        fmt.Printf("  %-4s  %s\n", c.Status, c.Name)
+        for _, p := range c.Problems {
+            fmt.Printf("          %s\n", p)
+        }
+    }
+    printSizes("sizes", r.Sizes)
+    for _, m := range r.Maintenance {
+        fmt.Printf("ran %s\n", m)
+    }
+    if r.SizesAfter != nil {
+        printSizes("sizes after", *r.SizesAfter)
+    }
+}
+
+func printSizes(label string, s datastore.FileSizes) {
+    fmt.Fprintf(os.Stdout, "%s: db %s, wal %s, shm %s, reclaimable %s\n",
+        label, humanBytes(s.DB), humanBytes(s.WAL), humanBytes(s.SHM), humanBytes(s.Reclaimable))
+}
+
+func humanBytes(n int64) string {
+    const unit = 1024
+    if n < unit {
+        return fmt.Sprintf("%d B", n)
+    }
+    div, exp := int64(unit), 0
+    for m := n / unit; m >= unit; m /= unit {
+        div *= unit
+        exp++
+    }
+    return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
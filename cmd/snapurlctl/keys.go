@@ -0,0 +1,124 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "net/url"
+    "os"
+)
+
+const keysUsage = `usage: snapurlctl keys <command> [flags]
+
+commands:
+  create    create an API key and print its secret
+  list      list API keys
+  revoke    revoke an API key
+  rotate    replace an API key, keeping the old one valid for an overlap
+`
+
+func runKeys(args []string) error {
+    if len(args) == 0 {
+        fmt.Fprint(os.Stderr, keysUsage)
+        os.Exit(2)
+    }
+    switch cmd, args := args[0], args[1:]; cmd {
+    case "create":
+        return runKeyCreate(args)
+    case "list":
+        return runKeyList(args)
+    case "revoke":
+        return runKeyRevoke(args)
+    case "rotate":
+        return runKeyRotate(args)
+    default:
+        return fmt.Errorf("unknown keys command %q", cmd)
+    }
+}
+
+func runKeyCreate(args []string) error {
+    fs := flag.NewFlagSet("keys create", flag.ExitOnError)
+    t := targetFlags(fs)
+    owner := fs.String("owner", "", "owner of the links created with the key (default: the name)")
+    scope := fs.String("scope", "user", "user or admin")
+    workspace := fs.Int("workspace", 0, "bind the key to this workspace")
+    name, err := parseArgs(fs, args, "name")
+    if err != nil {
+        return err
+    }
+
+    c, err := t.client()
+    if err != nil {
+        return err
+    }
+    defer c.Close()
+    req := map[string]any{"name": name, "owner_id": *owner, "scope": *scope, "workspace_id": *workspace}
+    data, err := c.doJSON("POST", "/api/v1/keys", nil, req)
+    if err != nil {
+        return err
+    }
+    fmt.Fprintln(os.Stderr, "store the secret now; it cannot be shown again")
+    return printJSON(data)
+}
+
+func runKeyList(args []string) error {
+    fs := flag.NewFlagSet("keys list", flag.ExitOnError)
+    t := targetFlags(fs)
+    fs.Parse(args)
+
+    c, err := t.client()
+    if err != nil {
+        return err
+    }
+    defer c.Close()
+    data, err := c.doJSON("GET", "/api/v1/keys", nil, nil)
+    if err != nil {
+        return err
+    }
+    return printJSON(data)
+}
+
+func runKeyRevoke(args []string) error {
+    fs := flag.NewFlagSet("keys revoke", flag.ExitOnError)
+    t := targetFlags(fs)
+    id, err := parseArgs(fs, args, "key id")
+    if err != nil {
+        return err
+    }
+
+    c, err := t.client()
+    if err != nil {
+        return err
+    }
+    defer c.Close()
+    if _, err := c.doJSON("DELETE", "/api/v1/keys/"+url.PathEscape(id), nil, nil); err != nil {
+        return err
+    }
+    fmt.Fprintf(os.Stderr, "revoked key %s\n", id)
+    return nil
+}
+
+func runKeyRotate(args []string) error {
+    fs := flag.NewFlagSet("keys rotate", flag.ExitOnError)
+    t := targetFlags(fs)
+    overlap := fs.String("overlap", "", "how long the old key keeps working, e.g. 1h (default: server setting)")
+    id, err := parseArgs(fs, args, "key id")
+    if err != nil {
+        return err
+    }
+
+    c, err := t.client()
+    if err != nil {
+        return err
+    }
+    defer c.Close()
+    var req any
+    if *overlap != "" {
+        req = map[string]string{"overlap": *overlap}
+    }
+    data, err := c.doJSON("POST", "/api/v1/keys/"+url.PathEscape(id)+"/rotate", nil, req)
+    if err != nil {
+        return err
+    }
+    fmt.Fprintln(os.Stderr, "store the secret now; it cannot be shown again")
+    return printJSON(data)
+}
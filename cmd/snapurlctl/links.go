@@ -0,0 +1,257 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "net/url"
+    "os"
+    "strconv"
+    "time"
+)
+
+const linksUsage = `usage: snapurlctl links <command> [flags]
+
+commands:
+  create    shorten a URL
+  get       show a link
+  list      list links
+  update    change the target or expiry of a link
+  revoke    revoke a link
+  unrevoke  restore a revoked link
+  delete    remove a link and free its shortcode (admin)
+`
+
+func runLinks(args []string) error {
+    if len(args) == 0 {
+        fmt.Fprint(os.Stderr, linksUsage)
+        os.Exit(2)
+    }
+    switch cmd, args := args[0], args[1:]; cmd {
+    case "create":
+        return runLinkCreate(args)
+    case "get":
+        return runLinkGet(args)
+    case "list":
+        return runLinkList(args)
+    case "update":
+        return runLinkUpdate(args)
+    case "revoke":
+        return runLinkRevoke(args)
+    case "unrevoke":
+        return runLinkUnrevoke(args)
+    case "delete":
+        return runLinkDelete(args)
+    default:
+        return fmt.Errorf("unknown links command %q", cmd)
+    }
+}
+
+// workspaceQuery returns ?workspace= for a non-zero workspace id.
+func workspaceQuery(id int) url.Values {
+    if id == 0 {
+        return nil
+    }
+    return url.Values{"workspace": {strconv.Itoa(id)}}
+}
+
+// parseExpiry accepts an RFC 3339 time or a duration from now.
+func parseExpiry(v string) (time.Time, error) {
+    if d, err := time.ParseDuration(v); err == nil {
+        return time.Now().Add(d).UTC(), nil
+    }
+    t, err := time.Parse(time.RFC3339, v)
+    if err != nil {
+        return time.Time{}, fmt.Errorf("invalid expiry %q: want RFC 3339 or a duration", v)
+    }
+    return t, nil
+}
+
+func runLinkCreate(args []string) error {
+    fs := flag.NewFlagSet("links create", flag.ExitOnError)
+    t := targetFlags(fs)
+    expiry := fs.String("expiry", "", "expiry time (RFC 3339) or duration from now, e.g. 720h")
+    domain := fs.String("domain", "", "branded domain of the workspace to create the link in")
+    reuse := fs.Bool("reuse", false, "return an existing link to the same target if there is one")
+    target, err := parseArgs(fs, args, "URL")
+    if err != nil {
+        return err
+    }
+
+    req := map[string]any{"url": target, "domain": *domain, "reuse_existing": *reuse}
+    if *expiry != "" {
+        exp, err := parseExpiry(*expiry)
+        if err != nil {
+            return err
+        }
+        req["expiry"] = exp
+    }
+
+    c, err := t.client()
+    if err != nil {
+        return err
+    }
+    defer c.Close()
+    data, err := c.doJSON("POST", "/shorten", nil, req)
+    if err != nil {
+        return err
+    }
+    return printJSON(data)
+}
+
+func runLinkGet(args []string) error {
+    fs := flag.NewFlagSet("links get", flag.ExitOnError)
+    t := targetFlags(fs)
+    workspace := fs.Int("workspace", 0, "workspace id")
+    code, err := parseArgs(fs, args, "shortcode")
+    if err != nil {
+        return err
+    }
+
+    c, err := t.client()
+    if err != nil {
+        return err
+    }
+    defer c.Close()
+    data, err := c.doJSON("GET", "/api/v1/links/"+url.PathEscape(code), workspaceQuery(*workspace), nil)
+    if err != nil {
+        return err
+    }
+    return printJSON(data)
+}
+
+func runLinkList(args []string) error {
+    fs := flag.NewFlagSet("links list", flag.ExitOnError)
+    t := targetFlags(fs)
+    workspace := fs.Int("workspace", 0, "only links of this workspace")
+    owner := fs.String("owner", "", "only links of this owner (admin keys)")
+    limit := fs.Int("limit", 100, "maximum number of links")
+    offset := fs.Int("offset", 0, "number of links to skip")
+    fs.Parse(args)
+
+    q := url.Values{"limit": {strconv.Itoa(*limit)}, "offset": {strconv.Itoa(*offset)}}
+    if *workspace != 0 {
+        q.Set("workspace", strconv.Itoa(*workspace))
+    }
+    if *owner != "" {
+        q.Set("owner", *owner)
+    }
+
+    c, err := t.client()
+    if err != nil {
+        return err
+    }
+    defer c.Close()
+    data, err := c.doJSON("GET", "/api/v1/links", q, nil)
+    if err != nil {
+        return err
+    }
+    return printJSON(data)
+}
+
+func runLinkUpdate(args []string) error {
+    fs := flag.NewFlagSet("links update", flag.ExitOnError)
+    t := targetFlags(fs)
+    workspace := fs.Int("workspace", 0, "workspace id")
+    target := fs.String("url", "", "new target URL")
+    expiry := fs.String("expiry", "", "new expiry time (RFC 3339) or duration from now")
+    clearExpiry := fs.Bool("clear-expiry", false, "remove the expiry")
+    code, err := parseArgs(fs, args, "shortcode")
+    if err != nil {
+        return err
+    }
+
+    req := map[string]any{}
+    if *target != "" {
+        req["url"] = *target
+    }
+    if *expiry != "" {
+        exp, err := parseExpiry(*expiry)
+        if err != nil {
+            return err
+        }
+        req["expiry"] = exp
+    }
+    if *clearExpiry {
+        req["clear_expiry"] = true
+    }
+    if len(req) == 0 {
+        return fmt.Errorf("links update: nothing to change; use -url, -expiry or -clear-expiry")
+    }
+
+    c, err := t.client()
+    if err != nil {
+        return err
+    }
+    defer c.Close()
+    data, err := c.doJSON("PATCH", "/api/v1/links/"+url.PathEscape(code), workspaceQuery(*workspace), req)
+    if err != nil {
+        return err
+    }
+    return printJSON(data)
+}
+
+func runLinkRevoke(args []string) error {
+    fs := flag.NewFlagSet("links revoke", flag.ExitOnError)
+    t := targetFlags(fs)
+    workspace := fs.Int("workspace", 0, "workspace id")
+    reason := fs.String("reason", "", "why the link is revoked")
+    public := fs.Bool("public", false, "show the reason to visitors of the link")
+    code, err := parseArgs(fs, args, "shortcode")
+    if err != nil {
+        return err
+    }
+
+    c, err := t.client()
+    if err != nil {
+        return err
+    }
+    defer c.Close()
+    req := map[string]any{"reason": *reason, "public": *public}
+    if _, err := c.doJSON("DELETE", "/api/v1/links/"+url.PathEscape(code), workspaceQuery(*workspace), req); err != nil {
+        return err
+    }
+    fmt.Fprintf(os.Stderr, "revoked %s\n", code)
+    return nil
+}
+
+func runLinkUnrevoke(args []string) error {
+    fs := flag.NewFlagSet("links unrevoke", flag.ExitOnError)
+    t := targetFlags(fs)
+    workspace := fs.Int("workspace", 0, "workspace id")
+    code, err := parseArgs(fs, args, "shortcode")
+    if err != nil {
+        return err
+    }
+
+    c, err := t.client()
+    if err != nil {
+        return err
+    }
+    defer c.Close()
+    data, err := c.doJSON("POST", "/api/v1/links/"+url.PathEscape(code)+"/unrevoke", workspaceQuery(*workspace), nil)
+    if err != nil {
+        return err
+    }
+    return printJSON(data)
+}
+
+func runLinkDelete(args []string) error {
+    fs := flag.NewFlagSet("links delete", flag.ExitOnError)
+    t := targetFlags(fs)
+    workspace := fs.Int("workspace", 0, "workspace id")
+    code, err := parseArgs(fs, args, "shortcode")
+    if err != nil {
+        return err
+    }
+
+    c, err := t.client()
+    if err != nil {
+        return err
+    }
+    defer c.Close()
+    if _, err := c.doJSON("DELETE", "/api/v1/admin/links/"+url.PathEscape(code), workspaceQuery(*workspace), nil); err != nil {
+        return err
+    }
+    fmt.Fprintf(os.Stderr, "deleted %s\n", code)
+    return nil
+}
@@ -0,0 +1,99 @@
+// Command snapurlctl manages a snapurl instance, either directly through its
+// database file or remotely through the HTTP API.
+package main
+
+import (
+    "database/sql"
+    "fmt"
+    "os"
+
+    _ "github.com/mattn/go-sqlite3"
+    "github.com/valorm/snapurl/internal/config"
+)
+
+const usage = `usage: snapurlctl <command> [flags]
+
+commands:
+  links     create, get, list, update, revoke, unrevoke and delete links
+  keys      create, list, revoke and rotate API keys
+  stats     show server metrics, or the stats of one link
+  export    export links as CSV or NDJSON
+  import    import links from CSV or NDJSON
+  backup    write an online snapshot of the database
+  restore   replace the database with a verified backup (server stopped)
+  verify    check a database or backup file
+  migrate   show, apply, revert or create schema migrations
+  doctor    check the database for damage and schema drift
+  config    print the effective server configuration
+
+links, keys, stats, export, import and doctor work on the database file given with
+-db (default: db_path from the server config), or on a running server with
+-server and -key (or SNAPURL_SERVER and SNAPURL_API_KEY). -server may be the
+server's admin socket as unix:/path/to/admin.sock.
+
+Run "snapurlctl <command> -h" for the flags of a command.
+`
+
+func main() {
+    if len(os.Args) < 2 {
+        fmt.Fprint(os.Stderr, usage)
+        os.Exit(2)
+    }
+
+    var err error
+    switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+    case "links":
+        err = runLinks(args)
+    case "keys":
+        err = runKeys(args)
+    case "stats":
+        err = runStats(args)
+    case "export":
+        err = runExport(args)
+    case "import":
+        err = runImport(args)
+    case "backup":
+        err = runBackup(args)
+    case "restore":
+        err = runRestore(args)
+    case "verify":
+        err = runVerify(args)
+    case "doctor":
+        err = runDoctor(args)
+    case "migrate":
+        err = runMigrate(args)
+    case "config":
+        err = runConfig(args)
+    case "help", "-h", "--help":
+        fmt.Print(usage)
+        return
+    default:
+        fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+        os.Exit(2)
+    }
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "snapurlctl:", err)
+        os.Exit(1)
+    }
+}
+
+// defaultDBPath is the db_path from the server configuration, if it can be
+// loaded.
+func defaultDBPath() string {
+    cfg, err := config.LoadConfig()
+    if err != nil {
+        return ""
+    }
+    return cfg.DBPath
+}
+
+// openExisting opens a database file without creating or migrating it.
+func openExisting(path string) (*sql.DB, error) {
+    if path == "" {
+        return nil, fmt.Errorf("no database path; use -db")
+    }
+    if _, err := os.Stat(path); err != nil {
+        return nil, err
+    }
+    return sql.Open("sqlite3", path)
+}
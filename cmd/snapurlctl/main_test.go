@@ -0,0 +1,187 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "io"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "testing"
+
+    "github.com/valorm/snapurl/internal/datastore"
+)
+
+// newLocalDB creates a migrated database file for local-mode commands.
+func newLocalDB(t *testing.T) string {
+    t.Helper()
+    path := filepath.Join(t.TempDir(), "snapurl.db")
+    db, err := datastore.OpenDB(path)
+    if err != nil {
+        t.Fatalf("OpenDB: %v", err)
+    }
+    db.Close()
+    return path
+}
+
+// run runs a command and returns what it printed on stdout.
+func run(t *testing.T, fn func([]string) error, args ...string) string {
+    t.Helper()
+    r, w, err := os.Pipe()
+    if err != nil {
+        t.Fatalf("pipe: %v", err)
+    }
+    stdout := os.Stdout
+    os.Stdout = w
+    out := make(chan string)
+    go func() {
+        var buf bytes.Buffer
+        io.Copy(&buf, r)
+        out <- buf.String()
+    }()
+
+    err = fn(args)
+    os.Stdout = stdout
+    w.Close()
+    got := <-out
+    if err != nil {
+        t.Fatalf("%v: %v", args, err)
+    }
+    return got
+}
+
+func TestLocalLinks(t *testing.T) {
+    db := newLocalDB(t)
+
+    // 1) Create, get and list
+    var link struct {
+        Shortcode string `json:"shortcode"`
+        TargetURL string `json:"target_url"`
+        Revoked   bool   `json:"revoked"`
+    }
+    out := run(t, runLinks, "create", "https://example.com/a", "-db", db)
+    if err := json.Unmarshal([]byte(out), &link); err != nil || link.Shortcode == "" {
+        t.Fatalf("links create: %q, %v", out, err)
+    }
+    code := link.Shortcode
+    out = run(t, runLinks, "get", code, "-db", db)
+    if err := json.Unmarshal([]byte(out), &link); err != nil || link.TargetURL != "https://example.com/a" {
+        t.Errorf("links get: %q, %v", out, err)
+    }
+    if out := run(t, runLinks, "list", "-db", db); !strings.Contains(out, code) {
+        t.Errorf("links list: %q", out)
+    }
+
+    // 2) Revoke and restore
+    run(t, runLinks, "revoke", code, "-db", db, "-reason", "test")
+    json.Unmarshal([]byte(run(t, runLinks, "get", code, "-db", db)), &link)
+    if !link.Revoked {
+        t.Error("link not revoked")
+    }
+    run(t, runLinks, "unrevoke", code, "-db", db)
+    json.Unmarshal([]byte(run(t, runLinks, "get", code, "-db", db)), &link)
+    if link.Revoked {
+        t.Error("link still revoked")
+    }
+
+    // 3) Errors from the API are returned
+    if err := runLinks([]string{"get", "missing", "-db", db}); err == nil || !strings.Contains(err.Error(), "404") {
+        t.Errorf("links get missing: want 404 error, got %v", err)
+    }
+
+    // 4) Databases with pending migrations are refused, as by the server
+    old := filepath.Join(t.TempDir(), "old.db")
+    odb, err := datastore.Open(old)
+    if err != nil {
+        t.Fatalf("Open: %v", err)
+    }
+    if _, err := datastore.MigrateUp(odb, 5); err != nil {
+        t.Fatalf("MigrateUp: %v", err)
+    }
+    odb.Close()
+    if err := runLinks([]string{"list", "-db", old}); err == nil || !strings.Contains(err.Error(), `run "snapurlctl migrate up"`) {
+        t.Errorf("links list on an old schema: want migrate hint, got %v", err)
+    }
+}
+
+func TestLocalKeys(t *testing.T) {
+    db := newLocalDB(t)
+
+    var key struct {
+        ID     int    `json:"id"`
+        Secret string `json:"secret"`
+        Scope  string `json:"scope"`
+    }
+    out := run(t, runKeys, "create", "ci", "-db", db, "-scope", "admin")
+    if err := json.Unmarshal([]byte(out), &key); err != nil || key.Secret == "" || key.Scope != "admin" {
+        t.Fatalf("keys create: %q, %v", out, err)
+    }
+    id := strconv.Itoa(key.ID)
+    if out := run(t, runKeys, "list", "-db", db); !strings.Contains(out, `"ci"`) || strings.Contains(out, key.Secret) {
+        t.Errorf("keys list: %q", out)
+    }
+
+    out = run(t, runKeys, "rotate", id, "-db", db)
+    var rotated struct{ Secret string }
+    if err := json.Unmarshal([]byte(out), &rotated); err != nil || rotated.Secret == "" || rotated.Secret == key.Secret {
+        t.Errorf("keys rotate: %q, %v", out, err)
+    }
+    run(t, runKeys, "revoke", id, "-db", db)
+    if err := runKeys([]string{"revoke", "999", "-db", db}); err == nil {
+        t.Error("keys revoke of an unknown id: want error")
+    }
+}
+
+func TestLocalExportImport(t *testing.T) {
+    src, dst := newLocalDB(t), newLocalDB(t)
+    var codes []string
+    for _, u := range []string{"https://a.example/", "https://b.example/"} {
+        var link struct{ Shortcode string }
+        json.Unmarshal([]byte(run(t, runLinks, "create", u, "-db", src)), &link)
+        codes = append(codes, link.Shortcode)
+    }
+
+    // 1) Export to stdout and to a file
+    ndjson := run(t, runExport, "-db", src)
+    if n := strings.Count(ndjson, "\n"); n != 2 || !strings.Contains(ndjson, codes[0]) {
+        t.Fatalf("export: %q", ndjson)
+    }
+    file := filepath.Join(t.TempDir(), "links.csv")
+    run(t, runExport, "-db", src, "-format", "csv", "-out", file)
+    data, err := os.ReadFile(file)
+    if err != nil || !strings.HasPrefix(string(data), "shortcode,target_url,") || strings.Count(string(data), "\n") != 3 {
+        t.Fatalf("export file: %q, %v", data, err)
+    }
+
+    // 2) Import the file, first as a dry run; the format comes from the
+    // extension
+    var report struct {
+        DryRun  bool `json:"dry_run"`
+        Created int  `json:"created"`
+        Skipped int  `json:"skipped"`
+    }
+    json.Unmarshal([]byte(run(t, runImport, file, "-db", dst, "-dry-run")), &report)
+    if !report.DryRun || report.Created != 2 {
+        t.Errorf("dry run: %+v", report)
+    }
+    if err := runLinks([]string{"get", codes[0], "-db", dst}); err == nil {
+        t.Error("dry run stored links")
+    }
+    json.Unmarshal([]byte(run(t, runImport, file, "-db", dst)), &report)
+    if report.DryRun || report.Created != 2 {
+        t.Errorf("import: %+v", report)
+    }
+    if out := run(t, runLinks, "get", codes[1], "-db", dst); !strings.Contains(out, "https://b.example/") {
+        t.Errorf("imported link: %q", out)
+    }
+
+    // 3) Existing shortcodes fail the import unless skipped
+    if err := runImport([]string{file, "-db", dst}); err == nil || !strings.Contains(err.Error(), "409") {
+        t.Errorf("conflicting import: want 409 error, got %v", err)
+    }
+    json.Unmarshal([]byte(run(t, runImport, file, "-db", dst, "-conflict", "skip")), &report)
+    if report.Skipped != 2 {
+        t.Errorf("import with skip: %+v", report)
+    }
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "os"
+    "text/tabwriter"
+    "time"
+
+    "github.com/valorm/snapurl/internal/datastore"
+)
+
+const migrateUsage = `usage: snapurlctl migrate <command> [flags]
+
+commands:
+  status    list applied and pending migrations
+  up        apply pending migrations (all, or up to -to)
+  down      revert migrations (the newest one, or down to -to)
+  create    scaffold a new numbered migration and its down file
+`
+
+func runMigrate(args []string) error {
+    if len(args) == 0 {
+        fmt.Fprint(os.Stderr, migrateUsage)
+        os.Exit(2)
+    }
+    switch cmd, args := args[0], args[1:]; cmd {
+    case "status":
+        return runMigrateStatus(args)
+    case "up":
+        return runMigrateUp(args)
+    case "down":
+        return runMigrateDown(args)
+    case "create":
+        return runMigrateCreate(args)
+    default:
+        return fmt.Errorf("unknown migrate command %q", cmd)
+    }
+}
+
+func runMigrateStatus(args []string) error {
+    fs := flag.NewFlagSet("migrate status", flag.ExitOnError)
+    dbPath := fs.String("db", defaultDBPath(), "database file")
+    fs.Parse(args)
+
+    db, err := openExisting(*dbPath)
+    if err != nil {
+        return err
+    }
+    defer db.Close()
+    migrations, err := datastore.MigrationStatus(db)
+    if err != nil {
+        return err
+    }
+
+    tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+    fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS\tREVERSIBLE")
+    pending := 0
+    for _, m := range migrations {
+        status := "pending"
+        switch {
+        case m.Unknown:
+            status = "applied (unknown to this binary)"
+        case m.Applied && m.AppliedAt.Valid:
+            status = "applied " + m.AppliedAt.Time.UTC().Format(time.RFC3339)
+        case m.Applied:
+            status = "applied"
+        default:
+            pending++
+        }
+        reversible := "no"
+        if m.Reversible {
+            reversible = "yes"
+        }
+        fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", m.Version, m.Name, status, reversible)
+    }
+    tw.Flush()
+    fmt.Fprintf(os.Stderr, "%d pending\n", pending)
+    return nil
+}
+
+func runMigrateUp(args []string) error {
+    fs := flag.NewFlagSet("migrate up", flag.ExitOnError)
+    dbPath := fs.String("db", defaultDBPath(), "database file")
+    to := fs.Int("to", 0, "last version to apply (default: all)")
+    fs.Parse(args)
+
+    db, err := datastore.Open(*dbPath)
+    if err != nil {
+        return err
+    }
+    defer db.Close()
+    done, err := datastore.MigrateUp(db, *to)
+    for _, name := range done {
+        fmt.Fprintf(os.Stderr, "applied %s\n", name)
+    }
+    if err == nil && len(done) == 0 {
+        fmt.Fprintln(os.Stderr, "nothing to apply")
+    }
+    return err
+}
+
+func runMigrateDown(args []string) error {
+    fs := flag.NewFlagSet("migrate down", flag.ExitOnError)
+    dbPath := fs.String("db", defaultDBPath(), "database file")
+    to := fs.Int("to", -1, "version to revert to; 0 reverts everything (default: revert the newest migration)")
+    fs.Parse(args)
+
+    db, err := openExisting(*dbPath)
+    if err != nil {
+        return err
+    }
+    defer db.Close()
+
+    target := *to
+    if target < 0 {
+        migrations, err := datastore.MigrationStatus(db)
+        if err != nil {
+            return err
+        }
+        // The version before the newest applied one
+        target = 0
+        var newest int
+        for _, m := range migrations {
+            if m.Applied {
+                target, newest = newest, m.Version
+            }
+        }
+    }
+
+    done, err := datastore.MigrateDown(db, target)
+    for _, name := range done {
+        fmt.Fprintf(os.Stderr, "reverted %s\n", name)
+    }
+    if err == nil && len(done) == 0 {
+        fmt.Fprintln(os.Stderr, "nothing to revert")
+    }
+    return err
+}
+
+func runMigrateCreate(args []string) error {
+    fs := flag.NewFlagSet("migrate create", flag.ExitOnError)
+    dir := fs.String("dir", "internal/datastore/migrations", "migrations directory of the source tree")
+    name, err := parseArgs(fs, args, "name")
+    if err != nil {
+        return err
+    }
+
+    up, down, err := datastore.CreateMigration(*dir, name)
+    if err != nil {
+        return err
+    }
+    fmt.Println(up)
+    fmt.Println(down)
+    return nil
+}
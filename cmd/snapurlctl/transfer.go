@@ -0,0 +1,155 @@
+package main
+
+import (
+    "encoding/json"
+    "flag"
+    "fmt"
+    "io"
+    "net/url"
+    "os"
+    "strconv"
+    "strings"
+)
+
+func runExport(args []string) error {
+    fs := flag.NewFlagSet("export", flag.ExitOnError)
+    t := targetFlags(fs)
+    format := fs.String("format", "ndjson", "csv or ndjson")
+    workspace := fs.Int("workspace", 0, "only links of this workspace")
+    owner := fs.String("owner", "", "only links of this owner (admin keys)")
+    out := fs.String("out", "-", `output file, or "-" for stdout`)
+    fs.Parse(args)
+
+    q := url.Values{"format": {*format}}
+    if *workspace != 0 {
+        q.Set("workspace", strconv.Itoa(*workspace))
+    }
+    if *owner != "" {
+        q.Set("owner", *owner)
+    }
+
+    c, err := t.client()
+    if err != nil {
+        return err
+    }
+    defer c.Close()
+    resp, err := c.send("GET", "/api/v1/links:export", q, "", nil)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    if *out == "-" {
+        _, err = io.Copy(os.Stdout, resp.Body)
+        return err
+    }
+
+    f, err := os.Create(*out)
+    if err != nil {
+        return err
+    }
+    if _, err = io.Copy(f, resp.Body); err == nil {
+        err = f.Close()
+    } else {
+        f.Close()
+    }
+    if err != nil {
+        os.Remove(*out)
+    }
+    return err
+}
+
+func runImport(args []string) error {
+    fs := flag.NewFlagSet("import", flag.ExitOnError)
+    t := targetFlags(fs)
+    format := fs.String("format", "", "csv or ndjson (default: from the file extension)")
+    conflict := fs.String("conflict", "fail", "existing shortcodes: skip, overwrite or fail")
+    dryRun := fs.Bool("dry-run", false, "report the outcome without storing anything")
+    in, err := parseArgs(fs, args, "file")
+    if err != nil {
+        return err
+    }
+
+    var body io.Reader = os.Stdin
+    if in != "-" {
+        f, err := os.Open(in)
+        if err != nil {
+            return err
+        }
+        defer f.Close()
+        body = f
+    }
+    if *format == "" {
+        *format = "ndjson"
+        if strings.HasSuffix(in, ".csv") {
+            *format = "csv"
+        }
+    }
+
+    c, err := t.client()
+    if err != nil {
+        return err
+    }
+    defer c.Close()
+    q := url.Values{"format": {*format}, "conflict": {*conflict}, "dry_run": {strconv.FormatBool(*dryRun)}}
+    data, err := c.do("POST", "/api/v1/links:import", q, "", body)
+    if err != nil {
+        return err
+    }
+    return printJSON(data)
+}
+
+func runStats(args []string) error {
+    fs := flag.NewFlagSet("stats", flag.ExitOnError)
+    t := targetFlags(fs)
+    workspace := fs.Int("workspace", 0, "workspace of the link")
+    var code string
+    if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+        code, args = args[0], args[1:]
+    }
+    fs.Parse(args)
+    if code == "" {
+        code = fs.Arg(0)
+    }
+
+    c, err := t.client()
+    if err != nil {
+        return err
+    }
+    defer c.Close()
+
+    // With a shortcode, the stats of that link
+    if code != "" {
+        data, err := c.doJSON("GET", "/api/v1/links/"+url.PathEscape(code), workspaceQuery(*workspace), nil)
+        if err != nil {
+            return err
+        }
+        var link map[string]any
+        if err := json.Unmarshal(data, &link); err != nil {
+            return err
+        }
+        stats := map[string]any{}
+        for _, k := range []string{"shortcode", "hits", "created_at", "expires_at", "revoked", "revoked_at"} {
+            if v, ok := link[k]; ok {
+                stats[k] = v
+            }
+        }
+        data, _ = json.Marshal(stats)
+        return printJSON(data)
+    }
+
+    data, err := c.do("GET", "/metrics", nil, "", nil)
+    if err != nil {
+        return err
+    }
+    if c.store != nil {
+        // Counters live in the server process; only the database-backed
+        // figures mean anything here
+        var metrics map[string]uint64
+        if err := json.Unmarshal(data, &metrics); err != nil {
+            return err
+        }
+        data, _ = json.Marshal(map[string]uint64{"active_links": metrics["active_links"]})
+        fmt.Fprintln(os.Stderr, "local mode: request counters are only available from a running server (-server)")
+    }
+    return printJSON(data)
+}
@@ -1,14 +1,21 @@
 package main
 
 import (
-    "fmt"
+    "flag"
+    "log"
+    "os"
+
     "github.com/valorm/snapurl/internal/config"
 )
 
 func main() {
-    cfg, err := config.LoadConfig()
-    if err != nil {
-        panic(err)
+    flags := config.NewFlags(flag.CommandLine)
+    flag.Parse()
+    if _, err := flags.Load(); err != nil {
+        log.Fatal(err)
+    }
+    // Secrets are redacted; see also "snapurlctl config print"
+    if err := config.WriteSettings(os.Stdout, flags.Settings()); err != nil {
+        log.Fatal(err)
     }
-    fmt.Printf("%+v\n", cfg)
 }
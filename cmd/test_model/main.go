@@ -16,12 +16,15 @@ func main() {
         log.Fatalf("load config: %v", err)
     }
 
-    // 2) Open DB (runs migrations)
-    db, err := datastore.OpenDB(cfg.DBPath)
+    // 2) Open DB; the schema is left to the server and snapurlctl migrate
+    db, err := datastore.Open(cfg.DBPath)
     if err != nil {
         log.Fatalf("open db: %v", err)
     }
     defer db.Close()
+    if err := datastore.CheckSchema(db); err != nil {
+        log.Fatalf("check schema: %v", err)
+    }
 
     // 3) Clear any existing test record
     db.Exec("DELETE FROM links WHERE shortcode = ?", "abc123")
@@ -0,0 +1,52 @@
+package api
+
+import (
+    "database/sql"
+    "log"
+    "net/http"
+    "os"
+    "time"
+
+    "github.com/valorm/snapurl/internal/config"
+    "github.com/valorm/snapurl/internal/datastore"
+)
+
+// BackupStreamHandler handles GET /api/v1/admin/backup, streaming a
+// consistent snapshot of the live database.
+func BackupStreamHandler(db *sql.DB) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        filename := "snapurl-" + time.Now().UTC().Format("20060102-150405") + ".db"
+        w.Header().Set("Content-Type", "application/vnd.sqlite3")
+        w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+        if err := datastore.BackupTo(r.Context(), db, w); err != nil {
+            // Nothing was written if the snapshot itself failed
+            log.Printf("backup stream: %v", err)
+            http.Error(w, "Failed to back up database", http.StatusInternalServerError)
+        }
+    })
+}
+
+// BackupHandler handles POST /api/v1/admin/backup, writing a snapshot into
+// backup_dir and applying the retention policy.
+func BackupHandler(db *sql.DB, cfg *config.Config) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if cfg.BackupDir == "" {
+            http.Error(w, "backup_dir is not configured", http.StatusBadRequest)
+            return
+        }
+        path, err := datastore.BackupToDir(r.Context(), db, cfg.BackupDir, cfg.BackupRetention)
+        if err != nil {
+            log.Printf("backup: %v", err)
+            if path == "" {
+                http.Error(w, "Failed to back up database", http.StatusInternalServerError)
+                return
+            }
+        }
+        info, err := os.Stat(path)
+        if err != nil {
+            http.Error(w, "Failed to back up database", http.StatusInternalServerError)
+            return
+        }
+        writeJSON(w, http.StatusCreated, map[string]any{"path": path, "size": info.Size()})
+    })
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "net/http"
+
+    "github.com/valorm/snapurl/internal/blocklist"
+    "github.com/valorm/snapurl/internal/config"
+    "github.com/valorm/snapurl/internal/service"
+)
+
+const (
+    defaultMaxBatchSize = 1000
+    // maxBatchItemBytes bounds the request body per allowed item.
+    maxBatchItemBytes = 8 << 10
+)
+
+// batchResult is the outcome of one item of a batch, in request order.
+type batchResult struct {
+    Index  int              `json:"index"`
+    Status int              `json:"status"`
+    Link   *shortenResponse `json:"link,omitempty"`
+    Error  string           `json:"error,omitempty"`
+}
+
+// BatchCreateHandler handles POST /api/v1/links:batch. The body is an array
+// of /shorten requests. Every item is validated on its own and reported with
+// its own status; the valid ones are then inserted in one transaction, so
+// a database failure stores none of them.
+func BatchCreateHandler(db *sql.DB, cfg *config.Config, bl *blocklist.List, exp *service.Expander) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        maxItems := cfg.MaxBatchSize
+        if maxItems <= 0 {
+            maxItems = defaultMaxBatchSize
+        }
+        r.Body = http.MaxBytesReader(w, r.Body, int64(maxItems)*maxBatchItemBytes)
+
+        var reqs []shortenRequest
+        if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil || len(reqs) == 0 {
+            http.Error(w, "Invalid request body", http.StatusBadRequest)
+            return
+        }
+        if len(reqs) > maxItems {
+            http.Error(w, fmt.Sprintf("Batch exceeds %d links", maxItems), http.StatusRequestEntityTooLarge)
+            return
+        }
+
+        results := make([]batchResult, len(reqs))
+        var pending []service.LinkRequest
+        var pendingIdx []int
+        hosts := make([]string, len(reqs))
+        for i, req := range reqs {
+            results[i].Index = i
+
+            target, status, err := resolveTarget(r.Context(), db, cfg, bl, exp, req.URL)
+            if err != nil {
+                results[i].Status, results[i].Error = status, err.Error()
+                continue
+            }
+            workspaceID, host, err := creationWorkspace(db, r, req.Domain)
+            if err != nil {
+                results[i].Status, results[i].Error = workspaceErrorStatus(err)
+                continue
+            }
+
+            hosts[i] = host
+            pending = append(pending, service.LinkRequest{TargetURL: target, Options: req.options(r, workspaceID)})
+            pendingIdx = append(pendingIdx, i)
+        }
+
+        if len(pending) > 0 {
+            links, created, err := service.CreateLinks(db, pending)
+            if err != nil {
+                http.Error(w, "Failed to create links", http.StatusInternalServerError)
+                return
+            }
+            for j, link := range links {
+                i := pendingIdx[j]
+                resp := newShortenResponse(cfg, r, link, hosts[i])
+                results[i].Status, results[i].Link = http.StatusCreated, &resp
+                if !created[j] {
+                    resp.Reused, results[i].Status = true, http.StatusOK
+                }
+            }
+        }
+
+        writeJSON(w, http.StatusOK, map[string]any{
+            "succeeded": len(pending),
+            "failed":    len(reqs) - len(pending),
+            "results":   results,
+        })
+    })
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+    "database/sql"
+    "errors"
+    "fmt"
+    "html/template"
+    "log"
+    "net/http"
+
+    "github.com/valorm/snapurl/internal/blocklist"
+    "github.com/valorm/snapurl/internal/models"
+    "github.com/valorm/snapurl/internal/service"
+    "github.com/valorm/snapurl/internal/telemetry"
+)
+
+const blockActionWarn = "warn"
+
+var interstitialTmpl = template.Must(template.New("interstitial").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>Warning: suspicious link</title></head>
+<body>
+<h1>This link may be unsafe</h1>
+<p>The destination of this short link has been reported as phishing or spam.</p>
+<p>It points to: <code>{{.}}</code></p>
+<p><a href="{{.}}" rel="noopener noreferrer nofollow">Continue anyway</a></p>
+</body>
+</html>
+`))
+
+// errBlocked is reported for targets on the blocklist.
+var errBlocked = errors.New("url is blocked")
+
+// isBlocked reports whether a target URL is on the blocklist, counting and
+// logging the rejection.
+func isBlocked(bl *blocklist.List, target string) bool {
+    rule, blocked := bl.Match(target)
+    if blocked {
+        telemetry.Increment("links_blocked")
+        log.Printf("blocklist: rejected %s (rule %q)", target, rule)
+    }
+    return blocked
+}
+
+// handleBlockedRedirect applies the blocklist to a link about to be
+// followed. Depending on cfg.BlocklistAction it shows a warning page or
+// revokes the link and answers 410. It reports whether the request was
+// handled.
+func handleBlockedRedirect(w http.ResponseWriter, db *sql.DB, action string, bl *blocklist.List, link models.Link) bool {
+    rule, blocked := bl.Match(link.TargetURL)
+    if !blocked {
+        return false
+    }
+    telemetry.Increment("links_blocked")
+
+    if action == blockActionWarn {
+        w.Header().Set("Content-Type", "text/html; charset=utf-8")
+        w.Header().Set("Cache-Control", "no-store")
+        w.WriteHeader(http.StatusOK)
+        interstitialTmpl.Execute(w, link.TargetURL)
+        return true
+    }
+
+    rev := service.Revocation{
+        Reason: fmt.Sprintf("destination matches blocklist rule %q", rule),
+        Actor:  "blocklist",
+    }
+    if err := service.RevokeLink(db, link.WorkspaceID, link.Shortcode, "", rev); err != nil {
+        log.Printf("blocklist: revoke %s: %v", link.Shortcode, err)
+    } else {
+        log.Printf("blocklist: revoked %s -> %s (rule %q)", link.Shortcode, link.TargetURL, rule)
+    }
+    http.Error(w, "link revoked", http.StatusGone)
+    return true
+}
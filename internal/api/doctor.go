@@ -0,0 +1,41 @@
+package api
+
+import (
+    "database/sql"
+    "log"
+    "net/http"
+    "strconv"
+
+    "github.com/valorm/snapurl/internal/datastore"
+)
+
+// DoctorHandler handles GET and POST /api/v1/admin/doctor, reporting on
+// the health of the database. POST may also run maintenance with
+// ?vacuum=true and ?analyze=true once the checks passed.
+func DoctorHandler(db *sql.DB) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        var opts datastore.DoctorOptions
+        if r.Method == http.MethodPost {
+            for name, dst := range map[string]*bool{"vacuum": &opts.Vacuum, "analyze": &opts.Analyze} {
+                v := r.URL.Query().Get(name)
+                if v == "" {
+                    continue
+                }
+                b, err := strconv.ParseBool(v)
+                if err != nil {
+                    http.Error(w, "Invalid "+name, http.StatusBadRequest)
+                    return
+                }
+                *dst = b
+            }
+        }
+
+        report, err := datastore.Doctor(r.Context(), db, opts)
+        if err != nil {
+            log.Printf("doctor: %v", err)
+            http.Error(w, "Failed to check database", http.StatusInternalServerError)
+            return
+        }
+        writeJSON(w, http.StatusOK, report)
+    })
+}
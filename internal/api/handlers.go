@@ -1,94 +1,209 @@
 package api
 
 import (
+    "crypto/sha256"
     "database/sql"
+    "encoding/hex"
     "encoding/json"
+    "errors"
+    "io"
     "net/http"
-    "strings"
+    "strconv"
     "time"
 
+    "github.com/valorm/snapurl/internal/blocklist"
+    "github.com/valorm/snapurl/internal/config"
+    "github.com/valorm/snapurl/internal/models"
     "github.com/valorm/snapurl/internal/service"
     "github.com/valorm/snapurl/internal/telemetry"
+    "github.com/valorm/snapurl/pkg/qrcode"
 )
 
-// ShortenHandler handles POST /shorten
-func ShortenHandler(db *sql.DB) http.Handler {
+// shortenRequest is a link to create, as sent to POST /shorten and in
+// batches.
+type shortenRequest struct {
+    URL           string    `json:"url"`
+    Expiry        time.Time `json:"expiry,omitempty"`
+    Domain        string    `json:"domain,omitempty"`
+    ReuseExisting bool      `json:"reuse_existing,omitempty"`
+}
+
+// options returns the service options for the request.
+func (req shortenRequest) options(r *http.Request, workspaceID int) service.CreateLinkOptions {
+    opts := service.CreateLinkOptions{WorkspaceID: workspaceID, ReuseExisting: req.ReuseExisting}
+    if !req.Expiry.IsZero() {
+        expiry := req.Expiry
+        opts.Expiry = &expiry
+    }
+    if key, ok := APIKeyFromContext(r.Context()); ok {
+        opts.OwnerID = key.OwnerID
+    }
+    return opts
+}
+
+// shortenResponse is the body returned by POST /shorten. Reused marks an
+// existing link returned for "reuse_existing".
+type shortenResponse struct {
+    linkResponse
+    ShortURL string `json:"short_url"`
+    QRURL    string `json:"qr_url"`
+    Reused   bool   `json:"reused,omitempty"`
+}
+
+// newShortenResponse builds the response for a created link served on
+// host (see creationWorkspace).
+func newShortenResponse(cfg *config.Config, r *http.Request, link models.Link, host string) shortenResponse {
+    shortURL := baseURL(cfg, r, host) + "/" + link.Shortcode
+    return shortenResponse{
+        linkResponse: newLinkResponse(link),
+        ShortURL:     shortURL,
+        QRURL:        shortURL + "/qr",
+    }
+}
+
+// linkLocation returns the path of a link resource.
+func linkLocation(link models.Link) string {
+    location := "/api/v1/links/" + link.Shortcode
+    if link.WorkspaceID != models.DefaultWorkspaceID {
+        location += "?workspace=" + strconv.Itoa(link.WorkspaceID)
+    }
+    return location
+}
+
+// ShortenHandler handles POST /shorten. When the request carries an API
+// key, the new link belongs to that key's owner. The workspace comes from
+// the key, the optional "domain" field or the request Host, and the
+// response carries the short URL on that workspace's domain plus a
+// Location header pointing at the link resource. With "reuse_existing" an
+// active link for the same target is returned instead of a new one, with
+// 200 OK and "reused": true instead of 201 Created.
+func ShortenHandler(db *sql.DB, cfg *config.Config, bl *blocklist.List, exp *service.Expander) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        if r.Method != http.MethodPost {
-            http.NotFound(w, r)
+        var req shortenRequest
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+            http.Error(w, "Invalid request body", http.StatusBadRequest)
             return
         }
-
-        var req struct {
-            URL    string    `json:"url"`
-            Expiry time.Time `json:"expiry,omitempty"`
-        }
-        if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.URL) == "" {
-            http.Error(w, "Invalid request body", http.StatusBadRequest)
+        target, ok := checkTarget(w, r, db, cfg, bl, exp, req.URL)
+        if !ok {
             return
         }
 
-        var expiry *time.Time
-        if !req.Expiry.IsZero() {
-            expiry = &req.Expiry
+        workspaceID, host, err := creationWorkspace(db, r, req.Domain)
+        if err != nil {
+            writeWorkspaceError(w, err)
+            return
         }
 
-        link, err := service.CreateLink(db, strings.TrimSpace(req.URL), expiry)
+        link, created, err := service.CreateLink(db, target, req.options(r, workspaceID))
         if err != nil {
             http.Error(w, "Failed to create link", http.StatusInternalServerError)
             return
         }
 
-        w.Header().Set("Content-Type", "application/json")
-        w.WriteHeader(http.StatusCreated)
-        json.NewEncoder(w).Encode(map[string]string{"shortcode": link.Shortcode})
+        resp, status := newShortenResponse(cfg, r, link, host), http.StatusCreated
+        if !created {
+            resp.Reused, status = true, http.StatusOK
+        }
+        w.Header().Set("Location", linkLocation(link))
+        writeJSON(w, status, resp)
     })
 }
 
-// RedirectHandler handles GET /{shortcode}
-func RedirectHandler(db *sql.DB) http.Handler {
+// RedirectHandler handles GET and HEAD /{code}, resolving the code in the
+// workspace of the request Host. HEAD requests (link previews, uptime
+// checks) are answered without counting a hit. Links whose target has since
+// been blocklisted are revoked or shown behind a warning page. Lookups use
+// rdb and blocklist revocations are written through db; hits are counted
+// by hits, off the request path, or written through db when hits is nil.
+func RedirectHandler(db, rdb *sql.DB, hits *service.HitCounter, cfg *config.Config, bl *blocklist.List) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        if r.Method != http.MethodGet {
+        code := r.PathValue("code")
+        if code == "" {
             http.NotFound(w, r)
             return
         }
-        code := strings.TrimPrefix(r.URL.Path, "/")
-        if code == "" {
-            http.NotFound(w, r)
+
+        workspaceID, err := service.WorkspaceForHost(rdb, r.Host)
+        if err != nil {
+            http.Error(w, "Failed to resolve link", http.StatusInternalServerError)
             return
         }
 
-        link, err := service.ResolveLink(db, code)
+        link, err := service.ResolveLink(rdb, workspaceID, code)
         if err != nil {
-            http.Error(w, err.Error(), http.StatusGone)
+            http.Error(w, goneMessage(link, err), http.StatusGone)
+            return
+        }
+        if handleBlockedRedirect(w, db, cfg.BlocklistAction, bl, link) {
             return
         }
 
-        _ = service.IncrementHits(db, code)
+        if r.Method != http.MethodHead {
+            if hits != nil {
+                hits.Add(workspaceID, code)
+            } else {
+                _ = service.IncrementHits(db, workspaceID, code)
+            }
+        }
         http.Redirect(w, r, link.TargetURL, http.StatusFound)
     })
 }
 
-// RevokeHandler handles DELETE /{shortcode}
-func RevokeHandler(db *sql.DB, apiKeys []string) http.Handler {
+// goneMessage explains a failed ResolveLink to the visitor. Revocation
+// reasons are only shown when they were marked public.
+func goneMessage(link models.Link, err error) string {
+    if errors.Is(err, service.ErrLinkRevoked) && link.ReasonPublic && link.RevokedReason != "" {
+        return "link revoked: " + link.RevokedReason
+    }
+    return err.Error()
+}
+
+// maxRevokeReason bounds the length of a revocation reason.
+const maxRevokeReason = 500
+
+// RevokeHandler handles DELETE /{code} and DELETE /api/v1/links/{code}.
+// Authentication is left to AuthMiddleware; non-admin keys can only revoke
+// their own links. An optional JSON body gives the reason and whether it is
+// shown to visitors of the revoked link.
+func RevokeHandler(db *sql.DB) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        if r.Method != http.MethodDelete {
-            http.NotFound(w, r)
+        code := r.PathValue("code")
+        if code == "" {
+            http.Error(w, "Shortcode missing", http.StatusBadRequest)
+            return
+        }
+
+        var req struct {
+            Reason string `json:"reason"`
+            Public bool   `json:"public"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+            http.Error(w, "Invalid request body", http.StatusBadRequest)
             return
         }
-        apiKey := r.Header.Get("X-API-Key")
-        if !contains(apiKeys, apiKey) {
-            http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        if len(req.Reason) > maxRevokeReason {
+            http.Error(w, "Reason too long", http.StatusBadRequest)
             return
         }
 
-        code := strings.TrimPrefix(r.URL.Path, "/")
-        if code == "" {
-            http.Error(w, "Shortcode missing", http.StatusBadRequest)
+        workspaceID, err := requestWorkspace(db, r)
+        if err != nil {
+            writeWorkspaceError(w, err)
             return
         }
 
-        if err := service.RevokeLink(db, code); err != nil {
+        actor, err := keyActor(db, r)
+        if err != nil {
+            http.Error(w, "Failed to revoke link", http.StatusInternalServerError)
+            return
+        }
+        rev := service.Revocation{Reason: req.Reason, Actor: actor, Public: req.Public}
+        if err := service.RevokeLink(db, workspaceID, code, ownerScope(r), rev); err != nil {
+            if errors.Is(err, service.ErrNotFound) {
+                http.NotFound(w, r)
+                return
+            }
             http.Error(w, "Failed to revoke link", http.StatusInternalServerError)
             return
         }
@@ -97,13 +212,99 @@ func RevokeHandler(db *sql.DB, apiKeys []string) http.Handler {
     })
 }
 
-// MetricsHandler handles GET /metrics
-func MetricsHandler(db *sql.DB) http.Handler {
+// UnrevokeHandler handles POST /api/v1/links/{code}/unrevoke. Admin keys
+// can restore any link; other keys only their own links, and only when
+// they were revoked by the same key (or a rotation of it) rather than by
+// an admin or the blocklist.
+func UnrevokeHandler(db *sql.DB) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        if r.Method != http.MethodGet {
-            http.NotFound(w, r)
+        workspaceID, err := requestWorkspace(db, r)
+        if err != nil {
+            writeWorkspaceError(w, err)
+            return
+        }
+
+        code, owner := r.PathValue("code"), ownerScope(r)
+        link, err := service.GetLink(db, workspaceID, code, owner)
+        if err == nil && owner != "" && link.Revoked {
+            var actor string
+            if actor, err = keyActor(db, r); err == nil && link.RevokedBy != actor {
+                http.Error(w, "Link was revoked by another key", http.StatusForbidden)
+                return
+            }
+        }
+        if err == nil {
+            link, err = service.UnrevokeLink(db, workspaceID, code, owner)
+        }
+        if err != nil {
+            if errors.Is(err, service.ErrNotFound) {
+                http.NotFound(w, r)
+                return
+            }
+            http.Error(w, "Failed to unrevoke link", http.StatusInternalServerError)
+            return
+        }
+        writeJSON(w, http.StatusOK, newLinkResponse(link))
+    })
+}
+
+// QRHandler handles GET /{code}/qr, rendering the short URL of an active
+// link as a PNG QR code. Revoked and expired links are gone, as on
+// redirect. Clients may keep the image but must revalidate it, so a
+// revoked link stops serving its code at once; the ETag spares them the
+// download while the link stays active.
+func QRHandler(db *sql.DB, cfg *config.Config) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        code := r.PathValue("code")
+        workspaceID, host := models.DefaultWorkspaceID, ""
+        if id, err := service.LookupWorkspaceDomain(db, r.Host); err == nil {
+            workspaceID, host = id, r.Host
+        } else if !errors.Is(err, service.ErrNotFound) {
+            http.Error(w, "Failed to resolve link", http.StatusInternalServerError)
             return
         }
+
+        if link, err := service.ResolveLink(db, workspaceID, code); err != nil {
+            switch {
+            case errors.Is(err, service.ErrNotFound):
+                http.NotFound(w, r)
+            case errors.Is(err, service.ErrLinkRevoked), errors.Is(err, service.ErrLinkExpired):
+                http.Error(w, goneMessage(link, err), http.StatusGone)
+            default:
+                http.Error(w, "Failed to resolve link", http.StatusInternalServerError)
+            }
+            return
+        }
+
+        shortURL := baseURL(cfg, r, host) + "/" + code
+        sum := sha256.Sum256([]byte(shortURL))
+        etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+        w.Header().Set("Cache-Control", "no-cache")
+        w.Header().Set("ETag", etag)
+        if r.Header.Get("If-None-Match") == etag {
+            w.WriteHeader(http.StatusNotModified)
+            return
+        }
+
+        qr, err := qrcode.Encode([]byte(shortURL))
+        if err != nil {
+            http.Error(w, "Failed to render QR code", http.StatusInternalServerError)
+            return
+        }
+        img, err := qr.PNG(8)
+        if err != nil {
+            http.Error(w, "Failed to render QR code", http.StatusInternalServerError)
+            return
+        }
+
+        w.Header().Set("Content-Type", "image/png")
+        w.Write(img)
+    })
+}
+
+// MetricsHandler handles GET /metrics
+func MetricsHandler(db *sql.DB) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
         w.Header().Set("Content-Type", "application/json")
         metrics, err := telemetry.GetMetrics(db)
         if err != nil {
@@ -3,14 +3,21 @@ package api
 import (
     "database/sql"
     "encoding/json"
+    "fmt"
     "net/http"
     "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strconv"
     "strings"
     "testing"
     "time"
 
+    "github.com/valorm/snapurl/internal/blocklist"
     "github.com/valorm/snapurl/internal/config"
     "github.com/valorm/snapurl/internal/datastore"
+    "github.com/valorm/snapurl/internal/models"
+    "github.com/valorm/snapurl/internal/service"
     _ "github.com/mattn/go-sqlite3"
 )
 
@@ -36,6 +43,7 @@ func TestFullWorkflow(t *testing.T) {
         RateLimit: 10,
         APIKeys:   []string{"test-key"},
     }
+    router := NewRouter(cfg, datastore.Single(db), nil, nil)
 
     // 1) Create
     createBody := `{"url":"https://example.com","expiry":"` +
@@ -43,7 +51,7 @@ func TestFullWorkflow(t *testing.T) {
     req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(createBody))
     req.Header.Set("Content-Type", "application/json")
     rr := httptest.NewRecorder()
-    ShortenHandler(db).ServeHTTP(rr, req)
+    router.ServeHTTP(rr, req)
     if rr.Code != http.StatusCreated {
         t.Fatalf("Create: want 201, got %d", rr.Code)
     }
@@ -55,7 +63,7 @@ func TestFullWorkflow(t *testing.T) {
 
     // 2) Redirect
     rr = httptest.NewRecorder()
-    RedirectHandler(db).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/"+code, nil))
+    router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/"+code, nil))
     if rr.Code != http.StatusFound {
         t.Errorf("Redirect: want 302, got %d", rr.Code)
     }
@@ -67,21 +75,21 @@ func TestFullWorkflow(t *testing.T) {
     req = httptest.NewRequest(http.MethodDelete, "/"+code, nil)
     req.Header.Set("X-API-Key", "test-key")
     rr = httptest.NewRecorder()
-    RevokeHandler(db, cfg.APIKeys).ServeHTTP(rr, req)
+    router.ServeHTTP(rr, req)
     if rr.Code != http.StatusNoContent {
         t.Errorf("Revoke: want 204, got %d", rr.Code)
     }
 
     // 4) Access after revoke
     rr = httptest.NewRecorder()
-    RedirectHandler(db).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/"+code, nil))
+    router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/"+code, nil))
     if rr.Code != http.StatusGone {
         t.Errorf("Post-revoke: want 410, got %d", rr.Code)
     }
 
     // 5) Metrics
     rr = httptest.NewRecorder()
-    MetricsHandler(db).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+    router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
     if rr.Code != http.StatusOK {
         t.Errorf("Metrics: want 200, got %d", rr.Code)
     }
@@ -98,7 +106,7 @@ func TestFullWorkflow(t *testing.T) {
 
     // 6) Health
     rr = httptest.NewRecorder()
-    HealthHandler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/health", nil))
+    router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/health", nil))
     if rr.Code != http.StatusOK {
         t.Errorf("Health: want 200, got %d", rr.Code)
     }
@@ -110,3 +118,987 @@ func TestFullWorkflow(t *testing.T) {
         t.Errorf("Health status: want ok, got %q", h["status"])
     }
 }
+
+func TestRouting(t *testing.T) {
+    db := setupTestDB(t)
+    defer db.Close()
+
+    cfg := &config.Config{APIKeys: []string{"test-key"}}
+    router := NewRouter(cfg, datastore.Single(db), nil, nil)
+
+    db.Exec("INSERT INTO links (shortcode, target_url) VALUES (?, ?)", "route01", "https://example.com")
+    db.Exec("INSERT INTO links (shortcode, target_url) VALUES (?, ?)", "route02", "https://example.org")
+
+    tests := []struct {
+        name   string
+        method string
+        path   string
+        key    string
+        want   int
+    }{
+        {"head redirect", http.MethodHead, "/route01", "", http.StatusFound},
+        {"post to shortcode", http.MethodPost, "/route01", "", http.StatusMethodNotAllowed},
+        {"get shorten", http.MethodGet, "/shorten", "", http.StatusGone},
+        {"revoke without key", http.MethodDelete, "/route01", "", http.StatusUnauthorized},
+        {"revoke with bad key", http.MethodDelete, "/route01", "nope", http.StatusUnauthorized},
+        {"revoke", http.MethodDelete, "/route01", "test-key", http.StatusNoContent},
+        {"api revoke without key", http.MethodDelete, "/api/v1/links/route02", "", http.StatusUnauthorized},
+        {"api revoke", http.MethodDelete, "/api/v1/links/route02", "test-key", http.StatusNoContent},
+        {"api key as path", http.MethodDelete, "/test-key", "", http.StatusUnauthorized},
+    }
+    for _, tc := range tests {
+        req := httptest.NewRequest(tc.method, tc.path, nil)
+        if tc.key != "" {
+            req.Header.Set("X-API-Key", tc.key)
+        }
+        rr := httptest.NewRecorder()
+        router.ServeHTTP(rr, req)
+        if rr.Code != tc.want {
+            t.Errorf("%s: want %d, got %d", tc.name, tc.want, rr.Code)
+        }
+    }
+
+    // HEAD must not count as a hit
+    var hits int
+    db.QueryRow("SELECT hits FROM links WHERE shortcode = ?", "route01").Scan(&hits)
+    if hits != 0 {
+        t.Errorf("HEAD counted as hit: got %d hits", hits)
+    }
+}
+
+func TestLinkOwnership(t *testing.T) {
+    db := setupTestDB(t)
+    defer db.Close()
+
+    cfg := &config.Config{APIKeys: []string{"admin-key"}}
+    router := NewRouter(cfg, datastore.Single(db), nil, nil)
+
+    _, keyA, err := service.CreateAPIKey(db, "a", "team-a", models.ScopeUser, 0)
+    if err != nil {
+        t.Fatalf("create key a: %v", err)
+    }
+    _, keyB, err := service.CreateAPIKey(db, "b", "team-b", models.ScopeUser, 0)
+    if err != nil {
+        t.Fatalf("create key b: %v", err)
+    }
+
+    do := func(method, path, key, body string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(method, path, strings.NewReader(body))
+        if key != "" {
+            req.Header.Set("X-API-Key", key)
+        }
+        rr := httptest.NewRecorder()
+        router.ServeHTTP(rr, req)
+        return rr
+    }
+
+    // 1) Each team creates a link
+    var created struct{ Shortcode string }
+    rr := do(http.MethodPost, "/shorten", keyA, `{"url":"https://a.example"}`)
+    if rr.Code != http.StatusCreated {
+        t.Fatalf("create a: want 201, got %d", rr.Code)
+    }
+    json.NewDecoder(rr.Body).Decode(&created)
+    codeA := created.Shortcode
+
+    rr = do(http.MethodPost, "/shorten", keyB, `{"url":"https://b.example"}`)
+    json.NewDecoder(rr.Body).Decode(&created)
+    codeB := created.Shortcode
+
+    if rr := do(http.MethodPost, "/shorten", "bogus", `{"url":"https://x.example"}`); rr.Code != http.StatusUnauthorized {
+        t.Errorf("create with bad key: want 401, got %d", rr.Code)
+    }
+
+    // 2) Listing only shows own links
+    var list []struct {
+        Shortcode string `json:"shortcode"`
+        OwnerID   string `json:"owner_id"`
+    }
+    rr = do(http.MethodGet, "/api/v1/links", keyA, "")
+    json.NewDecoder(rr.Body).Decode(&list)
+    if len(list) != 1 || list[0].Shortcode != codeA || list[0].OwnerID != "team-a" {
+        t.Errorf("list a: want only %s owned by team-a, got %+v", codeA, list)
+    }
+    rr = do(http.MethodGet, "/api/v1/links", "admin-key", "")
+    json.NewDecoder(rr.Body).Decode(&list)
+    if len(list) != 2 {
+        t.Errorf("list admin: want 2 links, got %d", len(list))
+    }
+
+    // 3) Other owners' links look like they don't exist
+    if rr := do(http.MethodGet, "/api/v1/links/"+codeB, keyA, ""); rr.Code != http.StatusNotFound {
+        t.Errorf("get foreign: want 404, got %d", rr.Code)
+    }
+    if rr := do(http.MethodPatch, "/api/v1/links/"+codeB, keyA, `{"url":"https://evil.example"}`); rr.Code != http.StatusNotFound {
+        t.Errorf("update foreign: want 404, got %d", rr.Code)
+    }
+    if rr := do(http.MethodDelete, "/api/v1/links/"+codeB, keyA, ""); rr.Code != http.StatusNotFound {
+        t.Errorf("revoke foreign: want 404, got %d", rr.Code)
+    }
+
+    // 4) Owners and admins can act
+    if rr := do(http.MethodPatch, "/api/v1/links/"+codeA, keyA, `{"url":"https://a2.example"}`); rr.Code != http.StatusOK {
+        t.Errorf("update own: want 200, got %d", rr.Code)
+    }
+    if rr := do(http.MethodDelete, "/api/v1/links/"+codeA, keyA, ""); rr.Code != http.StatusNoContent {
+        t.Errorf("revoke own: want 204, got %d", rr.Code)
+    }
+    if rr := do(http.MethodDelete, "/api/v1/links/"+codeB, "admin-key", ""); rr.Code != http.StatusNoContent {
+        t.Errorf("revoke as admin: want 204, got %d", rr.Code)
+    }
+
+    // 5) Key management needs admin scope
+    if rr := do(http.MethodGet, "/api/v1/keys", keyA, ""); rr.Code != http.StatusForbidden {
+        t.Errorf("list keys as user: want 403, got %d", rr.Code)
+    }
+}
+
+func TestWorkspaceDomains(t *testing.T) {
+    db := setupTestDB(t)
+    defer db.Close()
+
+    cfg := &config.Config{APIKeys: []string{"admin-key"}}
+    router := NewRouter(cfg, datastore.Single(db), nil, nil)
+
+    do := func(method, host, path, key, body string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(method, path, strings.NewReader(body))
+        req.Host = host
+        if key != "" {
+            req.Header.Set("X-API-Key", key)
+        }
+        rr := httptest.NewRecorder()
+        router.ServeHTTP(rr, req)
+        return rr
+    }
+
+    // 1) Two branded workspaces
+    var wsA, wsB struct{ ID int }
+    rr := do(http.MethodPost, "admin.local", "/api/v1/workspaces", "admin-key", `{"name":"brand-a","domains":["go.brand-a.com"]}`)
+    if rr.Code != http.StatusCreated {
+        t.Fatalf("create workspace a: want 201, got %d", rr.Code)
+    }
+    json.NewDecoder(rr.Body).Decode(&wsA)
+    rr = do(http.MethodPost, "admin.local", "/api/v1/workspaces", "admin-key", `{"name":"brand-b","domains":["l.brand-b.com"]}`)
+    json.NewDecoder(rr.Body).Decode(&wsB)
+    if rr := do(http.MethodPost, "admin.local", "/api/v1/workspaces", "admin-key", `{"name":"dup","domains":["GO.brand-a.com"]}`); rr.Code != http.StatusConflict {
+        t.Errorf("duplicate domain: want 409, got %d", rr.Code)
+    }
+
+    // 2) Creating on a branded host returns that host's short URL
+    var created struct {
+        Shortcode string `json:"shortcode"`
+        ShortURL  string `json:"short_url"`
+    }
+    rr = do(http.MethodPost, "go.brand-a.com", "/shorten", "", `{"url":"https://a.example"}`)
+    json.NewDecoder(rr.Body).Decode(&created)
+    if created.ShortURL != "http://go.brand-a.com/"+created.Shortcode {
+        t.Errorf("short_url: got %q", created.ShortURL)
+    }
+    code := created.Shortcode
+
+    // 3) The same code is independent in the other workspace
+    db.Exec("INSERT INTO links (workspace_id, shortcode, target_url) VALUES (?, ?, ?)", wsB.ID, code, "https://b.example")
+    if loc := do(http.MethodGet, "go.brand-a.com:443", "/"+code, "", "").Header().Get("Location"); loc != "https://a.example" {
+        t.Errorf("brand-a redirect: got %q", loc)
+    }
+    if loc := do(http.MethodGet, "l.brand-b.com", "/"+code, "", "").Header().Get("Location"); loc != "https://b.example" {
+        t.Errorf("brand-b redirect: got %q", loc)
+    }
+    if rr := do(http.MethodGet, "unmapped.example", "/"+code, "", ""); rr.Code != http.StatusGone {
+        t.Errorf("default workspace: want 410, got %d", rr.Code)
+    }
+
+    // 4) A key bound to brand-b creates links there whatever the host
+    _, keyB, err := service.CreateAPIKey(db, "b", "team-b", models.ScopeUser, wsB.ID)
+    if err != nil {
+        t.Fatalf("create key: %v", err)
+    }
+    rr = do(http.MethodPost, "go.brand-a.com", "/shorten", keyB, `{"url":"https://b2.example"}`)
+    json.NewDecoder(rr.Body).Decode(&created)
+    if created.ShortURL != "http://l.brand-b.com/"+created.Shortcode {
+        t.Errorf("bound key short_url: got %q", created.ShortURL)
+    }
+    if rr := do(http.MethodPost, "x", "/shorten", keyB, `{"url":"https://b3.example","domain":"go.brand-a.com"}`); rr.Code != http.StatusForbidden {
+        t.Errorf("bound key on foreign domain: want 403, got %d", rr.Code)
+    }
+    if rr := do(http.MethodPost, "x", "/shorten", "", `{"url":"https://c.example","domain":"nope.example"}`); rr.Code != http.StatusBadRequest {
+        t.Errorf("unknown domain: want 400, got %d", rr.Code)
+    }
+}
+
+func TestShortenResponse(t *testing.T) {
+    db := setupTestDB(t)
+    defer db.Close()
+
+    cfg := &config.Config{PublicBaseURL: "https://sn.ap/"}
+    router := NewRouter(cfg, datastore.Single(db), nil, nil)
+
+    expiry := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+    body := `{"url":"https://example.com/page","expiry":"` + expiry.Format(time.RFC3339) + `"}`
+    rr := httptest.NewRecorder()
+    router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(body)))
+    if rr.Code != http.StatusCreated {
+        t.Fatalf("Create: want 201, got %d", rr.Code)
+    }
+
+    var resp struct {
+        Shortcode string     `json:"shortcode"`
+        ShortURL  string     `json:"short_url"`
+        TargetURL string     `json:"target_url"`
+        CreatedAt time.Time  `json:"created_at"`
+        ExpiresAt *time.Time `json:"expires_at"`
+        QRURL     string     `json:"qr_url"`
+    }
+    if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+        t.Fatalf("decode: %v", err)
+    }
+    if resp.ShortURL != "https://sn.ap/"+resp.Shortcode {
+        t.Errorf("short_url: got %q", resp.ShortURL)
+    }
+    if resp.TargetURL != "https://example.com/page" {
+        t.Errorf("target_url: got %q", resp.TargetURL)
+    }
+    if resp.CreatedAt.IsZero() || resp.ExpiresAt == nil || !resp.ExpiresAt.Equal(expiry) {
+        t.Errorf("timestamps: created %v, expires %v", resp.CreatedAt, resp.ExpiresAt)
+    }
+    if resp.QRURL != resp.ShortURL+"/qr" {
+        t.Errorf("qr_url: got %q", resp.QRURL)
+    }
+    if loc := rr.Header().Get("Location"); loc != "/api/v1/links/"+resp.Shortcode {
+        t.Errorf("Location: got %q", loc)
+    }
+
+    // Reusing an existing link is 200 OK, not 201 Created
+    for i, want := range []int{http.StatusCreated, http.StatusOK} {
+        rr := httptest.NewRecorder()
+        router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(`{"url":"https://example.com/reused","reuse_existing":true}`)))
+        var body struct {
+            Reused bool `json:"reused"`
+        }
+        json.NewDecoder(rr.Body).Decode(&body)
+        if rr.Code != want || body.Reused != (i == 1) {
+            t.Errorf("reuse_existing request %d: want %d, got %d (reused %v)", i, want, rr.Code, body.Reused)
+        }
+    }
+
+    rr = httptest.NewRecorder()
+    router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/"+resp.Shortcode+"/qr", nil))
+    if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "image/png" {
+        t.Errorf("QR: want 200 image/png, got %d %q", rr.Code, rr.Header().Get("Content-Type"))
+    }
+    etag := rr.Header().Get("ETag")
+    if etag == "" || rr.Header().Get("Cache-Control") != "no-cache" {
+        t.Errorf("QR caching: ETag %q, Cache-Control %q", etag, rr.Header().Get("Cache-Control"))
+    }
+    req := httptest.NewRequest(http.MethodGet, "/"+resp.Shortcode+"/qr", nil)
+    req.Header.Set("If-None-Match", etag)
+    rr = httptest.NewRecorder()
+    router.ServeHTTP(rr, req)
+    if rr.Code != http.StatusNotModified {
+        t.Errorf("QR revalidation: want 304, got %d", rr.Code)
+    }
+    // Once revoked, revalidation no longer succeeds
+    db.Exec("UPDATE links SET revoked = 1 WHERE shortcode = ?", resp.Shortcode)
+    rr = httptest.NewRecorder()
+    router.ServeHTTP(rr, req)
+    if rr.Code != http.StatusGone {
+        t.Errorf("QR revalidation after revoke: want 410, got %d", rr.Code)
+    }
+    rr = httptest.NewRecorder()
+    router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/missing/qr", nil))
+    if rr.Code != http.StatusNotFound {
+        t.Errorf("QR missing: want 404, got %d", rr.Code)
+    }
+
+    // Revoked and expired links get no QR code
+    db.Exec("INSERT INTO links (shortcode, target_url, revoked, revoked_reason, revoked_reason_public) VALUES ('qrgone1', 'https://example.com', 1, 'phishing', 1)")
+    db.Exec("INSERT INTO links (shortcode, target_url, expires_at) VALUES ('qrgone2', 'https://example.com', ?)", time.Now().Add(-time.Hour))
+    for code, want := range map[string]string{"qrgone1": "link revoked: phishing", "qrgone2": "link expired"} {
+        rr = httptest.NewRecorder()
+        router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/"+code+"/qr", nil))
+        if rr.Code != http.StatusGone || !strings.Contains(rr.Body.String(), want) {
+            t.Errorf("QR %s: want 410 %q, got %d %q", code, want, rr.Code, rr.Body.String())
+        }
+    }
+}
+
+func TestIdempotencyKey(t *testing.T) {
+    db := setupTestDB(t)
+    defer db.Close()
+
+    cfg := &config.Config{IdempotencyWindow: time.Hour}
+    router := NewRouter(cfg, datastore.Single(db), nil, nil)
+
+    post := func(key, body string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(body))
+        req.Header.Set("Idempotency-Key", key)
+        rr := httptest.NewRecorder()
+        router.ServeHTTP(rr, req)
+        return rr
+    }
+
+    first := post("batch-1", `{"url":"https://example.com"}`)
+    if first.Code != http.StatusCreated {
+        t.Fatalf("first: want 201, got %d", first.Code)
+    }
+
+    // A retry replays the original response instead of creating a link
+    retry := post("batch-1", `{"url":"https://example.com"}`)
+    if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+        t.Errorf("retry: want identical 201, got %d %s", retry.Code, retry.Body.String())
+    }
+    if retry.Header().Get("Location") != first.Header().Get("Location") {
+        t.Errorf("retry Location: want %q, got %q", first.Header().Get("Location"), retry.Header().Get("Location"))
+    }
+    if retry.Header().Get("Idempotent-Replayed") != "true" {
+        t.Error("retry: missing Idempotent-Replayed header")
+    }
+    var count int
+    db.QueryRow("SELECT COUNT(*) FROM links").Scan(&count)
+    if count != 1 {
+        t.Errorf("links: want 1, got %d", count)
+    }
+
+    // Same key, different body
+    if rr := post("batch-1", `{"url":"https://other.example"}`); rr.Code != http.StatusUnprocessableEntity {
+        t.Errorf("reuse: want 422, got %d", rr.Code)
+    }
+
+    // Failed requests are not remembered
+    if rr := post("batch-2", `{}`); rr.Code != http.StatusBadRequest {
+        t.Fatalf("bad body: want 400, got %d", rr.Code)
+    }
+    if rr := post("batch-2", `{}`); rr.Code != http.StatusBadRequest || rr.Header().Get("Idempotent-Replayed") != "" {
+        t.Errorf("bad body retry: want a fresh 400, got %d (replayed %q)", rr.Code, rr.Header().Get("Idempotent-Replayed"))
+    }
+    if rr := post("batch-2", `{"url":"https://example.org"}`); rr.Code != http.StatusCreated {
+        t.Errorf("corrected retry: want 201, got %d", rr.Code)
+    }
+
+    // Expired keys are forgotten
+    db.Exec("UPDATE idempotency_keys SET created_at = ?", time.Now().Add(-2*time.Hour).UTC())
+    if rr := post("batch-1", `{"url":"https://other.example"}`); rr.Code != http.StatusCreated {
+        t.Errorf("after window: want 201, got %d", rr.Code)
+    }
+}
+
+func TestURLValidation(t *testing.T) {
+    db := setupTestDB(t)
+    defer db.Close()
+
+    router := NewRouter(&config.Config{APIKeys: []string{"admin-key"}}, datastore.Single(db), nil, nil)
+    do := func(method, path, body string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(method, path, strings.NewReader(body))
+        req.Header.Set("X-API-Key", "admin-key")
+        rr := httptest.NewRecorder()
+        router.ServeHTTP(rr, req)
+        return rr
+    }
+
+    for body, want := range map[string]string{
+        `{"url":"javascript:alert(1)"}`: `scheme "javascript" is not allowed`,
+        `{"url":"file:///etc/passwd"}`:  `scheme "file" is not allowed`,
+        `{"url":"not a url"}`:           "whitespace",
+        `{"url":""}`:                    "empty",
+    } {
+        rr := do(http.MethodPost, "/shorten", body)
+        if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), want) {
+            t.Errorf("POST %s: want 400 mentioning %q, got %d %q", body, want, rr.Code, rr.Body.String())
+        }
+    }
+
+    rr := do(http.MethodPost, "/shorten", `{"url":"HTTPS://Bücher.Example:443/x"}`)
+    if rr.Code != http.StatusCreated {
+        t.Fatalf("POST idn: want 201, got %d", rr.Code)
+    }
+    var link struct {
+        Shortcode string `json:"shortcode"`
+        TargetURL string `json:"target_url"`
+    }
+    json.NewDecoder(rr.Body).Decode(&link)
+    if link.TargetURL != "https://xn--bcher-kva.example/x" {
+        t.Errorf("normalized target: got %q", link.TargetURL)
+    }
+
+    if rr := do(http.MethodPatch, "/api/v1/links/"+link.Shortcode, `{"url":"file:///etc/passwd"}`); rr.Code != http.StatusBadRequest {
+        t.Errorf("PATCH file url: want 400, got %d", rr.Code)
+    }
+}
+
+func TestBlocklist(t *testing.T) {
+    db := setupTestDB(t)
+    defer db.Close()
+
+    path := filepath.Join(t.TempDir(), "blocklist.txt")
+    os.WriteFile(path, []byte(".phish.example\n"), 0o644)
+    bl, err := blocklist.Load(path)
+    if err != nil {
+        t.Fatalf("Load: %v", err)
+    }
+
+    // Links created before the rule existed
+    revokeLink, _, _ := service.CreateLink(db, "https://login.scam.example", service.CreateLinkOptions{})
+    warnLink, _, _ := service.CreateLink(db, "https://other.scam.example", service.CreateLinkOptions{})
+
+    cfg := &config.Config{}
+    router := NewRouter(cfg, datastore.Single(db), bl, nil)
+    do := func(method, path, body string) *httptest.ResponseRecorder {
+        rr := httptest.NewRecorder()
+        router.ServeHTTP(rr, httptest.NewRequest(method, path, strings.NewReader(body)))
+        return rr
+    }
+
+    if rr := do(http.MethodPost, "/shorten", `{"url":"https://www.phish.example/login"}`); rr.Code != http.StatusForbidden {
+        t.Errorf("blocked create: want 403, got %d", rr.Code)
+    }
+
+    // The rule is extended while running; existing links get revoked
+    os.WriteFile(path, []byte(".phish.example\n.scam.example\n"), 0o644)
+    os.Chtimes(path, time.Now(), time.Now().Add(time.Second))
+    if _, err := bl.Reload(); err != nil {
+        t.Fatalf("Reload: %v", err)
+    }
+    if rr := do(http.MethodGet, "/"+revokeLink.Shortcode, ""); rr.Code != http.StatusGone {
+        t.Errorf("blocked redirect: want 410, got %d", rr.Code)
+    }
+    if l, _ := service.GetLink(db, models.DefaultWorkspaceID, revokeLink.Shortcode, ""); !l.Revoked {
+        t.Error("blocked link was not revoked")
+    }
+
+    // In warn mode an interstitial page is shown instead
+    cfg.BlocklistAction = "warn"
+    router = NewRouter(cfg, datastore.Single(db), bl, nil)
+    rr := do(http.MethodGet, "/"+warnLink.Shortcode, "")
+    if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "https://other.scam.example") {
+        t.Errorf("interstitial: want 200 page with target, got %d", rr.Code)
+    }
+    if l, _ := service.GetLink(db, models.DefaultWorkspaceID, warnLink.Shortcode, ""); l.Revoked || l.Hits != 0 {
+        t.Error("warn mode should neither revoke nor count a hit")
+    }
+}
+
+func TestRedirectLoopsAndChains(t *testing.T) {
+    db := setupTestDB(t)
+    defer db.Close()
+
+    if _, err := service.CreateWorkspace(db, "brand-a", []string{"go.brand-a.com"}); err != nil {
+        t.Fatalf("CreateWorkspace: %v", err)
+    }
+    cfg := &config.Config{PublicBaseURL: "https://sn.ap", ShortenerDomains: []string{"bit.ly"}}
+    router := NewRouter(cfg, datastore.Single(db), nil, nil)
+
+    for target, want := range map[string]int{
+        "https://sn.ap/abc":          http.StatusBadRequest,
+        "https://GO.brand-a.com/x":   http.StatusBadRequest,
+        "https://bit.ly/3xyz":        http.StatusBadRequest,
+        "https://www.bit.ly/3xyz":    http.StatusBadRequest,
+        "https://example.com/bit.ly": http.StatusCreated,
+    } {
+        rr := httptest.NewRecorder()
+        router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(`{"url":"`+target+`"}`)))
+        if rr.Code != want {
+            t.Errorf("%s: want %d, got %d %s", target, want, rr.Code, rr.Body.String())
+        }
+    }
+}
+
+func TestBatchCreate(t *testing.T) {
+    db := setupTestDB(t)
+    defer db.Close()
+
+    cfg := &config.Config{APIKeys: []string{"admin-key"}, MaxBatchSize: 3, PublicBaseURL: "https://sn.ap"}
+    router := NewRouter(cfg, datastore.Single(db), nil, nil)
+    do := func(key, body string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(http.MethodPost, "/api/v1/links:batch", strings.NewReader(body))
+        if key != "" {
+            req.Header.Set("X-API-Key", key)
+        }
+        rr := httptest.NewRecorder()
+        router.ServeHTTP(rr, req)
+        return rr
+    }
+
+    rr := do("admin-key", `[
+        {"url":"https://a.example","reuse_existing":true},
+        {"url":"javascript:alert(1)"},
+        {"url":"https://a.example","reuse_existing":true}
+    ]`)
+    if rr.Code != http.StatusOK {
+        t.Fatalf("batch: want 200, got %d %s", rr.Code, rr.Body.String())
+    }
+    var resp struct {
+        Succeeded int `json:"succeeded"`
+        Failed    int `json:"failed"`
+        Results   []struct {
+            Index  int    `json:"index"`
+            Status int    `json:"status"`
+            Error  string `json:"error"`
+            Link   *struct {
+                Shortcode string `json:"shortcode"`
+                ShortURL  string `json:"short_url"`
+                Reused    bool   `json:"reused"`
+            } `json:"link"`
+        } `json:"results"`
+    }
+    if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+        t.Fatalf("decode: %v", err)
+    }
+    if resp.Succeeded != 2 || resp.Failed != 1 || len(resp.Results) != 3 {
+        t.Fatalf("batch counts: %+v", resp)
+    }
+    first, bad, dup := resp.Results[0], resp.Results[1], resp.Results[2]
+    if first.Status != http.StatusCreated || first.Link == nil || first.Link.ShortURL != "https://sn.ap/"+first.Link.Shortcode || first.Link.Reused {
+        t.Errorf("item 0: %+v", first)
+    }
+    if bad.Index != 1 || bad.Status != http.StatusBadRequest || !strings.Contains(bad.Error, "javascript") {
+        t.Errorf("item 1: %+v", bad)
+    }
+    if dup.Status != http.StatusOK || dup.Link == nil || dup.Link.Shortcode != first.Link.Shortcode || !dup.Link.Reused {
+        t.Errorf("item 2 should reuse the link of item 0: %+v", dup)
+    }
+    var count int
+    db.QueryRow("SELECT COUNT(*) FROM links").Scan(&count)
+    if count != 1 {
+        t.Errorf("links: want 1, got %d", count)
+    }
+
+    if rr := do("admin-key", `[{"url":"https://a.example"},{"url":"https://b.example"},{"url":"https://c.example"},{"url":"https://d.example"}]`); rr.Code != http.StatusRequestEntityTooLarge {
+        t.Errorf("oversized batch: want 413, got %d", rr.Code)
+    }
+    if rr := do("admin-key", `[]`); rr.Code != http.StatusBadRequest {
+        t.Errorf("empty batch: want 400, got %d", rr.Code)
+    }
+    if rr := do("", `[{"url":"https://a.example"}]`); rr.Code != http.StatusUnauthorized {
+        t.Errorf("anonymous batch: want 401, got %d", rr.Code)
+    }
+}
+
+func TestExportImport(t *testing.T) {
+    db := setupTestDB(t)
+    defer db.Close()
+
+    past := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+    a, _, _ := service.CreateLink(db, "https://a.example", service.CreateLinkOptions{OwnerID: "team-a"})
+    b, _, _ := service.CreateLink(db, "https://b.example", service.CreateLinkOptions{OwnerID: "team-b", Expiry: &past})
+    service.IncrementHits(db, models.DefaultWorkspaceID, a.Shortcode)
+    service.RevokeLink(db, models.DefaultWorkspaceID, b.Shortcode, "", service.Revocation{Reason: "campaign ended", Actor: "ops", Public: true})
+    b, _ = service.GetLink(db, models.DefaultWorkspaceID, b.Shortcode, "")
+
+    cfg := &config.Config{APIKeys: []string{"admin-key"}, PublicBaseURL: "https://sn.ap", ShortenerDomains: []string{"bit.ly"}}
+    router := NewRouter(cfg, datastore.Single(db), nil, nil)
+    do := func(method, path, body string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(method, path, strings.NewReader(body))
+        req.Header.Set("X-API-Key", "admin-key")
+        rr := httptest.NewRecorder()
+        router.ServeHTTP(rr, req)
+        return rr
+    }
+
+    // 1) Export in both formats
+    csvOut := do(http.MethodGet, "/api/v1/links:export?format=csv", "")
+    if csvOut.Code != http.StatusOK || csvOut.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+        t.Fatalf("csv export: %d %s", csvOut.Code, csvOut.Header().Get("Content-Type"))
+    }
+    lines := strings.Split(strings.TrimSpace(csvOut.Body.String()), "\n")
+    if len(lines) != 3 || lines[0] != "shortcode,target_url,workspace_id,owner_id,created_at,expires_at,hits,revoked,revoked_at,revoked_reason,revoked_by,reason_public" {
+        t.Fatalf("csv export: %q", lines)
+    }
+    if !strings.HasPrefix(lines[1], a.Shortcode+",https://a.example,1,team-a,") || !strings.HasSuffix(lines[1], ",,1,false,,,,false") {
+        t.Errorf("csv record: %q", lines[1])
+    }
+    if !strings.HasSuffix(lines[2], ",true,"+b.RevokedAt.Time.UTC().Format(time.RFC3339)+",campaign ended,ops,true") {
+        t.Errorf("csv revoked record: %q", lines[2])
+    }
+    ndjson := do(http.MethodGet, "/api/v1/links:export?owner=team-b", "")
+    if n := strings.Count(ndjson.Body.String(), "\n"); ndjson.Code != http.StatusOK || n != 1 {
+        t.Fatalf("ndjson export: %d, %d lines", ndjson.Code, n)
+    }
+
+    // 2) Round trip into an empty database keeps codes, hits, expiry and
+    // revocation details, in both formats
+    db2 := setupTestDB(t)
+    defer db2.Close()
+    router = NewRouter(cfg, datastore.Single(db2), nil, nil)
+    if rr := do(http.MethodPost, "/api/v1/links:import", ndjson.Body.String()); rr.Code != http.StatusOK {
+        t.Fatalf("ndjson import: %d %s", rr.Code, rr.Body.String())
+    }
+    revoked, err := service.GetLink(db2, models.DefaultWorkspaceID, b.Shortcode, "")
+    if err != nil || !revoked.Revoked || !revoked.RevokedAt.Time.Equal(b.RevokedAt.Time) ||
+        revoked.RevokedReason != "campaign ended" || revoked.RevokedBy != "ops" || !revoked.ReasonPublic {
+        t.Errorf("imported revoked link: %+v, %v", revoked, err)
+    }
+    db2.Exec("DELETE FROM links")
+    if rr := do(http.MethodPost, "/api/v1/links:import?format=csv&dry_run=true", csvOut.Body.String()); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"created":2`) {
+        t.Fatalf("dry run: %d %s", rr.Code, rr.Body.String())
+    }
+    var count int
+    db2.QueryRow("SELECT COUNT(*) FROM links").Scan(&count)
+    if count != 0 {
+        t.Fatalf("dry run stored %d links", count)
+    }
+    if rr := do(http.MethodPost, "/api/v1/links:import?format=csv", csvOut.Body.String()); rr.Code != http.StatusOK {
+        t.Fatalf("import: %d %s", rr.Code, rr.Body.String())
+    }
+    got, err := service.GetLink(db2, models.DefaultWorkspaceID, a.Shortcode, "")
+    if err != nil || got.Hits != 1 || got.OwnerID != "team-a" || !got.CreatedAt.Equal(a.CreatedAt.UTC().Truncate(time.Second)) {
+        t.Errorf("imported link: %+v, %v", got, err)
+    }
+    if got, _ := service.GetLink(db2, models.DefaultWorkspaceID, b.Shortcode, ""); !got.RevokedAt.Time.Equal(b.RevokedAt.Time.Truncate(time.Second)) || got.RevokedReason != "campaign ended" || !got.ReasonPublic {
+        t.Errorf("imported revoked link (csv): %+v", got)
+    }
+
+    // 3) Conflict policies and invalid records
+    rec := `{"shortcode":"` + a.Shortcode + `","target_url":"https://new.example"}` + "\n"
+    if rr := do(http.MethodPost, "/api/v1/links:import", rec); rr.Code != http.StatusConflict {
+        t.Errorf("conflict=fail: want 409, got %d", rr.Code)
+    }
+    if rr := do(http.MethodPost, "/api/v1/links:import?conflict=skip", rec); !strings.Contains(rr.Body.String(), `"skipped":1`) {
+        t.Errorf("conflict=skip: %s", rr.Body.String())
+    }
+    body := rec + `{"shortcode":"health","target_url":"https://x.example"}` + "\n" +
+        `{"shortcode":"ok-1","target_url":"javascript:alert(1)"}` + "\n" +
+        `{"shortcode":"ok-2","target_url":"https://x.example","hits":-1}` + "\n" +
+        `{"shortcode":"ok-3","target_url":"https://sn.ap/abc"}` + "\n" +
+        `{"shortcode":"ok-4","target_url":"https://bit.ly/abc"}` + "\n"
+    rr := do(http.MethodPost, "/api/v1/links:import?conflict=overwrite", body)
+    if !strings.Contains(rr.Body.String(), `"overwritten":1`) || !strings.Contains(rr.Body.String(), `"invalid":5`) {
+        t.Errorf("conflict=overwrite: %s", rr.Body.String())
+    }
+    if got, _ := service.GetLink(db2, models.DefaultWorkspaceID, a.Shortcode, ""); got.TargetURL != "https://new.example" {
+        t.Errorf("overwritten target: %q", got.TargetURL)
+    }
+    if rr := do(http.MethodPost, "/api/v1/links:import", "{not json"); rr.Code != http.StatusBadRequest {
+        t.Errorf("malformed import: want 400, got %d", rr.Code)
+    }
+
+    // 4) Large imports are written in several batches; a conflict found
+    // up front stores none of them, and repeated codes in the file are
+    // rejected
+    var big strings.Builder
+    for i := 0; i < 1200; i++ {
+        fmt.Fprintf(&big, `{"shortcode":"bulk-%d","target_url":"https://bulk.example/%d"}`+"\n", i, i)
+    }
+    if rr := do(http.MethodPost, "/api/v1/links:import", big.String()+rec); rr.Code != http.StatusConflict {
+        t.Errorf("conflict after many records: want 409, got %d", rr.Code)
+    }
+    db2.QueryRow("SELECT COUNT(*) FROM links WHERE shortcode LIKE 'bulk-%'").Scan(&count)
+    if count != 0 {
+        t.Errorf("conflicting import stored %d links", count)
+    }
+    rr = do(http.MethodPost, "/api/v1/links:import", big.String()+`{"shortcode":"bulk-0","target_url":"https://x.example"}`+"\n")
+    if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"created":1200`) || !strings.Contains(rr.Body.String(), "appears earlier") {
+        t.Errorf("bulk import: %d %s", rr.Code, rr.Body.String())
+    }
+    db2.QueryRow("SELECT COUNT(*) FROM links WHERE shortcode LIKE 'bulk-%'").Scan(&count)
+    if count != 1200 {
+        t.Errorf("bulk import stored %d links, want 1200", count)
+    }
+
+    // 5) Oversized uploads are refused
+    defer func(n int64) { maxImportBytes = n }(maxImportBytes)
+    maxImportBytes = 64
+    if rr := do(http.MethodPost, "/api/v1/links:import?conflict=skip", big.String()); rr.Code != http.StatusRequestEntityTooLarge {
+        t.Errorf("oversized import: want 413, got %d", rr.Code)
+    }
+}
+
+func TestRevocationReasons(t *testing.T) {
+    db := setupTestDB(t)
+    defer db.Close()
+
+    cfg := &config.Config{APIKeys: []string{"admin-key"}}
+    router := NewRouter(cfg, datastore.Single(db), nil, nil)
+
+    key, secret, err := service.CreateAPIKey(db, "a", "team-a", models.ScopeUser, 0)
+    if err != nil {
+        t.Fatalf("create key: %v", err)
+    }
+    do := func(method, path, apiKey, body string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(method, path, strings.NewReader(body))
+        if apiKey != "" {
+            req.Header.Set("X-API-Key", apiKey)
+        }
+        rr := httptest.NewRecorder()
+        router.ServeHTTP(rr, req)
+        return rr
+    }
+    create := func() string {
+        var created struct{ Shortcode string }
+        rr := do(http.MethodPost, "/shorten", secret, `{"url":"https://a.example"}`)
+        json.NewDecoder(rr.Body).Decode(&created)
+        return created.Shortcode
+    }
+
+    // 1) Public reasons are shown on the 410, private ones are not
+    public, private := create(), create()
+    if rr := do(http.MethodDelete, "/api/v1/links/"+public, secret, `{"reason":"campaign ended","public":true}`); rr.Code != http.StatusNoContent {
+        t.Fatalf("revoke: want 204, got %d", rr.Code)
+    }
+    do(http.MethodDelete, "/api/v1/links/"+private, "admin-key", `{"reason":"phishing report #12"}`)
+
+    rr := do(http.MethodGet, "/"+public, "", "")
+    if rr.Code != http.StatusGone || !strings.Contains(rr.Body.String(), "campaign ended") {
+        t.Errorf("public reason: %d %q", rr.Code, rr.Body.String())
+    }
+    rr = do(http.MethodGet, "/"+private, "", "")
+    if rr.Code != http.StatusGone || strings.Contains(rr.Body.String(), "phishing") {
+        t.Errorf("private reason leaked: %d %q", rr.Code, rr.Body.String())
+    }
+
+    // 2) Reason, actor and time are recorded
+    var got struct {
+        RevokedAt     *time.Time `json:"revoked_at"`
+        RevokedReason string     `json:"revoked_reason"`
+        RevokedBy     string     `json:"revoked_by"`
+    }
+    json.NewDecoder(do(http.MethodGet, "/api/v1/links/"+public, secret, "").Body).Decode(&got)
+    if got.RevokedAt == nil || got.RevokedReason != "campaign ended" || got.RevokedBy != "key:"+strconv.Itoa(key.ID) {
+        t.Errorf("revocation details: %+v", got)
+    }
+
+    // 3) Owners can only undo their own revocations
+    if rr := do(http.MethodPost, "/api/v1/links/"+private+"/unrevoke", secret, ""); rr.Code != http.StatusForbidden {
+        t.Errorf("unrevoke admin revocation: want 403, got %d", rr.Code)
+    }
+    if rr := do(http.MethodPost, "/api/v1/links/"+public+"/unrevoke", secret, ""); rr.Code != http.StatusOK {
+        t.Errorf("unrevoke own: want 200, got %d", rr.Code)
+    }
+    if rr := do(http.MethodPost, "/api/v1/links/"+private+"/unrevoke", "admin-key", ""); rr.Code != http.StatusOK {
+        t.Errorf("unrevoke as admin: want 200, got %d", rr.Code)
+    }
+    for _, code := range []string{public, private} {
+        if rr := do(http.MethodGet, "/"+code, "", ""); rr.Code != http.StatusFound {
+            t.Errorf("%s after unrevoke: want 302, got %d", code, rr.Code)
+        }
+    }
+    link, _ := service.GetLink(db, models.DefaultWorkspaceID, public, "")
+    if link.RevokedAt.Valid || link.RevokedReason != "" || link.RevokedBy != "" {
+        t.Errorf("unrevoke must clear details: %+v", link)
+    }
+    if rr := do(http.MethodPost, "/api/v1/links/nope/unrevoke", "admin-key", ""); rr.Code != http.StatusNotFound {
+        t.Errorf("unrevoke missing: want 404, got %d", rr.Code)
+    }
+
+    // 4) A rotated key can still undo its revocations, another key of the
+    // same owner cannot
+    do(http.MethodDelete, "/api/v1/links/"+public, secret, "")
+    _, rotated, err := service.RotateAPIKey(db, key.ID, time.Hour)
+    if err != nil {
+        t.Fatalf("rotate key: %v", err)
+    }
+    _, other, err := service.CreateAPIKey(db, "b", "team-a", models.ScopeUser, 0)
+    if err != nil {
+        t.Fatalf("create key: %v", err)
+    }
+    if rr := do(http.MethodPost, "/api/v1/links/"+public+"/unrevoke", other, ""); rr.Code != http.StatusForbidden {
+        t.Errorf("unrevoke with another key: want 403, got %d", rr.Code)
+    }
+    if rr := do(http.MethodPost, "/api/v1/links/"+public+"/unrevoke", rotated, ""); rr.Code != http.StatusOK {
+        t.Errorf("unrevoke with the rotated key: want 200, got %d", rr.Code)
+    }
+}
+
+func TestDeleteLink(t *testing.T) {
+    db := setupTestDB(t)
+    defer db.Close()
+
+    cfg := &config.Config{APIKeys: []string{"admin-key"}}
+    router := NewRouter(cfg, datastore.Single(db), nil, nil)
+
+    _, secret, err := service.CreateAPIKey(db, "a", "team-a", models.ScopeUser, 0)
+    if err != nil {
+        t.Fatalf("create key: %v", err)
+    }
+    link, _, err := service.CreateLink(db, "https://a.example", service.CreateLinkOptions{OwnerID: "team-a"})
+    if err != nil {
+        t.Fatalf("CreateLink: %v", err)
+    }
+    del := func(key string) int {
+        req := httptest.NewRequest(http.MethodDelete, "/api/v1/admin/links/"+link.Shortcode, nil)
+        req.Header.Set("X-API-Key", key)
+        rr := httptest.NewRecorder()
+        router.ServeHTTP(rr, req)
+        return rr.Code
+    }
+
+    if code := del(secret); code != http.StatusForbidden {
+        t.Errorf("delete as owner: want 403, got %d", code)
+    }
+    if code := del("admin-key"); code != http.StatusNoContent {
+        t.Errorf("delete as admin: want 204, got %d", code)
+    }
+    if _, err := service.GetLink(db, models.DefaultWorkspaceID, link.Shortcode, ""); err != service.ErrNotFound {
+        t.Errorf("deleted link: want ErrNotFound, got %v", err)
+    }
+    if code := del("admin-key"); code != http.StatusNotFound {
+        t.Errorf("delete twice: want 404, got %d", code)
+    }
+}
+
+func TestHTTPS(t *testing.T) {
+    cfg := &config.Config{HSTSMaxAge: 365 * 24 * time.Hour, HSTSIncludeSubdomains: true}
+    ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+    hsts := HSTSMiddleware(cfg, ok)
+
+    // HSTS only on TLS responses
+    req := httptest.NewRequest(http.MethodGet, "https://sn.ap/abc", nil)
+    rr := httptest.NewRecorder()
+    hsts.ServeHTTP(rr, req)
+    if got := rr.Header().Get("Strict-Transport-Security"); got != "max-age=31536000; includeSubDomains" {
+        t.Errorf("HSTS over TLS: got %q", got)
+    }
+    req = httptest.NewRequest(http.MethodGet, "http://sn.ap/abc", nil)
+    rr = httptest.NewRecorder()
+    hsts.ServeHTTP(rr, req)
+    if got := rr.Header().Get("Strict-Transport-Security"); got != "" {
+        t.Errorf("HSTS over plain HTTP: got %q", got)
+    }
+
+    // Redirects keep host, path and query, and use the HTTPS port
+    tests := []struct {
+        addr, method, url string
+        code              int
+        location          string
+    }{
+        {":443", http.MethodGet, "http://sn.ap/abc?x=1", http.StatusMovedPermanently, "https://sn.ap/abc?x=1"},
+        {":8443", http.MethodGet, "http://sn.ap:8080/abc", http.StatusMovedPermanently, "https://sn.ap:8443/abc"},
+        {":443", http.MethodPost, "http://sn.ap/shorten", http.StatusPermanentRedirect, "https://sn.ap/shorten"},
+        {":443", http.MethodGet, "http://[::1]:80/abc", http.StatusMovedPermanently, "https://[::1]/abc"},
+    }
+    for _, tt := range tests {
+        req := httptest.NewRequest(tt.method, tt.url, nil)
+        rr := httptest.NewRecorder()
+        HTTPSRedirectHandler(tt.addr).ServeHTTP(rr, req)
+        if rr.Code != tt.code || rr.Header().Get("Location") != tt.location {
+            t.Errorf("%s %s via %s: got %d %q, want %d %q", tt.method, tt.url, tt.addr,
+                rr.Code, rr.Header().Get("Location"), tt.code, tt.location)
+        }
+    }
+}
+
+func TestAdminRouterSplit(t *testing.T) {
+    db := setupTestDB(t)
+    defer db.Close()
+
+    cfg := &config.Config{APIKeys: []string{"test-key"}, AdminAddr: "127.0.0.1:9090"}
+    store := datastore.Single(db)
+    public := NewPublicRouter(cfg, store, nil, nil)
+    admin := NewAdminRouter(cfg, store, nil)
+
+    db.Exec("INSERT INTO links (shortcode, target_url) VALUES (?, ?)", "split01", "https://example.com")
+    _, userKey, err := service.CreateAPIKey(db, "ci", "team-a", models.ScopeUser, 0)
+    if err != nil {
+        t.Fatalf("create key: %v", err)
+    }
+
+    tests := []struct {
+        name   string
+        router http.Handler
+        method string
+        path   string
+        key    string
+        want   int
+    }{
+        {"public redirect", public, http.MethodGet, "/split01", "", http.StatusFound},
+        {"public metrics", public, http.MethodGet, "/metrics", "", http.StatusGone},
+        {"public health", public, http.MethodGet, "/health", "", http.StatusGone},
+        {"public revoke", public, http.MethodDelete, "/split01", "test-key", http.StatusMethodNotAllowed},
+        {"public api", public, http.MethodGet, "/api/v1/links", "test-key", http.StatusNotFound},
+        {"public shorten disabled", public, http.MethodPost, "/shorten", "", http.StatusMethodNotAllowed},
+        {"admin redirect", admin, http.MethodGet, "/split01", "", http.StatusMethodNotAllowed},
+        {"admin metrics", admin, http.MethodGet, "/metrics", "", http.StatusOK},
+        {"admin health", admin, http.MethodGet, "/health", "", http.StatusOK},
+        {"admin pprof without key", admin, http.MethodGet, "/debug/pprof/", "", http.StatusUnauthorized},
+        {"admin pprof with user key", admin, http.MethodGet, "/debug/pprof/", userKey, http.StatusForbidden},
+        {"admin pprof", admin, http.MethodGet, "/debug/pprof/", "test-key", http.StatusOK},
+        {"admin api without key", admin, http.MethodGet, "/api/v1/links", "", http.StatusUnauthorized},
+        {"admin api", admin, http.MethodGet, "/api/v1/links", "test-key", http.StatusOK},
+    }
+    for _, tc := range tests {
+        req := httptest.NewRequest(tc.method, tc.path, nil)
+        if tc.key != "" {
+            req.Header.Set("X-API-Key", tc.key)
+        }
+        rr := httptest.NewRecorder()
+        tc.router.ServeHTTP(rr, req)
+        if rr.Code != tc.want {
+            t.Errorf("%s: want %d, got %d", tc.name, tc.want, rr.Code)
+        }
+    }
+
+    // Creation stays public when enabled
+    cfg.PublicShorten = true
+    public = NewPublicRouter(cfg, store, nil, nil)
+    req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(`{"url":"https://example.net"}`))
+    req.Header.Set("Content-Type", "application/json")
+    rr := httptest.NewRecorder()
+    public.ServeHTTP(rr, req)
+    if rr.Code != http.StatusCreated {
+        t.Fatalf("public shorten: got %d: %s", rr.Code, rr.Body.String())
+    }
+}
+
+func TestRedirectWhileWriterBusy(t *testing.T) {
+    store, err := datastore.Connect(filepath.Join(t.TempDir(), "snapurl.db"), datastore.DefaultOptions())
+    if err != nil {
+        t.Fatalf("Connect: %v", err)
+    }
+    defer store.Close()
+    if err := datastore.RunMigrations(store.Write); err != nil {
+        t.Fatalf("migrations: %v", err)
+    }
+    link, _, err := service.CreateLink(store.Write, "https://example.com", service.CreateLinkOptions{})
+    if err != nil {
+        t.Fatalf("CreateLink: %v", err)
+    }
+
+    counter := service.NewHitCounter(store.Write, 10*time.Millisecond)
+    router := NewRouter(&config.Config{APIKeys: []string{"admin-key"}}, store, nil, counter)
+    hits := func() int {
+        var n int
+        store.Read.QueryRow("SELECT hits FROM links WHERE shortcode = ?", link.Shortcode).Scan(&n)
+        return n
+    }
+
+    // 1) A long transaction holds the only writer connection, as an import
+    // batch or the janitor would; redirects are still answered
+    tx, err := store.Write.Begin()
+    if err != nil {
+        t.Fatalf("begin: %v", err)
+    }
+    done := make(chan int)
+    go func() {
+        for i := 0; i < 3; i++ {
+            rr := httptest.NewRecorder()
+            router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/"+link.Shortcode, nil))
+            if rr.Code != http.StatusFound {
+                done <- rr.Code
+                return
+            }
+        }
+        done <- http.StatusFound
+    }()
+    select {
+    case code := <-done:
+        if code != http.StatusFound {
+            t.Fatalf("redirect: want 302, got %d", code)
+        }
+    case <-time.After(2 * time.Second):
+        tx.Rollback()
+        t.Fatal("redirects waited for the writer")
+    }
+
+    // 2) The hits are written once the writer is free again
+    time.Sleep(50 * time.Millisecond)
+    if n := hits(); n != 0 {
+        t.Errorf("hits written during the transaction: %d", n)
+    }
+    tx.Rollback()
+    deadline := time.Now().Add(2 * time.Second)
+    for hits() != 3 && time.Now().Before(deadline) {
+        time.Sleep(10 * time.Millisecond)
+    }
+    if n := hits(); n != 3 {
+        t.Errorf("hits after the transaction: want 3, got %d", n)
+    }
+}
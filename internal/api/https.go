@@ -0,0 +1,59 @@
+package api
+
+import (
+    "fmt"
+    "net"
+    "net/http"
+    "strings"
+
+    "github.com/valorm/snapurl/internal/config"
+)
+
+// HSTSMiddleware adds Strict-Transport-Security to responses served over
+// TLS when cfg.HSTSMaxAge is set.
+func HSTSMiddleware(cfg *config.Config, next http.Handler) http.Handler {
+    if cfg.HSTSMaxAge <= 0 {
+        return next
+    }
+    value := fmt.Sprintf("max-age=%d", int64(cfg.HSTSMaxAge.Seconds()))
+    if cfg.HSTSIncludeSubdomains {
+        value += "; includeSubDomains"
+    }
+    if cfg.HSTSPreload {
+        value += "; preload"
+    }
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.TLS != nil {
+            w.Header().Set("Strict-Transport-Security", value)
+        }
+        next.ServeHTTP(w, r)
+    })
+}
+
+// HTTPSRedirectHandler redirects plain HTTP requests to the same host and
+// path on the HTTPS listener at httpsAddr (e.g. ":443" or ":8443").
+// Requests other than GET and HEAD get a 308 so clients repeat the method
+// and body.
+func HTTPSRedirectHandler(httpsAddr string) http.Handler {
+    _, port, _ := net.SplitHostPort(httpsAddr)
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        host := r.Host
+        if h, _, err := net.SplitHostPort(host); err == nil {
+            host = h
+        } else {
+            host = strings.Trim(host, "[]")
+        }
+        if port != "" && port != "443" {
+            host = net.JoinHostPort(host, port)
+        } else if strings.Contains(host, ":") {
+            host = "[" + host + "]" // IPv6
+        }
+        target := "https://" + host + r.URL.RequestURI()
+
+        code := http.StatusMovedPermanently
+        if r.Method != http.MethodGet && r.Method != http.MethodHead {
+            code = http.StatusPermanentRedirect
+        }
+        http.Redirect(w, r, target, code)
+    })
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "database/sql"
+    "encoding/hex"
+    "errors"
+    "io"
+    "log"
+    "net/http"
+    "time"
+
+    "github.com/valorm/snapurl/internal/service"
+)
+
+const (
+    maxIdempotencyKeyLen = 255
+    maxIdempotentBody    = 8 << 20
+)
+
+// replayedHeaders are the response headers kept for replays.
+var replayedHeaders = []string{"Content-Type", "Location"}
+
+// responseRecorder passes a response through while keeping a copy.
+type responseRecorder struct {
+    http.ResponseWriter
+    status int
+    body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+    rec.status = status
+    rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(p []byte) (int, error) {
+    if rec.status == 0 {
+        rec.status = http.StatusOK
+    }
+    rec.body.Write(p)
+    return rec.ResponseWriter.Write(p)
+}
+
+// IdempotencyMiddleware honors the Idempotency-Key header: the first
+// successful response for a key is stored for window and replayed for
+// retries with the same request; reusing the key with a different request
+// is rejected with 422. Error responses are not stored, so a corrected
+// request can reuse the key. Keys are scoped to the API key's owner. A zero
+// window disables it.
+func IdempotencyMiddleware(db *sql.DB, window time.Duration, next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        key := r.Header.Get("Idempotency-Key")
+        if key == "" || window <= 0 {
+            next.ServeHTTP(w, r)
+            return
+        }
+        if len(key) > maxIdempotencyKeyLen {
+            http.Error(w, "Idempotency-Key too long", http.StatusBadRequest)
+            return
+        }
+
+        body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBody+1))
+        if err != nil || len(body) > maxIdempotentBody {
+            http.Error(w, "Invalid request body", http.StatusBadRequest)
+            return
+        }
+        r.Body = io.NopCloser(bytes.NewReader(body))
+
+        h := sha256.New()
+        io.WriteString(h, r.Method+" "+r.Host+r.URL.RequestURI()+"\n")
+        h.Write(body)
+        hash := hex.EncodeToString(h.Sum(nil))
+
+        var owner string
+        if k, ok := APIKeyFromContext(r.Context()); ok {
+            owner = k.OwnerID
+        }
+
+        stored, err := service.BeginIdempotent(db, owner, key, hash, window)
+        switch {
+        case errors.Is(err, service.ErrIdempotencyMismatch):
+            http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+            return
+        case errors.Is(err, service.ErrIdempotencyInFlight):
+            http.Error(w, err.Error(), http.StatusConflict)
+            return
+        case err != nil:
+            http.Error(w, "Failed to check idempotency key", http.StatusInternalServerError)
+            return
+        case stored != nil:
+            for k, v := range stored.Header {
+                w.Header()[k] = v
+            }
+            w.Header().Set("Idempotent-Replayed", "true")
+            w.WriteHeader(stored.StatusCode)
+            w.Write(stored.Body)
+            return
+        }
+
+        // Errors and panics are not remembered so the client can retry
+        defer func() {
+            if stored == nil {
+                if err := service.AbortIdempotent(db, owner, key); err != nil {
+                    log.Printf("idempotency: %v", err)
+                }
+            }
+        }()
+
+        rec := &responseRecorder{ResponseWriter: w}
+        next.ServeHTTP(rec, r)
+        if rec.status == 0 || rec.status >= 400 {
+            return
+        }
+
+        stored = &service.StoredResponse{StatusCode: rec.status, Header: http.Header{}, Body: rec.body.Bytes()}
+        for _, name := range replayedHeaders {
+            if v := rec.Header().Get(name); v != "" {
+                stored.Header.Set(name, v)
+            }
+        }
+        if err := service.CompleteIdempotent(db, owner, key, *stored); err != nil {
+            log.Printf("idempotency: %v", err)
+            stored = nil
+        }
+    })
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+    "database/sql"
+    "log"
+    "net/http"
+    "time"
+
+    "github.com/valorm/snapurl/internal/config"
+    "github.com/valorm/snapurl/internal/service"
+)
+
+// JanitorOptions returns the janitor settings from cfg.
+func JanitorOptions(cfg *config.Config) service.JanitorOptions {
+    return service.JanitorOptions{
+        Retention: time.Duration(cfg.JanitorRetentionDays) * 24 * time.Hour,
+        Mode:      cfg.JanitorMode,
+    }
+}
+
+// JanitorHandler handles POST /api/v1/admin/janitor, running the janitor
+// once with the configured retention and mode.
+func JanitorHandler(db *sql.DB, cfg *config.Config) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        result, err := service.PurgeLinks(db, JanitorOptions(cfg))
+        if err != nil {
+            log.Printf("janitor: %v", err)
+            http.Error(w, "Failed to purge links", http.StatusInternalServerError)
+            return
+        }
+        writeJSON(w, http.StatusOK, result)
+    })
+}
@@ -0,0 +1,186 @@
+package api
+
+import (
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/valorm/snapurl/internal/models"
+    "github.com/valorm/snapurl/internal/service"
+)
+
+// keyResponse is the JSON representation of an API key. Secret is only
+// set in the response that creates the key.
+type keyResponse struct {
+    ID          int        `json:"id"`
+    Name        string     `json:"name"`
+    OwnerID     string     `json:"owner_id"`
+    Scope       string     `json:"scope"`
+    WorkspaceID int        `json:"workspace_id,omitempty"`
+    Prefix      string     `json:"prefix"`
+    Secret      string     `json:"secret,omitempty"`
+    CreatedAt   time.Time  `json:"created_at"`
+    ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+    Revoked     bool       `json:"revoked"`
+    RotatedFrom *int       `json:"rotated_from,omitempty"`
+}
+
+func newKeyResponse(k models.APIKey, secret string) keyResponse {
+    resp := keyResponse{
+        ID:          k.ID,
+        Name:        k.Name,
+        OwnerID:     k.OwnerID,
+        Scope:       k.Scope,
+        WorkspaceID: k.WorkspaceID,
+        Prefix:      k.Prefix,
+        Secret:      secret,
+        CreatedAt:   k.CreatedAt,
+        Revoked:     k.Revoked,
+    }
+    if k.ExpiresAt.Valid {
+        resp.ExpiresAt = &k.ExpiresAt.Time
+    }
+    if k.RotatedFrom.Valid {
+        id := int(k.RotatedFrom.Int64)
+        resp.RotatedFrom = &id
+    }
+    return resp
+}
+
+// CreateKeyHandler handles POST /api/v1/keys. The owner defaults to the
+// key name and the scope to "user".
+func CreateKeyHandler(db *sql.DB) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        var req struct {
+            Name    string `json:"name"`
+            OwnerID string `json:"owner_id"`
+            Scope   string `json:"scope"`
+            // WorkspaceID binds the key to one workspace; 0 leaves it unbound
+            WorkspaceID int `json:"workspace_id"`
+        }
+        if r.ContentLength != 0 {
+            if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+                http.Error(w, "Invalid request body", http.StatusBadRequest)
+                return
+            }
+        }
+        if req.OwnerID == "" {
+            req.OwnerID = req.Name
+        }
+        if req.OwnerID == "" {
+            http.Error(w, "owner_id or name is required", http.StatusBadRequest)
+            return
+        }
+        if req.Scope == "" {
+            req.Scope = models.ScopeUser
+        }
+        if req.Scope != models.ScopeUser && req.Scope != models.ScopeAdmin {
+            http.Error(w, "scope must be \"user\" or \"admin\"", http.StatusBadRequest)
+            return
+        }
+
+        key, secret, err := service.CreateAPIKey(db, req.Name, req.OwnerID, req.Scope, req.WorkspaceID)
+        if err != nil {
+            http.Error(w, "Failed to create key", http.StatusInternalServerError)
+            return
+        }
+
+        writeJSON(w, http.StatusCreated, newKeyResponse(key, secret))
+    })
+}
+
+// ListKeysHandler handles GET /api/v1/keys
+func ListKeysHandler(db *sql.DB) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        keys, err := service.ListAPIKeys(db)
+        if err != nil {
+            http.Error(w, "Failed to list keys", http.StatusInternalServerError)
+            return
+        }
+
+        resp := make([]keyResponse, 0, len(keys))
+        for _, k := range keys {
+            resp = append(resp, newKeyResponse(k, ""))
+        }
+        writeJSON(w, http.StatusOK, resp)
+    })
+}
+
+// RevokeKeyHandler handles DELETE /api/v1/keys/{id}
+func RevokeKeyHandler(db *sql.DB) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        id, err := strconv.Atoi(r.PathValue("id"))
+        if err != nil {
+            http.Error(w, "Invalid key id", http.StatusBadRequest)
+            return
+        }
+
+        if err := service.RevokeAPIKey(db, id); err != nil {
+            if errors.Is(err, service.ErrNotFound) {
+                http.NotFound(w, r)
+                return
+            }
+            http.Error(w, "Failed to revoke key", http.StatusInternalServerError)
+            return
+        }
+
+        w.WriteHeader(http.StatusNoContent)
+    })
+}
+
+// RotateKeyHandler handles POST /api/v1/keys/{id}/rotate. The old key stays
+// valid for the configured overlap, which the request body may override.
+func RotateKeyHandler(db *sql.DB, overlap time.Duration) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        id, err := strconv.Atoi(r.PathValue("id"))
+        if err != nil {
+            http.Error(w, "Invalid key id", http.StatusBadRequest)
+            return
+        }
+
+        var req struct {
+            Overlap string `json:"overlap"`
+        }
+        if r.ContentLength != 0 {
+            if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+                http.Error(w, "Invalid request body", http.StatusBadRequest)
+                return
+            }
+        }
+        window := overlap
+        if req.Overlap != "" {
+            d, err := time.ParseDuration(req.Overlap)
+            if err != nil || d < 0 {
+                http.Error(w, "Invalid overlap duration", http.StatusBadRequest)
+                return
+            }
+            window = d
+        }
+
+        key, secret, err := service.RotateAPIKey(db, id, window)
+        if err != nil {
+            if errors.Is(err, service.ErrNotFound) {
+                http.NotFound(w, r)
+                return
+            }
+            if errors.Is(err, service.ErrKeyInactive) {
+                http.Error(w, err.Error(), http.StatusConflict)
+                return
+            }
+            http.Error(w, "Failed to rotate key", http.StatusInternalServerError)
+            return
+        }
+
+        writeJSON(w, http.StatusCreated, newKeyResponse(key, secret))
+    })
+}
+
+// writeJSON encodes v as the JSON response body with the given status.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,208 @@
+package api
+
+import (
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/valorm/snapurl/internal/blocklist"
+    "github.com/valorm/snapurl/internal/config"
+    "github.com/valorm/snapurl/internal/models"
+    "github.com/valorm/snapurl/internal/service"
+)
+
+const maxListLimit = 1000
+
+// linkResponse is the JSON representation of a link.
+type linkResponse struct {
+    Shortcode   string     `json:"shortcode"`
+    TargetURL   string     `json:"target_url"`
+    CreatedAt   time.Time  `json:"created_at"`
+    ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+    Hits        int        `json:"hits"`
+    Revoked     bool       `json:"revoked"`
+    OwnerID     string     `json:"owner_id,omitempty"`
+    WorkspaceID int        `json:"workspace_id"`
+
+    RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+    RevokedReason string     `json:"revoked_reason,omitempty"`
+    RevokedBy     string     `json:"revoked_by,omitempty"`
+    ReasonPublic  bool       `json:"reason_public,omitempty"`
+}
+
+func newLinkResponse(l models.Link) linkResponse {
+    resp := linkResponse{
+        Shortcode:   l.Shortcode,
+        TargetURL:   l.TargetURL,
+        CreatedAt:   l.CreatedAt,
+        Hits:        l.Hits,
+        Revoked:     l.Revoked,
+        OwnerID:     l.OwnerID,
+        WorkspaceID: l.WorkspaceID,
+
+        RevokedReason: l.RevokedReason,
+        RevokedBy:     l.RevokedBy,
+        ReasonPublic:  l.ReasonPublic,
+    }
+    if l.ExpiresAt.Valid {
+        resp.ExpiresAt = &l.ExpiresAt.Time
+    }
+    if l.RevokedAt.Valid {
+        resp.RevokedAt = &l.RevokedAt.Time
+    }
+    return resp
+}
+
+// ListLinksHandler handles GET /api/v1/links, scoped as described at
+// scopeFilter and paginated with ?limit= and ?offset=.
+func ListLinksHandler(db *sql.DB) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        q := r.URL.Query()
+        filter, err := scopeFilter(db, r)
+        if err != nil {
+            writeWorkspaceError(w, err)
+            return
+        }
+        if v := q.Get("limit"); v != "" {
+            n, err := strconv.Atoi(v)
+            if err != nil || n <= 0 || n > maxListLimit {
+                http.Error(w, "Invalid limit", http.StatusBadRequest)
+                return
+            }
+            filter.Limit = n
+        }
+        if v := q.Get("offset"); v != "" {
+            n, err := strconv.Atoi(v)
+            if err != nil || n < 0 {
+                http.Error(w, "Invalid offset", http.StatusBadRequest)
+                return
+            }
+            filter.Offset = n
+        }
+
+        links, err := service.ListLinks(db, filter)
+        if err != nil {
+            http.Error(w, "Failed to list links", http.StatusInternalServerError)
+            return
+        }
+
+        resp := make([]linkResponse, 0, len(links))
+        for _, l := range links {
+            resp = append(resp, newLinkResponse(l))
+        }
+        writeJSON(w, http.StatusOK, resp)
+    })
+}
+
+// scopeFilter restricts link listings: admin keys see every link and may
+// filter with ?owner=, other keys only see their own. Keys bound to a
+// workspace only see that workspace; others may filter with ?workspace=.
+func scopeFilter(db *sql.DB, r *http.Request) (service.ListLinksFilter, error) {
+    q := r.URL.Query()
+    filter := service.ListLinksFilter{OwnerID: ownerScope(r)}
+    if filter.OwnerID == "" {
+        filter.OwnerID = q.Get("owner")
+    }
+    key, _ := APIKeyFromContext(r.Context())
+    filter.WorkspaceID = key.WorkspaceID
+    if q.Get("workspace") != "" {
+        id, err := requestWorkspace(db, r)
+        if err != nil {
+            return service.ListLinksFilter{}, err
+        }
+        filter.WorkspaceID = id
+    }
+    return filter, nil
+}
+
+// GetLinkHandler handles GET /api/v1/links/{code}
+func GetLinkHandler(db *sql.DB) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        workspaceID, err := requestWorkspace(db, r)
+        if err != nil {
+            writeWorkspaceError(w, err)
+            return
+        }
+
+        link, err := service.GetLink(db, workspaceID, r.PathValue("code"), ownerScope(r))
+        if err != nil {
+            if errors.Is(err, service.ErrNotFound) {
+                http.NotFound(w, r)
+                return
+            }
+            http.Error(w, "Failed to fetch link", http.StatusInternalServerError)
+            return
+        }
+        writeJSON(w, http.StatusOK, newLinkResponse(link))
+    })
+}
+
+// UpdateLinkHandler handles PATCH /api/v1/links/{code}. A new url goes
+// through the same checks as POST /shorten.
+func UpdateLinkHandler(db *sql.DB, cfg *config.Config, bl *blocklist.List, exp *service.Expander) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        var req struct {
+            URL         *string    `json:"url"`
+            Expiry      *time.Time `json:"expiry"`
+            ClearExpiry bool       `json:"clear_expiry"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+            http.Error(w, "Invalid request body", http.StatusBadRequest)
+            return
+        }
+        if req.URL != nil {
+            target, ok := checkTarget(w, r, db, cfg, bl, exp, *req.URL)
+            if !ok {
+                return
+            }
+            req.URL = &target
+        }
+
+        upd := service.LinkUpdate{
+            TargetURL:   req.URL,
+            Expiry:      req.Expiry,
+            ClearExpiry: req.ClearExpiry,
+        }
+        workspaceID, err := requestWorkspace(db, r)
+        if err != nil {
+            writeWorkspaceError(w, err)
+            return
+        }
+
+        link, err := service.UpdateLink(db, workspaceID, r.PathValue("code"), ownerScope(r), upd)
+        if err != nil {
+            if errors.Is(err, service.ErrNotFound) {
+                http.NotFound(w, r)
+                return
+            }
+            http.Error(w, "Failed to update link", http.StatusInternalServerError)
+            return
+        }
+        writeJSON(w, http.StatusOK, newLinkResponse(link))
+    })
+}
+
+// DeleteLinkHandler handles DELETE /api/v1/admin/links/{code}, removing a
+// link instead of revoking it.
+func DeleteLinkHandler(db *sql.DB) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        workspaceID, err := requestWorkspace(db, r)
+        if err != nil {
+            writeWorkspaceError(w, err)
+            return
+        }
+
+        if err := service.DeleteLink(db, workspaceID, r.PathValue("code")); err != nil {
+            if errors.Is(err, service.ErrNotFound) {
+                http.NotFound(w, r)
+                return
+            }
+            http.Error(w, "Failed to delete link", http.StatusInternalServerError)
+            return
+        }
+        w.WriteHeader(http.StatusNoContent)
+    })
+}
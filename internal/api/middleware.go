@@ -1,33 +1,130 @@
 package api
 
 import (
+    "context"
+    "database/sql"
     "log"
     "net/http"
+    "strconv"
 
     "github.com/valorm/snapurl/internal/config"
+    "github.com/valorm/snapurl/internal/logging"
+    "github.com/valorm/snapurl/internal/models"
+    "github.com/valorm/snapurl/internal/service"
 )
 
-// LoggingMiddleware logs each request start and end.
+type ctxKey int
+
+const apiKeyCtxKey ctxKey = iota
+
+// LoggingMiddleware logs each request start and end at info level.
 func LoggingMiddleware(next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        log.Printf("Started %s %s", r.Method, r.URL.Path)
+        logging.Infof("Started %s %s", r.Method, r.URL.Path)
         next.ServeHTTP(w, r)
-        log.Printf("Completed %s %s", r.Method, r.URL.Path)
+        logging.Infof("Completed %s %s", r.Method, r.URL.Path)
     })
 }
 
-// AuthMiddleware enforces X-API-Key for protected routes.
-func AuthMiddleware(cfg *config.Config, next http.Handler) http.Handler {
+// configKeyOwner owns links created with keys from the config file.
+const configKeyOwner = "admin"
+
+// authenticate resolves the X-API-Key header. Keys from the config file are
+// admin keys; anything else is checked against the api_keys table.
+func authenticate(cfg *config.Config, db *sql.DB, apiKey string) (models.APIKey, bool) {
+    if contains(cfg.APIKeys, apiKey) {
+        return models.APIKey{Name: "config", OwnerID: configKeyOwner, Scope: models.ScopeAdmin}, true
+    }
+    key, err := service.AuthenticateAPIKey(db, apiKey)
+    if err != nil {
+        return models.APIKey{}, false
+    }
+    return key, true
+}
+
+// AuthMiddleware enforces X-API-Key for protected routes. The authenticated
+// key is stored in the request context.
+func AuthMiddleware(cfg *config.Config, db *sql.DB, next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
         apiKey := r.Header.Get("X-API-Key")
-        if !contains(cfg.APIKeys, apiKey) {
+        if apiKey == "" {
             http.Error(w, "Unauthorized", http.StatusUnauthorized)
             return
         }
+        key, ok := authenticate(cfg, db, apiKey)
+        if !ok {
+            http.Error(w, "Unauthorized", http.StatusUnauthorized)
+            return
+        }
+
+        ctx := context.WithValue(r.Context(), apiKeyCtxKey, key)
+        next.ServeHTTP(w, r.WithContext(ctx))
+    })
+}
+
+// OptionalAuthMiddleware is AuthMiddleware for public routes: requests
+// without X-API-Key pass through anonymously, invalid keys are rejected.
+func OptionalAuthMiddleware(cfg *config.Config, db *sql.DB, next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Header.Get("X-API-Key") == "" {
+            next.ServeHTTP(w, r)
+            return
+        }
+        AuthMiddleware(cfg, db, next).ServeHTTP(w, r)
+    })
+}
+
+// AdminMiddleware rejects keys without admin scope. It must run after
+// AuthMiddleware.
+func AdminMiddleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        key, ok := APIKeyFromContext(r.Context())
+        if !ok || key.Scope != models.ScopeAdmin {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
         next.ServeHTTP(w, r)
     })
 }
 
+// APIKeyFromContext returns the key that authenticated the request, if any.
+func APIKeyFromContext(ctx context.Context) (models.APIKey, bool) {
+    key, ok := ctx.Value(apiKeyCtxKey).(models.APIKey)
+    return key, ok
+}
+
+// keyActor identifies the key that authenticated r in audit fields:
+// "key:<id>" with the id of the first key of its rotation chain, so a
+// rotated key is still the same actor, or the key name for keys from the
+// config file.
+func keyActor(db *sql.DB, r *http.Request) (string, error) {
+    key, _ := APIKeyFromContext(r.Context())
+    if key.ID == 0 {
+        return key.Name, nil
+    }
+    id, err := service.OriginalAPIKeyID(db, key.ID)
+    if err != nil {
+        return "", err
+    }
+    return "key:" + strconv.Itoa(id), nil
+}
+
+// noOwner is an owner id that no link can have.
+const noOwner = "\x00"
+
+// ownerScope returns the owner that link operations must be restricted to
+// for this request, or "" when the key has admin scope.
+func ownerScope(r *http.Request) string {
+    key, ok := APIKeyFromContext(r.Context())
+    if ok && key.Scope == models.ScopeAdmin {
+        return ""
+    }
+    if !ok || key.OwnerID == "" {
+        return noOwner
+    }
+    return key.OwnerID
+}
+
 // RecoveryMiddleware recovers from panics and returns 500.
 func RecoveryMiddleware(next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,120 @@
+package api
+
+import (
+    "net/http"
+    "net/http/pprof"
+
+    "github.com/valorm/snapurl/internal/blocklist"
+    "github.com/valorm/snapurl/internal/config"
+    "github.com/valorm/snapurl/internal/datastore"
+    "github.com/valorm/snapurl/internal/service"
+)
+
+// NewRouter registers all endpoints on a method-aware ServeMux, for a
+// server with a single listener and for snapurlctl's local mode.
+// GET patterns also match HEAD requests. bl may be nil when no blocklist
+// is configured, and hits nil to count redirects synchronously; the server
+// passes one counter shared by the routers of every reload. Handlers that
+// only read use the read pool of store; everything else goes through its
+// writer.
+func NewRouter(cfg *config.Config, store *datastore.DB, bl *blocklist.List, hits *service.HitCounter) *http.ServeMux {
+    exp := newExpander(cfg)
+    mux := http.NewServeMux()
+    registerPublic(mux, cfg, store, bl, hits, exp, true)
+    registerAdmin(mux, cfg, store, bl, exp)
+    return mux
+}
+
+// NewPublicRouter serves the public listener when cfg.AdminAddr is set:
+// redirects, QR codes and, with cfg.PublicShorten, link creation.
+func NewPublicRouter(cfg *config.Config, store *datastore.DB, bl *blocklist.List, hits *service.HitCounter) *http.ServeMux {
+    mux := http.NewServeMux()
+    registerPublic(mux, cfg, store, bl, hits, newExpander(cfg), cfg.PublicShorten)
+    return mux
+}
+
+// NewAdminRouter serves the admin listener: health, metrics, pprof,
+// link creation and the management API. The API keeps requiring keys and
+// pprof needs an admin key, as the listener may be reachable from outside.
+func NewAdminRouter(cfg *config.Config, store *datastore.DB, bl *blocklist.List) *http.ServeMux {
+    exp := newExpander(cfg)
+    mux := http.NewServeMux()
+    registerShorten(mux, cfg, store, bl, exp)
+    registerAdmin(mux, cfg, store, bl, exp)
+
+    admin := func(h http.HandlerFunc) http.Handler {
+        return AuthMiddleware(cfg, store.Read, AdminMiddleware(h))
+    }
+    mux.Handle("GET /debug/pprof/", admin(pprof.Index))
+    mux.Handle("GET /debug/pprof/cmdline", admin(pprof.Cmdline))
+    mux.Handle("GET /debug/pprof/profile", admin(pprof.Profile))
+    mux.Handle("GET /debug/pprof/symbol", admin(pprof.Symbol))
+    mux.Handle("POST /debug/pprof/symbol", admin(pprof.Symbol))
+    mux.Handle("GET /debug/pprof/trace", admin(pprof.Trace))
+    return mux
+}
+
+// registerPublic adds the endpoints used by visitors of short links.
+func registerPublic(mux *http.ServeMux, cfg *config.Config, store *datastore.DB, bl *blocklist.List, hits *service.HitCounter, exp *service.Expander, shorten bool) {
+    if shorten {
+        registerShorten(mux, cfg, store, bl, exp)
+    }
+    mux.Handle("GET /{code}", RedirectHandler(store.Write, store.Read, hits, cfg, bl))
+    mux.Handle("GET /{code}/qr", QRHandler(store.Read, cfg))
+}
+
+func registerShorten(mux *http.ServeMux, cfg *config.Config, store *datastore.DB, bl *blocklist.List, exp *service.Expander) {
+    db, rdb := store.Write, store.Read
+    mux.Handle("POST /shorten", OptionalAuthMiddleware(cfg, rdb,
+        IdempotencyMiddleware(db, cfg.IdempotencyWindow, ShortenHandler(db, cfg, bl, exp))))
+}
+
+// registerAdmin adds health, metrics and the management API.
+func registerAdmin(mux *http.ServeMux, cfg *config.Config, store *datastore.DB, bl *blocklist.List, exp *service.Expander) {
+    db, rdb := store.Write, store.Read
+    auth := func(h http.Handler) http.Handler {
+        return AuthMiddleware(cfg, rdb, h)
+    }
+    admin := func(h http.Handler) http.Handler {
+        return AuthMiddleware(cfg, rdb, AdminMiddleware(h))
+    }
+
+    mux.Handle("GET /health", HealthHandler())
+    mux.Handle("GET /metrics", MetricsHandler(rdb))
+
+    // Link management, restricted to the key's own links unless admin
+    mux.Handle("DELETE /{code}", auth(RevokeHandler(db)))
+    mux.Handle("GET /api/v1/links", auth(ListLinksHandler(rdb)))
+    mux.Handle("POST /api/v1/links:batch", auth(
+        IdempotencyMiddleware(db, cfg.IdempotencyWindow, BatchCreateHandler(db, cfg, bl, exp))))
+    mux.Handle("GET /api/v1/links:export", auth(ExportLinksHandler(rdb)))
+    mux.Handle("GET /api/v1/links/{code}", auth(GetLinkHandler(rdb)))
+    mux.Handle("PATCH /api/v1/links/{code}", auth(UpdateLinkHandler(db, cfg, bl, exp)))
+    mux.Handle("DELETE /api/v1/links/{code}", auth(RevokeHandler(db)))
+    mux.Handle("POST /api/v1/links/{code}/unrevoke", auth(UnrevokeHandler(db)))
+
+    // API key management (admin only)
+    mux.Handle("POST /api/v1/keys", admin(CreateKeyHandler(db)))
+    mux.Handle("GET /api/v1/keys", admin(ListKeysHandler(rdb)))
+    mux.Handle("DELETE /api/v1/keys/{id}", admin(RevokeKeyHandler(db)))
+    mux.Handle("POST /api/v1/keys/{id}/rotate", admin(RotateKeyHandler(db, cfg.KeyRotationOverlap)))
+
+    // Link import keeps the owners from the file (admin only)
+    mux.Handle("POST /api/v1/links:import", admin(ImportLinksHandler(db, cfg, bl, exp)))
+
+    // Hard deletion of links (admin only)
+    mux.Handle("DELETE /api/v1/admin/links/{code}", admin(DeleteLinkHandler(db)))
+
+    // Database maintenance (admin only)
+    mux.Handle("GET /api/v1/admin/backup", admin(BackupStreamHandler(rdb)))
+    mux.Handle("POST /api/v1/admin/backup", admin(BackupHandler(rdb, cfg)))
+    mux.Handle("POST /api/v1/admin/janitor", admin(JanitorHandler(db, cfg)))
+    mux.Handle("GET /api/v1/admin/doctor", admin(DoctorHandler(db)))
+    mux.Handle("POST /api/v1/admin/doctor", admin(DoctorHandler(db)))
+
+    // Workspace management (admin only)
+    mux.Handle("POST /api/v1/workspaces", admin(CreateWorkspaceHandler(db)))
+    mux.Handle("GET /api/v1/workspaces", admin(ListWorkspacesHandler(rdb)))
+    mux.Handle("POST /api/v1/workspaces/{id}/domains", admin(AddDomainHandler(db)))
+    mux.Handle("DELETE /api/v1/workspaces/{id}/domains/{host}", admin(RemoveDomainHandler(db)))
+}
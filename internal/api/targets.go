@@ -0,0 +1,88 @@
+package api
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/url"
+    "time"
+
+    "github.com/valorm/snapurl/internal/blocklist"
+    "github.com/valorm/snapurl/internal/config"
+    "github.com/valorm/snapurl/internal/service"
+)
+
+const defaultExpandTimeout = 5 * time.Second
+
+// newExpander builds the shortener expander described by cfg.
+func newExpander(cfg *config.Config) *service.Expander {
+    timeout := cfg.ExpandTimeout
+    if timeout <= 0 {
+        timeout = defaultExpandTimeout
+    }
+    return service.NewExpander(cfg.ShortenerDomains, cfg.ExpandShorteners, cfg.MaxRedirectDepth, cfg.ExpandResolver, timeout)
+}
+
+// checkTarget runs resolveTarget and writes the error response itself. It
+// returns the URL to store.
+func checkTarget(w http.ResponseWriter, r *http.Request, db *sql.DB, cfg *config.Config, bl *blocklist.List, exp *service.Expander, raw string) (string, bool) {
+    target, status, err := resolveTarget(r.Context(), db, cfg, bl, exp, raw)
+    if err != nil {
+        http.Error(w, err.Error(), status)
+        return "", false
+    }
+    return target, true
+}
+
+// resolveTarget validates a requested target URL, rejects loops back to
+// our own domains and chains through other shorteners (or expands them),
+// and applies the blocklist to both the requested and the final URL. On
+// error it also returns the HTTP status to answer with.
+func resolveTarget(ctx context.Context, db *sql.DB, cfg *config.Config, bl *blocklist.List, exp *service.Expander, raw string) (string, int, error) {
+    target, err := service.ValidateTargetURL(raw, cfg.AllowedSchemes, cfg.MaxURLLength)
+    if err != nil {
+        return "", http.StatusBadRequest, err
+    }
+    if isBlocked(bl, target) {
+        return "", http.StatusForbidden, errBlocked
+    }
+
+    final, err := exp.Resolve(ctx, target, ownHost(db, cfg))
+    switch {
+    case errors.Is(err, service.ErrExpandFailed):
+        return "", http.StatusBadGateway, err
+    case err != nil:
+        return "", http.StatusBadRequest, err
+    case final == target:
+        return target, 0, nil
+    }
+
+    // The expanded destination has to pass the same checks
+    final, err = service.ValidateTargetURL(final, cfg.AllowedSchemes, cfg.MaxURLLength)
+    if err != nil {
+        return "", http.StatusBadRequest, fmt.Errorf("expanded %w", err)
+    }
+    if isBlocked(bl, final) {
+        return "", http.StatusForbidden, errBlocked
+    }
+    return final, 0, nil
+}
+
+// ownHost returns a predicate matching the configured short domains: the
+// host of public_base_url and every workspace domain.
+func ownHost(db *sql.DB, cfg *config.Config) func(string) bool {
+    var base string
+    if u, err := url.Parse(cfg.PublicBaseURL); err == nil {
+        base = service.NormalizeHost(u.Host)
+    }
+    return func(host string) bool {
+        host = service.NormalizeHost(host)
+        if host == base && base != "" {
+            return true
+        }
+        _, err := service.LookupWorkspaceDomain(db, host)
+        return err == nil
+    }
+}
@@ -0,0 +1,421 @@
+package api
+
+import (
+    "database/sql"
+    "encoding/csv"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/valorm/snapurl/internal/blocklist"
+    "github.com/valorm/snapurl/internal/config"
+    "github.com/valorm/snapurl/internal/models"
+    "github.com/valorm/snapurl/internal/service"
+)
+
+const (
+    formatCSV    = "csv"
+    formatNDJSON = "ndjson"
+
+    // maxImportErrors caps the per-record errors listed in an import report.
+    maxImportErrors = 100
+)
+
+// maxImportBytes bounds the body of an import.
+var maxImportBytes int64 = 64 << 20
+
+// csvColumns is the header of CSV exports and imports.
+var csvColumns = []string{"shortcode", "target_url", "workspace_id", "owner_id", "created_at", "expires_at", "hits", "revoked", "revoked_at", "revoked_reason", "revoked_by", "reason_public"}
+
+// transferFormat picks csv or ndjson from ?format=, else from the
+// Content-Type of an upload; the default is ndjson.
+func transferFormat(r *http.Request) (string, error) {
+    switch f := r.URL.Query().Get("format"); f {
+    case formatCSV, formatNDJSON:
+        return f, nil
+    case "":
+        if strings.Contains(r.Header.Get("Content-Type"), "csv") {
+            return formatCSV, nil
+        }
+        return formatNDJSON, nil
+    default:
+        return "", fmt.Errorf("unknown format %q", f)
+    }
+}
+
+// ExportLinksHandler handles GET /api/v1/links:export, streaming every link
+// visible to the key (see scopeFilter) as CSV or NDJSON, oldest first.
+func ExportLinksHandler(db *sql.DB) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        format, err := transferFormat(r)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        filter, err := scopeFilter(db, r)
+        if err != nil {
+            writeWorkspaceError(w, err)
+            return
+        }
+
+        filename := "links-" + time.Now().UTC().Format("20060102-150405") + "." + format
+        w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+        var write func(models.Link) error
+        var flush func()
+        if format == formatCSV {
+            w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+            cw := csv.NewWriter(w)
+            cw.Write(csvColumns)
+            write = func(l models.Link) error { return cw.Write(csvRecord(l)) }
+            flush = cw.Flush
+        } else {
+            w.Header().Set("Content-Type", "application/x-ndjson")
+            enc := json.NewEncoder(w)
+            write = func(l models.Link) error { return enc.Encode(newLinkResponse(l)) }
+            flush = func() {}
+        }
+
+        err = service.ExportLinks(db, filter, write)
+        flush()
+        if err != nil {
+            // Headers are gone; all we can do is cut the stream short
+            log.Printf("export links: %v", err)
+        }
+    })
+}
+
+func csvRecord(l models.Link) []string {
+    var expires, revokedAt string
+    if l.ExpiresAt.Valid {
+        expires = l.ExpiresAt.Time.UTC().Format(time.RFC3339)
+    }
+    if l.RevokedAt.Valid {
+        revokedAt = l.RevokedAt.Time.UTC().Format(time.RFC3339)
+    }
+    return []string{
+        l.Shortcode,
+        l.TargetURL,
+        strconv.Itoa(l.WorkspaceID),
+        l.OwnerID,
+        l.CreatedAt.UTC().Format(time.RFC3339),
+        expires,
+        strconv.Itoa(l.Hits),
+        strconv.FormatBool(l.Revoked),
+        revokedAt,
+        l.RevokedReason,
+        l.RevokedBy,
+        strconv.FormatBool(l.ReasonPublic),
+    }
+}
+
+// importError describes a record that was not imported.
+type importError struct {
+    Record int    `json:"record"`
+    Error  string `json:"error"`
+}
+
+// importReport is the response of an import.
+type importReport struct {
+    DryRun      bool          `json:"dry_run"`
+    Created     int           `json:"created"`
+    Overwritten int           `json:"overwritten"`
+    Skipped     int           `json:"skipped"`
+    Invalid     int           `json:"invalid"`
+    Errors      []importError `json:"errors"`
+}
+
+// ImportLinksHandler handles POST /api/v1/links:import. The body uses the
+// export formats; shortcodes, owners, hits, timestamps and revocation
+// details are kept. Target URLs go through validation, the blocklist and
+// the loop and chain checks of POST /shorten, and invalid records are
+// reported and skipped. Links to other shorteners are rejected rather than
+// expanded, so an import makes no outbound requests. ?conflict= decides what
+// happens to codes that already exist (skip, overwrite or fail, the
+// default) and ?dry_run=true reports the outcome without storing anything.
+// The whole upload is read and validated before anything is written, then
+// stored in batches (see service.Importer) so other writes are not held up
+// by a large import.
+func ImportLinksHandler(db *sql.DB, cfg *config.Config, bl *blocklist.List, exp *service.Expander) http.Handler {
+    noExpand := *exp
+    noExpand.Expand = false
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        q := r.URL.Query()
+        format, err := transferFormat(r)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        conflict := q.Get("conflict")
+        if conflict == "" {
+            conflict = service.ConflictFail
+        }
+        report := importReport{Errors: []importError{}}
+        if v := q.Get("dry_run"); v != "" {
+            if report.DryRun, err = strconv.ParseBool(v); err != nil {
+                http.Error(w, "Invalid dry_run", http.StatusBadRequest)
+                return
+            }
+        }
+        r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+        reject := func(record int, err error) {
+            report.Invalid++
+            if len(report.Errors) < maxImportErrors {
+                report.Errors = append(report.Errors, importError{Record: record, Error: err.Error()})
+            }
+        }
+
+        // 1) Read and validate every record
+        type importRecord struct {
+            n    int
+            link models.Link
+        }
+        var records []importRecord
+        seen := map[string]bool{}
+        isOwn := ownHost(db, cfg)
+        err = readImport(format, r.Body, func(record int, link models.Link, parseErr error) error {
+            if parseErr != nil {
+                reject(record, parseErr)
+                return nil
+            }
+            target, err := service.ValidateTargetURL(link.TargetURL, cfg.AllowedSchemes, cfg.MaxURLLength)
+            if err != nil {
+                reject(record, err)
+                return nil
+            }
+            if isBlocked(bl, target) {
+                reject(record, errBlocked)
+                return nil
+            }
+            if _, err := noExpand.Resolve(r.Context(), target, isOwn); err != nil {
+                reject(record, err)
+                return nil
+            }
+            link.TargetURL = target
+
+            key := strconv.Itoa(link.WorkspaceID) + "/" + link.Shortcode
+            if seen[key] {
+                reject(record, fmt.Errorf("shortcode %q appears earlier in the import", link.Shortcode))
+                return nil
+            }
+            seen[key] = true
+            records = append(records, importRecord{record, link})
+            return nil
+        })
+        var tooLarge *http.MaxBytesError
+        switch {
+        case errors.As(err, &tooLarge):
+            http.Error(w, fmt.Sprintf("Import exceeds %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+            return
+        case errors.Is(err, errMalformedImport):
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        case err != nil:
+            log.Printf("import links: %v", err)
+            http.Error(w, "Failed to import links", http.StatusInternalServerError)
+            return
+        }
+
+        // 2) Store them
+        im, err := service.BeginImport(db, conflict, report.DryRun)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        defer im.Rollback()
+
+        links := make([]models.Link, len(records))
+        for i, rec := range records {
+            links[i] = rec.link
+        }
+        err = im.CheckConflicts(links)
+        for i := 0; err == nil && i < len(records); i++ {
+            var outcome string
+            outcome, err = im.Add(records[i].link)
+            switch {
+            case errors.Is(err, service.ErrInvalidImport):
+                reject(records[i].n, err)
+                err = nil
+            case err != nil && !errors.Is(err, service.ErrImportConflict):
+                err = fmt.Errorf("record %d: %w", records[i].n, err)
+            }
+            switch outcome {
+            case service.ImportCreated:
+                report.Created++
+            case service.ImportOverwritten:
+                report.Overwritten++
+            case service.ImportSkipped:
+                report.Skipped++
+            }
+        }
+        if err == nil {
+            err = im.Commit()
+        }
+        switch {
+        case errors.Is(err, service.ErrImportConflict):
+            http.Error(w, err.Error(), http.StatusConflict)
+            return
+        case err != nil:
+            log.Printf("import links: %v", err)
+            http.Error(w, "Failed to import links", http.StatusInternalServerError)
+            return
+        }
+        writeJSON(w, http.StatusOK, report)
+    })
+}
+
+// errMalformedImport is returned when the upload cannot be read any further.
+var errMalformedImport = errors.New("malformed import")
+
+// readImport calls fn for every record of an upload, numbered from 1.
+// Records with bad fields are passed with a non-nil error; a body that
+// cannot be parsed any further stops the import with errMalformedImport.
+func readImport(format string, body io.Reader, fn func(record int, link models.Link, err error) error) error {
+    if format == formatNDJSON {
+        dec := json.NewDecoder(body)
+        for n := 1; ; n++ {
+            var rec struct {
+                Shortcode   string     `json:"shortcode"`
+                TargetURL   string     `json:"target_url"`
+                CreatedAt   time.Time  `json:"created_at"`
+                ExpiresAt   *time.Time `json:"expires_at"`
+                Hits        int        `json:"hits"`
+                Revoked     bool       `json:"revoked"`
+                OwnerID     string     `json:"owner_id"`
+                WorkspaceID int        `json:"workspace_id"`
+
+                RevokedAt     *time.Time `json:"revoked_at"`
+                RevokedReason string     `json:"revoked_reason"`
+                RevokedBy     string     `json:"revoked_by"`
+                ReasonPublic  bool       `json:"reason_public"`
+            }
+            if err := dec.Decode(&rec); err == io.EOF {
+                return nil
+            } else if err != nil {
+                return fmt.Errorf("%w: record %d: %w", errMalformedImport, n, err)
+            }
+            link := models.Link{
+                Shortcode:   rec.Shortcode,
+                TargetURL:   rec.TargetURL,
+                CreatedAt:   rec.CreatedAt,
+                Hits:        rec.Hits,
+                Revoked:     rec.Revoked,
+                OwnerID:     rec.OwnerID,
+                WorkspaceID: rec.WorkspaceID,
+
+                RevokedReason: rec.RevokedReason,
+                RevokedBy:     rec.RevokedBy,
+                ReasonPublic:  rec.ReasonPublic,
+            }
+            if rec.ExpiresAt != nil {
+                link.ExpiresAt = sql.NullTime{Time: *rec.ExpiresAt, Valid: true}
+            }
+            if rec.RevokedAt != nil {
+                link.RevokedAt = sql.NullTime{Time: *rec.RevokedAt, Valid: true}
+            }
+            var err error
+            if rec.Hits < 0 {
+                err = fmt.Errorf("invalid hits %d", rec.Hits)
+            }
+            if err := fn(n, link, err); err != nil {
+                return err
+            }
+        }
+    }
+
+    cr := csv.NewReader(body)
+    cr.FieldsPerRecord = -1
+    header, err := cr.Read()
+    if err != nil {
+        return fmt.Errorf("%w: header: %w", errMalformedImport, err)
+    }
+    cols := map[string]int{}
+    for i, name := range header {
+        cols[strings.TrimSpace(name)] = i
+    }
+    for _, required := range []string{"shortcode", "target_url"} {
+        if _, ok := cols[required]; !ok {
+            return fmt.Errorf("%w: missing column %q", errMalformedImport, required)
+        }
+    }
+
+    for n := 1; ; n++ {
+        row, err := cr.Read()
+        if err == io.EOF {
+            return nil
+        }
+        if err != nil {
+            return fmt.Errorf("%w: record %d: %w", errMalformedImport, n, err)
+        }
+        link, err := parseCSVRecord(cols, row)
+        if err := fn(n, link, err); err != nil {
+            return err
+        }
+    }
+}
+
+func parseCSVRecord(cols map[string]int, row []string) (models.Link, error) {
+    field := func(name string) string {
+        if i, ok := cols[name]; ok && i < len(row) {
+            return strings.TrimSpace(row[i])
+        }
+        return ""
+    }
+
+    link := models.Link{
+        Shortcode: field("shortcode"),
+        TargetURL: field("target_url"),
+        OwnerID:   field("owner_id"),
+
+        RevokedReason: field("revoked_reason"),
+        RevokedBy:     field("revoked_by"),
+    }
+    var err error
+    if v := field("workspace_id"); v != "" {
+        if link.WorkspaceID, err = strconv.Atoi(v); err != nil {
+            return link, fmt.Errorf("invalid workspace_id %q", v)
+        }
+    }
+    if v := field("created_at"); v != "" {
+        if link.CreatedAt, err = time.Parse(time.RFC3339, v); err != nil {
+            return link, fmt.Errorf("invalid created_at %q", v)
+        }
+    }
+    if v := field("expires_at"); v != "" {
+        t, err := time.Parse(time.RFC3339, v)
+        if err != nil {
+            return link, fmt.Errorf("invalid expires_at %q", v)
+        }
+        link.ExpiresAt = sql.NullTime{Time: t, Valid: true}
+    }
+    if v := field("hits"); v != "" {
+        if link.Hits, err = strconv.Atoi(v); err != nil || link.Hits < 0 {
+            return link, fmt.Errorf("invalid hits %q", v)
+        }
+    }
+    if v := field("revoked"); v != "" {
+        if link.Revoked, err = strconv.ParseBool(v); err != nil {
+            return link, fmt.Errorf("invalid revoked %q", v)
+        }
+    }
+    if v := field("revoked_at"); v != "" {
+        t, err := time.Parse(time.RFC3339, v)
+        if err != nil {
+            return link, fmt.Errorf("invalid revoked_at %q", v)
+        }
+        link.RevokedAt = sql.NullTime{Time: t, Valid: true}
+    }
+    if v := field("reason_public"); v != "" {
+        if link.ReasonPublic, err = strconv.ParseBool(v); err != nil {
+            return link, fmt.Errorf("invalid reason_public %q", v)
+        }
+    }
+    return link, nil
+}
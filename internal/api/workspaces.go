@@ -0,0 +1,240 @@
+package api
+
+import (
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/valorm/snapurl/internal/config"
+    "github.com/valorm/snapurl/internal/models"
+    "github.com/valorm/snapurl/internal/service"
+)
+
+var (
+    errWorkspaceMismatch = errors.New("key is bound to another workspace")
+    errInvalidWorkspace  = errors.New("invalid workspace")
+)
+
+// workspaceResponse is the JSON representation of a workspace.
+type workspaceResponse struct {
+    ID        int       `json:"id"`
+    Name      string    `json:"name"`
+    CreatedAt time.Time `json:"created_at"`
+    Domains   []string  `json:"domains"`
+}
+
+func newWorkspaceResponse(ws models.Workspace) workspaceResponse {
+    return workspaceResponse{ID: ws.ID, Name: ws.Name, CreatedAt: ws.CreatedAt, Domains: ws.Domains}
+}
+
+// requestWorkspace picks the workspace a management request acts on: the
+// key's workspace if it is bound to one, else ?workspace=, else the Host.
+func requestWorkspace(db *sql.DB, r *http.Request) (int, error) {
+    key, _ := APIKeyFromContext(r.Context())
+
+    if v := r.URL.Query().Get("workspace"); v != "" {
+        id, err := strconv.Atoi(v)
+        if err != nil || id <= 0 {
+            return 0, errInvalidWorkspace
+        }
+        if key.WorkspaceID != 0 && key.WorkspaceID != id {
+            return 0, errWorkspaceMismatch
+        }
+        return id, nil
+    }
+    if key.WorkspaceID != 0 {
+        return key.WorkspaceID, nil
+    }
+    return service.WorkspaceForHost(db, r.Host)
+}
+
+// creationWorkspace picks the workspace for a new link and the branded
+// host its short URL should use ("" for the default base URL). An explicit
+// domain wins over the request Host; keys bound to a workspace can only
+// create links there.
+func creationWorkspace(db *sql.DB, r *http.Request, domain string) (int, string, error) {
+    key, _ := APIKeyFromContext(r.Context())
+
+    if domain != "" {
+        id, err := service.LookupWorkspaceDomain(db, domain)
+        if err != nil {
+            return 0, "", err
+        }
+        if key.WorkspaceID != 0 && key.WorkspaceID != id {
+            return 0, "", errWorkspaceMismatch
+        }
+        return id, service.NormalizeHost(domain), nil
+    }
+
+    id, host := models.DefaultWorkspaceID, ""
+    if mapped, err := service.LookupWorkspaceDomain(db, r.Host); err == nil {
+        id, host = mapped, r.Host
+    } else if !errors.Is(err, service.ErrNotFound) {
+        return 0, "", err
+    }
+    if key.WorkspaceID == 0 || key.WorkspaceID == id {
+        return id, host, nil
+    }
+
+    // Bound key used on another host: link to the workspace's own domain
+    host, err := service.PrimaryDomain(db, key.WorkspaceID)
+    if err != nil {
+        return 0, "", err
+    }
+    return key.WorkspaceID, host, nil
+}
+
+// baseURL returns the scheme and host for short URLs. An empty host means
+// the workspace has no branded domain: public_base_url is used when set,
+// else the request's own host.
+func baseURL(cfg *config.Config, r *http.Request, host string) string {
+    scheme := requestScheme(r)
+    if cfg.PublicBaseURL != "" {
+        if host == "" {
+            return strings.TrimSuffix(cfg.PublicBaseURL, "/")
+        }
+        if u, err := url.Parse(cfg.PublicBaseURL); err == nil && u.Scheme != "" {
+            scheme = u.Scheme
+        }
+    }
+    if host == "" {
+        host = r.Host
+    }
+    return scheme + "://" + host
+}
+
+// writeWorkspaceError reports a failure from requestWorkspace or
+// creationWorkspace.
+func writeWorkspaceError(w http.ResponseWriter, err error) {
+    status, msg := workspaceErrorStatus(err)
+    http.Error(w, msg, status)
+}
+
+// workspaceErrorStatus maps a workspace lookup error to a status and message.
+func workspaceErrorStatus(err error) (int, string) {
+    switch {
+    case errors.Is(err, errWorkspaceMismatch):
+        return http.StatusForbidden, err.Error()
+    case errors.Is(err, errInvalidWorkspace):
+        return http.StatusBadRequest, err.Error()
+    case errors.Is(err, service.ErrNotFound):
+        return http.StatusBadRequest, "Unknown domain"
+    default:
+        return http.StatusInternalServerError, "Failed to resolve workspace"
+    }
+}
+
+// requestScheme returns the scheme the client used, honoring the
+// X-Forwarded-Proto header set by the reverse proxy.
+func requestScheme(r *http.Request) string {
+    if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+        return proto
+    }
+    if r.TLS != nil {
+        return "https"
+    }
+    return "http"
+}
+
+// CreateWorkspaceHandler handles POST /api/v1/workspaces
+func CreateWorkspaceHandler(db *sql.DB) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        var req struct {
+            Name    string   `json:"name"`
+            Domains []string `json:"domains"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+            http.Error(w, "Invalid request body", http.StatusBadRequest)
+            return
+        }
+
+        ws, err := service.CreateWorkspace(db, req.Name, req.Domains)
+        if err != nil {
+            if errors.Is(err, service.ErrDomainTaken) {
+                http.Error(w, err.Error(), http.StatusConflict)
+                return
+            }
+            http.Error(w, "Failed to create workspace", http.StatusInternalServerError)
+            return
+        }
+
+        writeJSON(w, http.StatusCreated, newWorkspaceResponse(ws))
+    })
+}
+
+// ListWorkspacesHandler handles GET /api/v1/workspaces
+func ListWorkspacesHandler(db *sql.DB) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        workspaces, err := service.ListWorkspaces(db)
+        if err != nil {
+            http.Error(w, "Failed to list workspaces", http.StatusInternalServerError)
+            return
+        }
+
+        resp := make([]workspaceResponse, 0, len(workspaces))
+        for _, ws := range workspaces {
+            resp = append(resp, newWorkspaceResponse(ws))
+        }
+        writeJSON(w, http.StatusOK, resp)
+    })
+}
+
+// AddDomainHandler handles POST /api/v1/workspaces/{id}/domains
+func AddDomainHandler(db *sql.DB) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        id, err := strconv.Atoi(r.PathValue("id"))
+        if err != nil {
+            http.Error(w, "Invalid workspace id", http.StatusBadRequest)
+            return
+        }
+        var req struct {
+            Host string `json:"host"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Host == "" {
+            http.Error(w, "Invalid request body", http.StatusBadRequest)
+            return
+        }
+
+        host, err := service.AddWorkspaceDomain(db, id, req.Host)
+        if err != nil {
+            switch {
+            case errors.Is(err, service.ErrNotFound):
+                http.NotFound(w, r)
+            case errors.Is(err, service.ErrDomainTaken):
+                http.Error(w, err.Error(), http.StatusConflict)
+            default:
+                http.Error(w, "Failed to add domain", http.StatusInternalServerError)
+            }
+            return
+        }
+
+        writeJSON(w, http.StatusCreated, map[string]string{"host": host})
+    })
+}
+
+// RemoveDomainHandler handles DELETE /api/v1/workspaces/{id}/domains/{host}
+func RemoveDomainHandler(db *sql.DB) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        id, err := strconv.Atoi(r.PathValue("id"))
+        if err != nil {
+            http.Error(w, "Invalid workspace id", http.StatusBadRequest)
+            return
+        }
+
+        if err := service.RemoveWorkspaceDomain(db, id, r.PathValue("host")); err != nil {
+            if errors.Is(err, service.ErrNotFound) {
+                http.NotFound(w, r)
+                return
+            }
+            http.Error(w, "Failed to remove domain", http.StatusInternalServerError)
+            return
+        }
+
+        w.WriteHeader(http.StatusNoContent)
+    })
+}
@@ -0,0 +1,185 @@
+package blocklist
+
+import (
+    "bufio"
+    "bytes"
+    "fmt"
+    "net/url"
+    "os"
+    "regexp"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/valorm/snapurl/internal/logging"
+)
+
+// Rule kinds, chosen by the syntax of a blocklist line:
+//
+//  evil.example           exact host
+//  .evil.example          the host and all its subdomains (also *.evil.example)
+//  https://x.example/p    exact URL
+//  re:^https?://[^/]*bit  regular expression matched against the whole URL
+const (
+    kindHost   = "host"
+    kindSuffix = "suffix"
+    kindURL    = "url"
+    kindRegexp = "regexp"
+)
+
+type rule struct {
+    kind  string
+    value string
+    re    *regexp.Regexp
+    line  string
+}
+
+// List is a set of blocklist rules loaded from a file. A nil *List blocks
+// nothing, so callers do not need to check whether one is configured.
+type List struct {
+    path string
+
+    mu      sync.RWMutex
+    rules   []rule
+    modTime time.Time
+}
+
+// Load reads the rules in path. Blank lines and lines starting with '#'
+// are ignored.
+func Load(path string) (*List, error) {
+    l := &List{path: path}
+    if err := l.load(); err != nil {
+        return nil, err
+    }
+    return l, nil
+}
+
+func (l *List) load() error {
+    info, err := os.Stat(l.path)
+    if err != nil {
+        return fmt.Errorf("stat blocklist: %w", err)
+    }
+    data, err := os.ReadFile(l.path)
+    if err != nil {
+        return fmt.Errorf("read blocklist: %w", err)
+    }
+    rules, err := parse(data)
+    if err != nil {
+        return fmt.Errorf("%s: %w", l.path, err)
+    }
+
+    l.mu.Lock()
+    l.rules = rules
+    l.modTime = info.ModTime()
+    l.mu.Unlock()
+    return nil
+}
+
+// parse reads blocklist rules, one per line.
+func parse(data []byte) ([]rule, error) {
+    var rules []rule
+    sc := bufio.NewScanner(bytes.NewReader(data))
+    for n := 1; sc.Scan(); n++ {
+        line := strings.TrimSpace(sc.Text())
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+
+        r := rule{line: line}
+        switch {
+        case strings.HasPrefix(line, "re:"):
+            re, err := regexp.Compile(strings.TrimPrefix(line, "re:"))
+            if err != nil {
+                return nil, fmt.Errorf("line %d: %w", n, err)
+            }
+            r.kind, r.re = kindRegexp, re
+        case strings.Contains(line, "://"):
+            r.kind, r.value = kindURL, line
+        case strings.HasPrefix(line, "*."), strings.HasPrefix(line, "."):
+            r.kind = kindSuffix
+            r.value = strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(line, "*"), "."))
+        default:
+            r.kind, r.value = kindHost, strings.ToLower(line)
+        }
+        rules = append(rules, r)
+    }
+    return rules, sc.Err()
+}
+
+// Match reports whether a URL is blocked and returns the rule that matched.
+func (l *List) Match(rawURL string) (string, bool) {
+    if l == nil {
+        return "", false
+    }
+
+    var host string
+    if u, err := url.Parse(rawURL); err == nil {
+        host = strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+    }
+
+    l.mu.RLock()
+    defer l.mu.RUnlock()
+    for _, r := range l.rules {
+        var hit bool
+        switch r.kind {
+        case kindHost:
+            hit = host == r.value
+        case kindSuffix:
+            hit = host == r.value || strings.HasSuffix(host, "."+r.value)
+        case kindURL:
+            hit = rawURL == r.value
+        case kindRegexp:
+            hit = r.re.MatchString(rawURL)
+        }
+        if hit {
+            return r.line, true
+        }
+    }
+    return "", false
+}
+
+// Len returns the number of loaded rules.
+func (l *List) Len() int {
+    if l == nil {
+        return 0
+    }
+    l.mu.RLock()
+    defer l.mu.RUnlock()
+    return len(l.rules)
+}
+
+// Reload rereads the file when its modification time changed. On error the
+// previous rules stay in effect.
+func (l *List) Reload() (bool, error) {
+    info, err := os.Stat(l.path)
+    if err != nil {
+        return false, fmt.Errorf("stat blocklist: %w", err)
+    }
+    l.mu.RLock()
+    unchanged := info.ModTime().Equal(l.modTime)
+    l.mu.RUnlock()
+    if unchanged {
+        return false, nil
+    }
+    return true, l.load()
+}
+
+// Watch polls the file every interval and reloads it on change until stop
+// is closed.
+func (l *List) Watch(interval time.Duration, stop <-chan struct{}) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-stop:
+            return
+        case <-ticker.C:
+            reloaded, err := l.Reload()
+            if err != nil {
+                logging.Warnf("blocklist: %v", err)
+            } else if reloaded {
+                logging.Infof("blocklist: reloaded %d rules from %s", l.Len(), l.path)
+            }
+        }
+    }
+}
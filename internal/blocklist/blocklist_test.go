@@ -0,0 +1,80 @@
+package blocklist
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+func TestMatch(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "blocklist.txt")
+    rules := `# phishing
+evil.example
+.phish.example
+https://good.example/login-verify
+re:^https?://[^/]*paypa1
+`
+    if err := os.WriteFile(path, []byte(rules), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    l, err := Load(path)
+    if err != nil {
+        t.Fatalf("Load: %v", err)
+    }
+
+    cases := map[string]bool{
+        "https://evil.example/x":            true,
+        "https://EVIL.example./x":           true,
+        "https://sub.evil.example/":         false,
+        "https://phish.example":             true,
+        "https://a.b.phish.example/":        true,
+        "https://notphish.example/":         false,
+        "https://good.example/login-verify": true,
+        "https://good.example/":             false,
+        "http://secure-paypa1.example/":     true,
+        "https://example.com/?r=paypa1":     false,
+    }
+    for u, want := range cases {
+        if _, got := l.Match(u); got != want {
+            t.Errorf("Match(%q): want %v, got %v", u, want, got)
+        }
+    }
+
+    var none *List
+    if _, blocked := none.Match("https://evil.example"); blocked {
+        t.Error("nil list should block nothing")
+    }
+}
+
+func TestReload(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "blocklist.txt")
+    os.WriteFile(path, []byte("evil.example\n"), 0o644)
+    l, err := Load(path)
+    if err != nil {
+        t.Fatalf("Load: %v", err)
+    }
+
+    if reloaded, err := l.Reload(); err != nil || reloaded {
+        t.Fatalf("unchanged file: reloaded=%v err=%v", reloaded, err)
+    }
+
+    os.WriteFile(path, []byte("evil.example\nworse.example\n"), 0o644)
+    os.Chtimes(path, time.Now(), time.Now().Add(time.Second))
+    if reloaded, err := l.Reload(); err != nil || !reloaded {
+        t.Fatalf("changed file: reloaded=%v err=%v", reloaded, err)
+    }
+    if _, blocked := l.Match("https://worse.example"); !blocked {
+        t.Error("new rule not applied after reload")
+    }
+
+    // A broken file keeps the previous rules
+    os.WriteFile(path, []byte("re:(\n"), 0o644)
+    os.Chtimes(path, time.Now(), time.Now().Add(2*time.Second))
+    if _, err := l.Reload(); err == nil {
+        t.Error("expected error for invalid regexp")
+    }
+    if l.Len() != 2 {
+        t.Errorf("rules after failed reload: want 2, got %d", l.Len())
+    }
+}
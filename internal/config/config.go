@@ -1,50 +1,127 @@
 // internal/config/config.go
 package config
 
-import (
-    "os"
-    "path/filepath"
-    "strconv"
-    "strings"
-
-    "gopkg.in/yaml.v3"
-)
+import "time"
 
+// Config holds every server option. The yaml tag of each field also names
+// its SNAPURL_* environment variable and command-line flag; see Load.
 type Config struct {
     Port      string   `yaml:"port"`
     DBPath    string   `yaml:"db_path"`
     RateLimit int      `yaml:"rate_limit"`
     APIKeys   []string `yaml:"api_keys"`
-}
 
-func LoadConfig() (*Config, error) {
-    cfg := &Config{}
-
-    // 1) Read YAML file
-    yamlPath := filepath.Join("config", "default.yaml")
-    data, err := os.ReadFile(yamlPath)
-    if err != nil {
-        return nil, err
-    }
-    if err := yaml.Unmarshal(data, cfg); err != nil {
-        return nil, err
-    }
-
-    // 2) Environment overrides
-    if port := os.Getenv("PORT"); port != "" {
-        cfg.Port = port
-    }
-    if dbPath := os.Getenv("DB_PATH"); dbPath != "" {
-        cfg.DBPath = dbPath
-    }
-    if rl := os.Getenv("RATE_LIMIT"); rl != "" {
-        if v, err := strconv.Atoi(rl); err == nil {
-            cfg.RateLimit = v
-        }
-    }
-    if keys := os.Getenv("API_KEYS"); keys != "" {
-        cfg.APIKeys = strings.Split(keys, ",")
-    }
-
-    return cfg, nil
+    // APIKeysFile, when set, names a file with one API key per line (e.g. a
+    // mounted Docker or Kubernetes secret) that replaces APIKeys.
+    APIKeysFile string `yaml:"api_keys_file"`
+
+    // PublicBaseURL is the scheme and host short URLs are built from, e.g.
+    // "https://sn.ap". Branded workspace domains keep their own host.
+    PublicBaseURL string `yaml:"public_base_url"`
+
+    // IdempotencyWindow is how long responses are remembered per
+    // Idempotency-Key; zero disables idempotency keys.
+    IdempotencyWindow time.Duration `yaml:"idempotency_window"`
+
+    // AllowedSchemes lists the URL schemes links may point to; empty means
+    // http and https.
+    AllowedSchemes []string `yaml:"allowed_schemes"`
+
+    // MaxURLLength caps the length of target URLs; zero means 2048.
+    MaxURLLength int `yaml:"max_url_length"`
+
+    // MaxBatchSize caps the links per POST /api/v1/links:batch; zero means
+    // 1000.
+    MaxBatchSize int `yaml:"max_batch_size"`
+
+    // ShortenerDomains are other URL shorteners. Links to them are rejected
+    // unless ExpandShorteners is set, in which case they are followed (at
+    // most MaxRedirectDepth hops, resolving hosts through ExpandResolver when
+    // set) and the final destination is stored instead.
+    ShortenerDomains []string      `yaml:"shortener_domains"`
+    ExpandShorteners bool          `yaml:"expand_shorteners"`
+    ExpandResolver   string        `yaml:"expand_resolver"`
+    ExpandTimeout    time.Duration `yaml:"expand_timeout"`
+    MaxRedirectDepth int           `yaml:"max_redirect_depth"`
+
+    // BlocklistPath is a file of blocked destinations; empty disables the
+    // blocklist. It is re-read every BlocklistReloadInterval when changed.
+    BlocklistPath           string        `yaml:"blocklist_path"`
+    BlocklistReloadInterval time.Duration `yaml:"blocklist_reload_interval"`
+
+    // BlocklistAction is what happens when an existing link turns out to be
+    // blocked at redirect time: "revoke" (default) or "warn", which shows an
+    // interstitial warning page instead of redirecting.
+    BlocklistAction string `yaml:"blocklist_action"`
+
+    // BackupDir receives backups made by POST /api/v1/admin/backup and, when
+    // BackupInterval is non-zero, scheduled ones; only the newest
+    // BackupRetention files are kept (zero keeps all).
+    BackupDir       string        `yaml:"backup_dir"`
+    BackupInterval  time.Duration `yaml:"backup_interval"`
+    BackupRetention int           `yaml:"backup_retention"`
+
+    // JanitorInterval is how often links that expired or were revoked more
+    // than JanitorRetentionDays ago are archived (JanitorMode "archive") or
+    // deleted ("delete"); zero, the default, disables the background
+    // janitor.
+    JanitorInterval      time.Duration `yaml:"janitor_interval"`
+    JanitorRetentionDays int           `yaml:"janitor_retention_days"`
+    JanitorMode          string        `yaml:"janitor_mode"`
+
+    // SQLite tuning. Writes go through a single connection, reads through
+    // a pool of up to DBMaxReadConns. Zero values mean WAL, NORMAL, a 5s
+    // busy timeout, SQLite's default cache, one reader per CPU and two idle
+    // readers kept open indefinitely.
+    DBJournalMode     string        `yaml:"db_journal_mode"`
+    DBSynchronous     string        `yaml:"db_synchronous"`
+    DBBusyTimeout     time.Duration `yaml:"db_busy_timeout"`
+    DBCacheSizeKB     int           `yaml:"db_cache_size_kb"`
+    DBMaxReadConns    int           `yaml:"db_max_read_conns"`
+    DBMaxIdleConns    int           `yaml:"db_max_idle_conns"`
+    DBConnMaxLifetime time.Duration `yaml:"db_conn_max_lifetime"`
+
+    // AutoMigrate applies pending migrations at startup (the default).
+    // When false the server refuses to start until the schema has been
+    // migrated with "snapurlctl migrate up".
+    AutoMigrate bool `yaml:"auto_migrate"`
+
+    // TLSCertFile and TLSKeyFile make the server listen with HTTPS on Port.
+    // The files are checked every TLSReloadInterval (zero disables this) and
+    // reloaded when they change. TLSMinVersion is "1.2" (default) or "1.3";
+    // TLSCipherSuites restricts the TLS 1.2 suites by their Go names.
+    TLSCertFile       string        `yaml:"tls_cert_file"`
+    TLSKeyFile        string        `yaml:"tls_key_file"`
+    TLSMinVersion     string        `yaml:"tls_min_version"`
+    TLSCipherSuites   []string      `yaml:"tls_cipher_suites"`
+    TLSReloadInterval time.Duration `yaml:"tls_reload_interval"`
+
+    // HTTPRedirectAddr, with TLS enabled, is a plain HTTP listener (e.g.
+    // ":80") that redirects every request to HTTPS.
+    HTTPRedirectAddr string `yaml:"http_redirect_addr"`
+
+    // HSTSMaxAge, when non-zero, sends Strict-Transport-Security on HTTPS
+    // responses, optionally covering subdomains and asking for preloading.
+    HSTSMaxAge            time.Duration `yaml:"hsts_max_age"`
+    HSTSIncludeSubdomains bool          `yaml:"hsts_include_subdomains"`
+    HSTSPreload           bool          `yaml:"hsts_preload"`
+
+    // AdminAddr, when set, moves health, metrics, pprof and the management
+    // API to a second listener: a TCP address such as "127.0.0.1:9090" or
+    // a Unix socket as "unix:/run/snapurl/admin.sock". Port then only serves
+    // redirects, QR codes and, with PublicShorten (the default), POST
+    // /shorten.
+    AdminAddr     string `yaml:"admin_addr"`
+    PublicShorten bool   `yaml:"public_shorten"`
+
+    // LogLevel is debug, info (default), warn or error.
+    LogLevel string `yaml:"log_level"`
+
+    // ConfigReloadInterval is how often the config files are checked for
+    // changes, which are then applied like on SIGHUP; zero disables it.
+    ConfigReloadInterval time.Duration `yaml:"config_reload_interval"`
+
+    // KeyRotationOverlap is how long a rotated API key keeps working
+    // alongside its replacement.
+    KeyRotationOverlap time.Duration `yaml:"key_rotation_overlap"`
 }
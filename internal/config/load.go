@@ -0,0 +1,340 @@
+package config
+
+import (
+    "errors"
+    "flag"
+    "fmt"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strconv"
+    "strings"
+    "time"
+
+    "gopkg.in/yaml.v3"
+)
+
+// DefaultPath is the config file read when neither -config nor
+// SNAPURL_CONFIG names one. Unlike a named file it may be missing, in which
+// case the built-in defaults, the environment and flags apply.
+var DefaultPath = filepath.Join("config", "default.yaml")
+
+// EnvPrefix starts the environment variable of every option: db_path is
+// read from SNAPURL_DB_PATH.
+const EnvPrefix = "SNAPURL_"
+
+// legacyEnv are the options that were read from unprefixed variables (PORT,
+// DB_PATH, RATE_LIMIT and API_KEYS) before EnvPrefix existed. Those names
+// still work when the prefixed variable is unset.
+var legacyEnv = map[string]bool{
+    "port": true, "db_path": true, "rate_limit": true, "api_keys": true,
+}
+
+// LoadConfig loads the configuration without command-line flags: the
+// config file and its environment overlay, then environment variables.
+func LoadConfig() (*Config, error) {
+    l, err := load("", "", nil)
+    if err != nil {
+        return nil, err
+    }
+    return l.cfg, nil
+}
+
+// Flags are the command-line flags of the configuration: -config, -env and
+// one flag per option, named after its yaml tag with dashes (-db-path).
+type Flags struct {
+    fs   *flag.FlagSet
+    path string
+    env  string
+    last *loaded
+}
+
+// NewFlags registers the configuration flags on fs. Call Load once fs has
+// been parsed.
+func NewFlags(fs *flag.FlagSet) *Flags {
+    f := &Flags{fs: fs}
+    fs.StringVar(&f.path, "config", "", "config `file` (env SNAPURL_CONFIG, default "+DefaultPath+")")
+    fs.StringVar(&f.env, "env", "", "environment `name`; <name>.yaml next to the config file overrides it (env SNAPURL_ENV)")
+    for _, o := range options() {
+        fs.Var(&optionFlag{opt: o}, o.flagName(), o.usage())
+    }
+    return f
+}
+
+// Load loads the configuration in layers, each overriding the one before:
+// built-in defaults, the config file, the environment overlay file,
+// environment variables and finally the flags that were set. Secrets named
+// by *_file options are read last.
+func (f *Flags) Load() (*Config, error) {
+    flags := map[string]string{}
+    f.fs.Visit(func(fl *flag.Flag) {
+        if of, ok := fl.Value.(*optionFlag); ok {
+            flags[of.opt.name] = of.raw
+        }
+    })
+    l, err := load(f.path, f.env, flags)
+    if err != nil {
+        return nil, err
+    }
+    f.last = l
+    return l.cfg, nil
+}
+
+// Files returns the config and secret files the last successful Load read
+// from, including a default config file that does not exist (yet).
+func (f *Flags) Files() []string {
+    if f.last == nil {
+        return nil
+    }
+    return f.last.files
+}
+
+// defaults are the built-in values, the same as config/default.yaml
+// except for its sample api_keys; TestDefaultsMatchFile keeps them in step.
+func defaults() *Config {
+    return &Config{
+        Port:              ":8080",
+        DBPath:            "/data/snapurl.db",
+        RateLimit:         100,
+        IdempotencyWindow: 24 * time.Hour,
+        AllowedSchemes:    []string{"http", "https"},
+        MaxURLLength:      2048,
+        MaxBatchSize:      1000,
+        ShortenerDomains: []string{
+            "bit.ly", "t.co", "tinyurl.com", "goo.gl", "ow.ly",
+            "is.gd", "buff.ly", "cutt.ly", "rebrand.ly", "shorturl.at",
+        },
+        ExpandTimeout:           5 * time.Second,
+        MaxRedirectDepth:        5,
+        BlocklistReloadInterval: 30 * time.Second,
+        BlocklistAction:         "revoke",
+        BackupDir:               "/data/backups",
+        BackupRetention:         7,
+        JanitorRetentionDays:    30,
+        JanitorMode:             "archive",
+        DBJournalMode:           "WAL",
+        DBSynchronous:           "NORMAL",
+        DBBusyTimeout:           5 * time.Second,
+        DBMaxIdleConns:          2,
+        AutoMigrate:             true,
+        TLSMinVersion:           "1.2",
+        TLSReloadInterval:       time.Minute,
+        PublicShorten:           true,
+        LogLevel:                "info",
+        ConfigReloadInterval:    30 * time.Second,
+        KeyRotationOverlap:      24 * time.Hour,
+    }
+}
+
+// loaded is the result of load: the configuration, the files it was read
+// from and, per option, where its value came from.
+type loaded struct {
+    cfg     *Config
+    files   []string
+    sources map[string]string
+}
+
+func load(path, env string, flags map[string]string) (*loaded, error) {
+    l := &loaded{cfg: defaults(), sources: map[string]string{}}
+
+    // 1) Config file, then the environment overlay next to it
+    if path == "" {
+        path = os.Getenv("SNAPURL_CONFIG")
+    }
+    required := path != ""
+    if !required {
+        path = DefaultPath
+    }
+    if err := l.readFile(path, required); err != nil {
+        return nil, err
+    }
+    l.files = append(l.files, path)
+    if env == "" {
+        env = os.Getenv("SNAPURL_ENV")
+    }
+    if env != "" {
+        overlay := filepath.Join(filepath.Dir(path), env+".yaml")
+        if err := l.readFile(overlay, true); err != nil {
+            return nil, err
+        }
+        l.files = append(l.files, overlay)
+    }
+
+    // 2) Environment overrides
+    for _, o := range options() {
+        name, raw := o.lookupEnv()
+        if raw == "" {
+            continue
+        }
+        if err := o.set(l.cfg, raw); err != nil {
+            return nil, fmt.Errorf("env %s: %w", name, err)
+        }
+        l.sources[o.name] = "env " + name
+    }
+
+    // 3) Command-line flags
+    for _, o := range options() {
+        raw, ok := flags[o.name]
+        if !ok {
+            continue
+        }
+        if err := o.set(l.cfg, raw); err != nil {
+            return nil, fmt.Errorf("flag -%s: %w", o.flagName(), err)
+        }
+        l.sources[o.name] = "flag -" + o.flagName()
+    }
+
+    // 4) Secrets kept in files of their own
+    if err := l.readSecretFiles(); err != nil {
+        return nil, err
+    }
+
+    return l, nil
+}
+
+// readFile merges the YAML file at path into the configuration. Missing
+// files are skipped unless required.
+func (l *loaded) readFile(path string, required bool) error {
+    data, err := os.ReadFile(path)
+    if errors.Is(err, os.ErrNotExist) && !required {
+        return nil
+    }
+    if err != nil {
+        return fmt.Errorf("read config: %w", err)
+    }
+    if err := yaml.Unmarshal(data, l.cfg); err != nil {
+        return fmt.Errorf("parse config %s: %w", path, err)
+    }
+    var keys map[string]yaml.Node
+    if err := yaml.Unmarshal(data, &keys); err != nil {
+        return fmt.Errorf("parse config %s: %w", path, err)
+    }
+    for name := range keys {
+        l.sources[name] = "file " + path
+    }
+    return nil
+}
+
+// option is a Config field, named by its yaml tag.
+type option struct {
+    name  string
+    index int
+    typ   reflect.Type
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func options() []option {
+    t := reflect.TypeOf(Config{})
+    var opts []option
+    for i := 0; i < t.NumField(); i++ {
+        f := t.Field(i)
+        name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+        if name == "" || name == "-" {
+            continue
+        }
+        opts = append(opts, option{name: name, index: i, typ: f.Type})
+    }
+    return opts
+}
+
+func (o option) envName() string {
+    return EnvPrefix + strings.ToUpper(o.name)
+}
+
+func (o option) flagName() string {
+    return strings.ReplaceAll(o.name, "_", "-")
+}
+
+// lookupEnv returns the variable the option is read from and its value,
+// preferring the prefixed name over a legacy one.
+func (o option) lookupEnv() (string, string) {
+    name := o.envName()
+    if v := os.Getenv(name); v != "" || !legacyEnv[o.name] {
+        return name, v
+    }
+    legacy := strings.ToUpper(o.name)
+    return legacy, os.Getenv(legacy)
+}
+
+func (o option) usage() string {
+    var kind string
+    switch {
+    case o.typ == durationType:
+        kind = ", a `duration`"
+    case o.typ.Kind() == reflect.Int:
+        kind = ", an `integer`"
+    case o.typ.Kind() == reflect.Slice:
+        kind = ", a comma-separated `list`"
+    case o.typ.Kind() == reflect.String:
+        kind = ", a `string`"
+    }
+    return fmt.Sprintf("sets %s%s (env %s)", o.name, kind, o.envName())
+}
+
+// set parses raw into the option's field of cfg.
+func (o option) set(cfg *Config, raw string) error {
+    v, err := parseValue(o.typ, raw)
+    if err != nil {
+        return err
+    }
+    reflect.ValueOf(cfg).Elem().Field(o.index).Set(v)
+    return nil
+}
+
+func parseValue(typ reflect.Type, raw string) (reflect.Value, error) {
+    switch {
+    case typ == durationType:
+        d, err := time.ParseDuration(raw)
+        if err != nil {
+            return reflect.Value{}, fmt.Errorf("invalid duration %q", raw)
+        }
+        return reflect.ValueOf(d), nil
+    case typ.Kind() == reflect.String:
+        return reflect.ValueOf(raw), nil
+    case typ.Kind() == reflect.Int:
+        n, err := strconv.Atoi(raw)
+        if err != nil {
+            return reflect.Value{}, fmt.Errorf("invalid integer %q", raw)
+        }
+        return reflect.ValueOf(n), nil
+    case typ.Kind() == reflect.Bool:
+        b, err := strconv.ParseBool(raw)
+        if err != nil {
+            return reflect.Value{}, fmt.Errorf("invalid boolean %q", raw)
+        }
+        return reflect.ValueOf(b), nil
+    case typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.String:
+        var list []string
+        for _, s := range strings.Split(raw, ",") {
+            if s = strings.TrimSpace(s); s != "" {
+                list = append(list, s)
+            }
+        }
+        return reflect.ValueOf(list), nil
+    }
+    return reflect.Value{}, fmt.Errorf("unsupported option type %s", typ)
+}
+
+// optionFlag is the flag.Value of an option. Values are checked when the
+// flag is parsed and applied by Load.
+type optionFlag struct {
+    opt option
+    raw string
+}
+
+func (f *optionFlag) String() string {
+    return f.raw
+}
+
+func (f *optionFlag) Set(s string) error {
+    if _, err := parseValue(f.opt.typ, s); err != nil {
+        return err
+    }
+    f.raw = s
+    return nil
+}
+
+func (f *optionFlag) IsBoolFlag() bool {
+    return f.opt.typ.Kind() == reflect.Bool
+}
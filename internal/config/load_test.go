@@ -0,0 +1,137 @@
+package config
+
+import (
+    "flag"
+    "io"
+    "os"
+    "path/filepath"
+    "reflect"
+    "testing"
+    "time"
+
+    "gopkg.in/yaml.v3"
+)
+
+func writeFile(t *testing.T, path, content string) {
+    t.Helper()
+    if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+        t.Fatalf("write %s: %v", path, err)
+    }
+}
+
+func TestLoadLayers(t *testing.T) {
+    dir := t.TempDir()
+    base := filepath.Join(dir, "snapurl.yaml")
+    writeFile(t, base, `
+port: ":8080"
+db_path: "/data/base.db"
+rate_limit: 100
+api_keys: ["base"]
+backup_interval: "1h"
+`)
+    writeFile(t, filepath.Join(dir, "production.yaml"), `
+db_path: "/data/production.db"
+rate_limit: 50
+`)
+
+    // Files: overlay beats base
+    t.Setenv("SNAPURL_CONFIG", base)
+    t.Setenv("SNAPURL_ENV", "production")
+    cfg, err := LoadConfig()
+    if err != nil {
+        t.Fatalf("LoadConfig: %v", err)
+    }
+    if cfg.Port != ":8080" || cfg.DBPath != "/data/production.db" || cfg.RateLimit != 50 || !cfg.AutoMigrate {
+        t.Fatalf("file layers: got %+v", cfg)
+    }
+
+    // Env: prefixed beats legacy beats files
+    t.Setenv("RATE_LIMIT", "20")
+    t.Setenv("SNAPURL_API_KEYS", "a, b")
+    t.Setenv("PORT", ":7000")
+    t.Setenv("SNAPURL_PORT", ":9000")
+    t.Setenv("SNAPURL_EXPAND_TIMEOUT", "3s")
+    t.Setenv("EXPAND_TIMEOUT", "1s") // never had a legacy name
+    if cfg, err = LoadConfig(); err != nil {
+        t.Fatalf("LoadConfig: %v", err)
+    }
+    if cfg.RateLimit != 20 || cfg.Port != ":9000" || cfg.ExpandTimeout != 3*time.Second ||
+        !reflect.DeepEqual(cfg.APIKeys, []string{"a", "b"}) {
+        t.Fatalf("env layer: got %+v", cfg)
+    }
+
+    // Flags beat everything, -config and -env beat their variables
+    other := filepath.Join(dir, "other.yaml")
+    writeFile(t, other, `db_path: "/data/other.db"`)
+    fs := flag.NewFlagSet("test", flag.ContinueOnError)
+    flags := NewFlags(fs)
+    err = fs.Parse([]string{"-config", other, "-env", "", "-rate-limit", "5",
+        "-auto-migrate=false", "-backup-interval", "10m"})
+    if err != nil {
+        t.Fatalf("parse flags: %v", err)
+    }
+    t.Setenv("SNAPURL_ENV", "")
+    if cfg, err = flags.Load(); err != nil {
+        t.Fatalf("Load: %v", err)
+    }
+    if cfg.DBPath != "/data/other.db" || cfg.RateLimit != 5 || cfg.AutoMigrate ||
+        cfg.BackupInterval != 10*time.Minute || cfg.Port != ":9000" {
+        t.Fatalf("flag layer: got %+v", cfg)
+    }
+}
+
+func TestLoadErrors(t *testing.T) {
+    dir := t.TempDir()
+
+    // A missing default file is fine, a named one is not
+    old := DefaultPath
+    DefaultPath = filepath.Join(dir, "missing.yaml")
+    defer func() { DefaultPath = old }()
+    if _, err := LoadConfig(); err != nil {
+        t.Fatalf("missing default file: %v", err)
+    }
+    t.Setenv("SNAPURL_CONFIG", filepath.Join(dir, "nope.yaml"))
+    if _, err := LoadConfig(); err == nil {
+        t.Fatal("missing named file: want error")
+    }
+    t.Setenv("SNAPURL_CONFIG", "")
+
+    // So is a missing overlay
+    t.Setenv("SNAPURL_ENV", "staging")
+    if _, err := LoadConfig(); err == nil {
+        t.Fatal("missing overlay: want error")
+    }
+    t.Setenv("SNAPURL_ENV", "")
+
+    // Invalid values are reported rather than ignored
+    t.Setenv("SNAPURL_BACKUP_INTERVAL", "soon")
+    if _, err := LoadConfig(); err == nil {
+        t.Fatal("invalid env duration: want error")
+    }
+    fs := flag.NewFlagSet("test", flag.ContinueOnError)
+    fs.SetOutput(io.Discard)
+    NewFlags(fs)
+    if err := fs.Parse([]string{"-rate-limit", "many"}); err == nil {
+        t.Fatal("invalid flag integer: want error")
+    }
+}
+
+func TestDefaultsMatchFile(t *testing.T) {
+    var file Config
+    data, err := os.ReadFile(filepath.Join("..", "..", DefaultPath))
+    if err != nil {
+        t.Fatalf("read default config: %v", err)
+    }
+    if err := yaml.Unmarshal(data, &file); err != nil {
+        t.Fatalf("parse default config: %v", err)
+    }
+
+    // The sample keys are only for trying the server out
+    file.APIKeys = nil
+    if len(file.TLSCipherSuites) == 0 {
+        file.TLSCipherSuites = nil
+    }
+    if want := defaults(); !reflect.DeepEqual(&file, want) {
+        t.Errorf("config/default.yaml and defaults() differ:\nfile:     %+v\ndefaults: %+v", file, *want)
+    }
+}
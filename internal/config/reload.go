@@ -0,0 +1,128 @@
+package config
+
+import (
+    "errors"
+    "fmt"
+    "os"
+    "reflect"
+    "sort"
+    "strings"
+    "time"
+)
+
+// restartOptions are bound when the server starts: the listeners and TLS,
+// the database pools and the background jobs. A reload that changes any of
+// them is rejected.
+var restartOptions = map[string]bool{
+    "port": true, "db_path": true, "auto_migrate": true,
+    "db_journal_mode": true, "db_synchronous": true, "db_busy_timeout": true,
+    "db_cache_size_kb": true, "db_max_read_conns": true,
+    "db_max_idle_conns": true, "db_conn_max_lifetime": true,
+    "backup_dir": true, "backup_interval": true, "backup_retention": true,
+    "janitor_interval": true, "janitor_retention_days": true,
+    "janitor_mode": true, "blocklist_reload_interval": true,
+    "config_reload_interval": true, "tls_cert_file": true,
+    "tls_key_file": true, "tls_min_version": true, "tls_cipher_suites": true,
+    "tls_reload_interval": true, "http_redirect_addr": true,
+    "hsts_max_age": true, "hsts_include_subdomains": true, "hsts_preload": true,
+    "admin_addr": true,
+}
+
+// Change is an option whose value differs between two configurations.
+type Change struct {
+    Option string
+    Old    string
+    New    string
+}
+
+func (c Change) String() string {
+    return fmt.Sprintf("%s: %s -> %s", c.Option, c.Old, c.New)
+}
+
+// Diff lists the options that differ between prev and next, in field order.
+// Secret values are redacted.
+func Diff(prev, next *Config) []Change {
+    pv, nv := reflect.ValueOf(prev).Elem(), reflect.ValueOf(next).Elem()
+    var changes []Change
+    for _, o := range options() {
+        a, b := pv.Field(o.index), nv.Field(o.index)
+        if reflect.DeepEqual(a.Interface(), b.Interface()) {
+            continue
+        }
+        changes = append(changes, Change{
+            Option: o.name,
+            Old:    formatValue(o.name, a),
+            New:    formatValue(o.name, b),
+        })
+    }
+    return changes
+}
+
+func formatValue(name string, v reflect.Value) string {
+    if secretOptions[name] {
+        return redact(v)
+    }
+    switch x := v.Interface().(type) {
+    case []string:
+        return "[" + strings.Join(x, ",") + "]"
+    case string:
+        return fmt.Sprintf("%q", x)
+    }
+    return fmt.Sprint(v.Interface())
+}
+
+// CheckReload returns an error naming the options that changed between
+// prev and next but can only change with a restart.
+func CheckReload(prev, next *Config) error {
+    var fixed []string
+    for _, c := range Diff(prev, next) {
+        if restartOptions[c.Option] {
+            fixed = append(fixed, c.Option)
+        }
+    }
+    if len(fixed) > 0 {
+        return fmt.Errorf("restart required to change %s", strings.Join(fixed, ", "))
+    }
+    return nil
+}
+
+// WatchFiles polls files every interval and calls changed when one of
+// them was modified, created or removed since the last poll, until stop
+// is closed.
+func WatchFiles(files []string, interval time.Duration, stop <-chan struct{}, changed func()) {
+    last := fileStamps(files)
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-stop:
+            return
+        case <-ticker.C:
+            now := fileStamps(files)
+            if now != last {
+                last = now
+                changed()
+            }
+        }
+    }
+}
+
+// fileStamps summarizes the modification time and size of files; missing
+// files count as empty.
+func fileStamps(files []string) string {
+    sorted := append([]string(nil), files...)
+    sort.Strings(sorted)
+    var b strings.Builder
+    for _, f := range sorted {
+        info, err := os.Stat(f)
+        if errors.Is(err, os.ErrNotExist) {
+            fmt.Fprintf(&b, "%s:-;", f)
+            continue
+        }
+        if err != nil {
+            continue
+        }
+        fmt.Fprintf(&b, "%s:%d:%d;", f, info.ModTime().UnixNano(), info.Size())
+    }
+    return b.String()
+}
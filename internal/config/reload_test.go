@@ -0,0 +1,67 @@
+package config
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestDiffAndCheckReload(t *testing.T) {
+    prev := defaults()
+    prev.APIKeys = []string{"secret-1"}
+
+    next := *prev
+    next.RateLimit = 50
+    next.APIKeys = []string{"secret-1", "secret-2"}
+    next.LogLevel = "debug"
+
+    changes := Diff(prev, &next)
+    var lines []string
+    for _, c := range changes {
+        lines = append(lines, c.String())
+    }
+    got := strings.Join(lines, "\n")
+    want := "rate_limit: 100 -> 50\napi_keys: (redacted, 1 values) -> (redacted, 2 values)\nlog_level: \"info\" -> \"debug\""
+    if got != want {
+        t.Fatalf("Diff:\n%s\nwant:\n%s", got, want)
+    }
+    if strings.Contains(got, "secret") {
+        t.Fatalf("Diff leaks API keys: %s", got)
+    }
+    if err := CheckReload(prev, &next); err != nil {
+        t.Fatalf("CheckReload of reloadable options: %v", err)
+    }
+
+    next.Port = ":9090"
+    next.DBPath = "/elsewhere.db"
+    err := CheckReload(prev, &next)
+    if err == nil || !strings.Contains(err.Error(), "port, db_path") {
+        t.Fatalf("CheckReload: want restart error naming port and db_path, got %v", err)
+    }
+}
+
+func TestWatchFiles(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "snapurl.yaml")
+    changed := make(chan struct{}, 1)
+    stop := make(chan struct{})
+    defer close(stop)
+    go WatchFiles([]string{path}, 5*time.Millisecond, stop, func() {
+        select {
+        case changed <- struct{}{}:
+        default:
+        }
+    })
+
+    // Creating a missing file counts as a change
+    time.Sleep(20 * time.Millisecond)
+    if err := os.WriteFile(path, []byte("rate_limit: 5\n"), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    select {
+    case <-changed:
+    case <-time.After(time.Second):
+        t.Fatal("no change reported after creating the file")
+    }
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+    "fmt"
+    "io"
+    "os"
+    "reflect"
+    "sort"
+    "strings"
+    "time"
+
+    "gopkg.in/yaml.v3"
+)
+
+// secretOptions are never printed or logged. Each has a companion option
+// with secretFileSuffix (api_keys_file) naming a file to read it from, so
+// the value can come from a Docker or Kubernetes secret instead of the YAML.
+var secretOptions = map[string]bool{
+    "api_keys": true,
+}
+
+const secretFileSuffix = "_file"
+
+// readSecretFiles sets each secret option whose *_file option is set from
+// that file, replacing any value from the earlier layers. Lists have one
+// value per line; blank lines and lines starting with # are skipped.
+func (l *loaded) readSecretFiles() error {
+    byName := map[string]option{}
+    for _, o := range options() {
+        byName[o.name] = o
+    }
+    names := make([]string, 0, len(secretOptions))
+    for name := range secretOptions {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    cfg := reflect.ValueOf(l.cfg).Elem()
+    for _, name := range names {
+        o, fo := byName[name], byName[name+secretFileSuffix]
+        path := cfg.Field(fo.index).String()
+        if path == "" {
+            continue
+        }
+        data, err := os.ReadFile(path)
+        if err != nil {
+            return fmt.Errorf("%s: %w", fo.name, err)
+        }
+        if o.typ.Kind() == reflect.Slice {
+            var values []string
+            for _, line := range strings.Split(string(data), "\n") {
+                if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+                    values = append(values, line)
+                }
+            }
+            cfg.Field(o.index).Set(reflect.ValueOf(values))
+        } else {
+            cfg.Field(o.index).SetString(strings.TrimSpace(string(data)))
+        }
+        l.sources[name] = fo.name + " " + path
+        l.files = append(l.files, path)
+    }
+    return nil
+}
+
+// redact hides a secret value, keeping only how many values a list has.
+func redact(v reflect.Value) string {
+    if v.Kind() == reflect.Slice {
+        return fmt.Sprintf("(redacted, %d values)", v.Len())
+    }
+    if v.String() == "" {
+        return ""
+    }
+    return "(redacted)"
+}
+
+// Setting is the effective value of an option and where it came from:
+// "default", "file <path>", "env <NAME>", "flag -<name>" or, for secrets
+// read from a file, "<option>_file <path>".
+type Setting struct {
+    Option string `json:"option"`
+    Value  any    `json:"value"`
+    Source string `json:"source"`
+}
+
+// Settings lists every option of the last successful Load in field order,
+// with secret values redacted.
+func (f *Flags) Settings() []Setting {
+    if f.last == nil {
+        return nil
+    }
+    cfg := reflect.ValueOf(f.last.cfg).Elem()
+    var settings []Setting
+    for _, o := range options() {
+        v := cfg.Field(o.index)
+        s := Setting{Option: o.name, Value: v.Interface(), Source: f.last.sources[o.name]}
+        if secretOptions[o.name] {
+            s.Value = redact(v)
+        } else if o.typ == durationType {
+            s.Value = v.Interface().(time.Duration).String()
+        }
+        if s.Source == "" {
+            s.Source = "default"
+        }
+        settings = append(settings, s)
+    }
+    return settings
+}
+
+// WriteSettings writes settings as a YAML config file, with the source of
+// each value as a comment.
+func WriteSettings(w io.Writer, settings []Setting) error {
+    doc := &yaml.Node{Kind: yaml.MappingNode}
+    for _, s := range settings {
+        value := &yaml.Node{}
+        if err := value.Encode(s.Value); err != nil {
+            return fmt.Errorf("%s: %w", s.Option, err)
+        }
+        if value.Kind == yaml.SequenceNode {
+            value.Style = yaml.FlowStyle
+        }
+        value.LineComment = s.Source
+        doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: s.Option}, value)
+    }
+    enc := yaml.NewEncoder(w)
+    enc.SetIndent(2)
+    if err := enc.Encode(doc); err != nil {
+        return err
+    }
+    return enc.Close()
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+    "bytes"
+    "flag"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestSecretFilesAndSettings(t *testing.T) {
+    dir := t.TempDir()
+    base := filepath.Join(dir, "snapurl.yaml")
+    keys := filepath.Join(dir, "keys")
+    writeFile(t, base, "api_keys: [\"from-yaml\"]\nrate_limit: 10\n")
+    writeFile(t, keys, "# rotated 2026-10-01\nkey-one\n\n  key-two  \n")
+
+    t.Setenv("SNAPURL_API_KEYS_FILE", keys)
+    t.Setenv("SNAPURL_RATE_LIMIT", "20")
+    fs := flag.NewFlagSet("test", flag.ContinueOnError)
+    flags := NewFlags(fs)
+    if err := fs.Parse([]string{"-config", base, "-log-level", "warn"}); err != nil {
+        t.Fatalf("parse flags: %v", err)
+    }
+    cfg, err := flags.Load()
+    if err != nil {
+        t.Fatalf("Load: %v", err)
+    }
+
+    // The file replaces the keys from the YAML and is watched for changes
+    if !reflect.DeepEqual(cfg.APIKeys, []string{"key-one", "key-two"}) {
+        t.Fatalf("APIKeys = %q", cfg.APIKeys)
+    }
+    if files := flags.Files(); len(files) != 2 || files[1] != keys {
+        t.Fatalf("Files = %q", files)
+    }
+
+    sources := map[string]Setting{}
+    for _, s := range flags.Settings() {
+        sources[s.Option] = s
+    }
+    for option, want := range map[string]string{
+        "api_keys":      "api_keys_file " + keys,
+        "api_keys_file": "env SNAPURL_API_KEYS_FILE",
+        "rate_limit":    "env SNAPURL_RATE_LIMIT",
+        "log_level":     "flag -log-level",
+        "port":          "default",
+    } {
+        if got := sources[option].Source; got != want {
+            t.Errorf("source of %s = %q, want %q", option, got, want)
+        }
+    }
+    if v := sources["api_keys"].Value; v != "(redacted, 2 values)" {
+        t.Errorf("api_keys value = %v, want it redacted", v)
+    }
+
+    var out bytes.Buffer
+    if err := WriteSettings(&out, flags.Settings()); err != nil {
+        t.Fatalf("WriteSettings: %v", err)
+    }
+    if strings.Contains(out.String(), "key-one") || strings.Contains(out.String(), "from-yaml") {
+        t.Fatalf("WriteSettings leaks API keys:\n%s", out.String())
+    }
+    if !strings.Contains(out.String(), "rate_limit: 20 # env SNAPURL_RATE_LIMIT\n") {
+        t.Fatalf("WriteSettings output:\n%s", out.String())
+    }
+
+    // A missing secret file is an error, not an empty key list
+    t.Setenv("SNAPURL_API_KEYS_FILE", filepath.Join(dir, "missing"))
+    if _, err := flags.Load(); err == nil || !strings.Contains(err.Error(), "api_keys_file") {
+        t.Fatalf("missing secret file: want api_keys_file error, got %v", err)
+    }
+}
@@ -0,0 +1,278 @@
+package config
+
+import (
+    "errors"
+    "fmt"
+    "net"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/valorm/snapurl/internal/logging"
+    "github.com/valorm/snapurl/internal/tlsconfig"
+)
+
+// ValidationError lists every problem Validate found.
+type ValidationError struct {
+    Problems []string
+}
+
+func (e *ValidationError) Error() string {
+    return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate checks the configuration before the server starts and returns
+// a *ValidationError describing all problems at once, or nil.
+func (c *Config) Validate() error {
+    v := &validator{}
+
+    // Listening and addressing
+    if c.Port == "" {
+        v.add("port is required, e.g. \":8080\"")
+    } else if err := checkAddr(c.Port); err != nil {
+        v.add("port %q: %v", c.Port, err)
+    }
+    if c.PublicBaseURL != "" {
+        u, err := url.Parse(c.PublicBaseURL)
+        if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+            v.add("public_base_url %q must be an absolute http(s) URL, e.g. \"https://sn.ap\"", c.PublicBaseURL)
+        }
+    }
+    c.validateTLS(v)
+    c.validateAdmin(v)
+    if c.RateLimit < 1 {
+        v.add("rate_limit must be at least 1 request per second, got %d", c.RateLimit)
+    }
+
+    // Keys; an empty list is fine when admin keys are stored in the
+    // database, which the server checks once it has opened it
+    seen := map[string]bool{}
+    for i, key := range c.APIKeys {
+        switch {
+        case strings.TrimSpace(key) == "":
+            v.add("api_keys[%d] is empty", i)
+        case seen[key]:
+            v.add("api_keys[%d] duplicates an earlier key", i)
+        }
+        seen[key] = true
+    }
+
+    // Database
+    if c.DBPath == "" {
+        v.add("db_path is required")
+    } else if c.DBPath != ":memory:" {
+        if err := checkWritableDir(filepath.Dir(c.DBPath)); err != nil {
+            v.add("db_path %q: %v", c.DBPath, err)
+        }
+    }
+    v.oneOf("db_journal_mode", c.DBJournalMode, "DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF")
+    v.oneOf("db_synchronous", c.DBSynchronous, "OFF", "NORMAL", "FULL", "EXTRA")
+    v.nonNegative("db_cache_size_kb", c.DBCacheSizeKB)
+    v.nonNegative("db_max_read_conns", c.DBMaxReadConns)
+    v.nonNegative("db_max_idle_conns", c.DBMaxIdleConns)
+
+    // Links
+    for i, scheme := range c.AllowedSchemes {
+        if scheme == "" || strings.ToLower(scheme) != scheme || strings.Contains(scheme, ":") {
+            v.add("allowed_schemes[%d] %q must be a lower-case scheme without \":\"", i, scheme)
+        }
+    }
+    v.nonNegative("max_url_length", c.MaxURLLength)
+    v.nonNegative("max_batch_size", c.MaxBatchSize)
+    v.nonNegative("max_redirect_depth", c.MaxRedirectDepth)
+    if c.ExpandResolver != "" {
+        if _, _, err := net.SplitHostPort(c.ExpandResolver); err != nil {
+            v.add("expand_resolver %q must be host:port, e.g. \"1.1.1.1:53\"", c.ExpandResolver)
+        }
+    }
+
+    // Blocklist
+    if c.BlocklistPath != "" {
+        if _, err := os.Stat(c.BlocklistPath); err != nil {
+            v.add("blocklist_path: %v", err)
+        }
+    }
+    v.oneOf("blocklist_action", c.BlocklistAction, "revoke", "warn")
+
+    // Backups and janitor
+    if c.BackupInterval > 0 && c.BackupDir == "" {
+        v.add("backup_interval is set but backup_dir is empty")
+    }
+    v.nonNegative("backup_retention", c.BackupRetention)
+    v.nonNegative("janitor_retention_days", c.JanitorRetentionDays)
+    v.oneOf("janitor_mode", c.JanitorMode, "archive", "delete")
+
+    // Logging
+    if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+        v.add("log_level %q must be one of debug, info, warn (or warning), error", c.LogLevel)
+    }
+
+    // Durations
+    for _, d := range []struct {
+        name  string
+        value time.Duration
+    }{
+        {"idempotency_window", c.IdempotencyWindow},
+        {"expand_timeout", c.ExpandTimeout},
+        {"blocklist_reload_interval", c.BlocklistReloadInterval},
+        {"backup_interval", c.BackupInterval},
+        {"janitor_interval", c.JanitorInterval},
+        {"db_busy_timeout", c.DBBusyTimeout},
+        {"db_conn_max_lifetime", c.DBConnMaxLifetime},
+        {"config_reload_interval", c.ConfigReloadInterval},
+        {"tls_reload_interval", c.TLSReloadInterval},
+        {"hsts_max_age", c.HSTSMaxAge},
+        {"key_rotation_overlap", c.KeyRotationOverlap},
+    } {
+        if d.value < 0 {
+            v.add("%s must not be negative, got %s", d.name, d.value)
+        }
+    }
+
+    if len(v.problems) > 0 {
+        return &ValidationError{Problems: v.problems}
+    }
+    return nil
+}
+
+// hstsPreloadMinAge is the shortest max-age browsers accept for their
+// HSTS preload lists.
+const hstsPreloadMinAge = 365 * 24 * time.Hour
+
+func (c *Config) validateTLS(v *validator) {
+    if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+        v.add("tls_cert_file and tls_key_file must be set together")
+    }
+    for _, f := range []struct{ name, path string }{
+        {"tls_cert_file", c.TLSCertFile},
+        {"tls_key_file", c.TLSKeyFile},
+    } {
+        if f.path == "" {
+            continue
+        }
+        if _, err := os.Stat(f.path); err != nil {
+            v.add("%s: %v", f.name, err)
+        }
+    }
+    if _, err := tlsconfig.ParseVersion(c.TLSMinVersion); err != nil {
+        v.add("tls_min_version: %v", err)
+    }
+    if _, err := tlsconfig.CipherSuites(c.TLSCipherSuites); err != nil {
+        v.add("tls_cipher_suites: %v", err)
+    }
+
+    tlsOn := c.TLSCertFile != ""
+    if c.HTTPRedirectAddr != "" {
+        switch {
+        case !tlsOn:
+            v.add("http_redirect_addr needs tls_cert_file and tls_key_file")
+        case c.HTTPRedirectAddr == c.Port:
+            v.add("http_redirect_addr must differ from port")
+        default:
+            if err := checkAddr(c.HTTPRedirectAddr); err != nil {
+                v.add("http_redirect_addr %q: %v", c.HTTPRedirectAddr, err)
+            }
+        }
+    }
+    if c.HSTSMaxAge > 0 && !tlsOn {
+        v.add("hsts_max_age is only sent over HTTPS and needs tls_cert_file and tls_key_file")
+    }
+    if c.HSTSPreload && (!c.HSTSIncludeSubdomains || c.HSTSMaxAge < hstsPreloadMinAge) {
+        v.add("hsts_preload needs hsts_include_subdomains and an hsts_max_age of at least 8760h (one year)")
+    }
+}
+
+type validator struct {
+    problems []string
+}
+
+func (v *validator) add(format string, args ...any) {
+    v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+func (v *validator) nonNegative(name string, n int) {
+    if n < 0 {
+        v.add("%s must not be negative, got %d", name, n)
+    }
+}
+
+// oneOf accepts an empty value (the default) or one of allowed, ignoring
+// case.
+func (v *validator) oneOf(name, value string, allowed ...string) {
+    if value == "" {
+        return
+    }
+    for _, a := range allowed {
+        if strings.EqualFold(value, a) {
+            return
+        }
+    }
+    v.add("%s %q must be one of %s", name, value, strings.Join(allowed, ", "))
+}
+
+// AdminSocketPrefix marks an admin_addr that is a Unix socket path.
+const AdminSocketPrefix = "unix:"
+
+func (c *Config) validateAdmin(v *validator) {
+    if c.AdminAddr == "" {
+        return
+    }
+    if path, ok := strings.CutPrefix(c.AdminAddr, AdminSocketPrefix); ok {
+        if !filepath.IsAbs(path) {
+            v.add("admin_addr %q: want an absolute socket path, e.g. \"unix:/run/snapurl/admin.sock\"", c.AdminAddr)
+        } else if err := checkWritableDir(filepath.Dir(path)); err != nil {
+            v.add("admin_addr %q: %v", c.AdminAddr, err)
+        }
+        return
+    }
+    switch {
+    case c.AdminAddr == c.Port || c.AdminAddr == c.HTTPRedirectAddr:
+        v.add("admin_addr must differ from port and http_redirect_addr")
+    default:
+        if err := checkAddr(c.AdminAddr); err != nil {
+            v.add("admin_addr %q: %v, or unix:/path/to/socket", c.AdminAddr, err)
+        }
+    }
+}
+
+// checkAddr accepts a listen address such as ":8080" or "127.0.0.1:8080".
+func checkAddr(addr string) error {
+    _, port, err := net.SplitHostPort(addr)
+    if err != nil {
+        return errors.New(`want [host]:port, e.g. ":8080"`)
+    }
+    n, err := strconv.Atoi(port)
+    if err != nil || n < 1 || n > 65535 {
+        return fmt.Errorf("port must be a number from 1 to 65535")
+    }
+    return nil
+}
+
+// checkWritableDir checks that files can be created in dir, or in its
+// nearest existing parent when dir has yet to be created.
+func checkWritableDir(dir string) error {
+    for {
+        info, err := os.Stat(dir)
+        if errors.Is(err, os.ErrNotExist) && filepath.Dir(dir) != dir {
+            dir = filepath.Dir(dir)
+            continue
+        }
+        if err != nil {
+            return err
+        }
+        if !info.IsDir() {
+            return fmt.Errorf("%s is not a directory", dir)
+        }
+        break
+    }
+    f, err := os.CreateTemp(dir, ".snapurl-write-check-*")
+    if err != nil {
+        return fmt.Errorf("directory %s is not writable", dir)
+    }
+    f.Close()
+    os.Remove(f.Name())
+    return nil
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+    "errors"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestValidate(t *testing.T) {
+    dir := t.TempDir()
+
+    valid := defaults()
+    valid.APIKeys = []string{"admin-key"}
+    valid.DBPath = filepath.Join(dir, "new", "snapurl.db") // created on open
+    if err := valid.Validate(); err != nil {
+        t.Fatalf("valid config: %v", err)
+    }
+    dbKeysOnly := *valid
+    dbKeysOnly.APIKeys = nil
+    dbKeysOnly.LogLevel = "warning"
+    if err := dbKeysOnly.Validate(); err != nil {
+        t.Errorf("config without api_keys: %v", err)
+    }
+
+    bad := *valid
+    bad.Port = ":http-alt"
+    bad.RateLimit = 0
+    bad.APIKeys = []string{"k", " ", "k"}
+    bad.DBPath = filepath.Join(dir, "new", "snapurl.db", "nested.db")
+    bad.PublicBaseURL = "sn.ap"
+    bad.BlocklistAction = "block"
+    bad.DBSynchronous = "sometimes"
+    bad.BackupInterval = time.Hour
+    bad.BackupDir = ""
+    bad.ExpandTimeout = -time.Second
+    bad.LogLevel = "loud"
+    writeFile(t, filepath.Join(dir, "new"), "") // a file where a directory is needed
+
+    err := bad.Validate()
+    var verr *ValidationError
+    if !errors.As(err, &verr) {
+        t.Fatalf("want *ValidationError, got %v", err)
+    }
+    for _, want := range []string{
+        `port ":http-alt"`,
+        "rate_limit must be at least 1",
+        "api_keys[1] is empty",
+        "api_keys[2] duplicates",
+        "not a directory",
+        "public_base_url",
+        `blocklist_action "block"`,
+        `db_synchronous "sometimes"`,
+        "backup_dir is empty",
+        "expand_timeout must not be negative",
+        `log_level "loud"`,
+    } {
+        if !strings.Contains(err.Error(), want) {
+            t.Errorf("missing problem %q in:\n%v", want, err)
+        }
+    }
+    if len(verr.Problems) != 11 {
+        t.Errorf("want 11 problems, got %d:\n%v", len(verr.Problems), err)
+    }
+}
+
+func TestValidateTLS(t *testing.T) {
+    dir := t.TempDir()
+    cert := filepath.Join(dir, "tls.crt")
+    writeFile(t, cert, "")
+
+    cfg := defaults()
+    cfg.APIKeys = []string{"admin-key"}
+    cfg.DBPath = filepath.Join(dir, "snapurl.db")
+    cfg.TLSCertFile = cert
+    cfg.TLSMinVersion = "1.0"
+    cfg.TLSCipherSuites = []string{"TLS_RSA_WITH_RC4_128_SHA"}
+    cfg.HTTPRedirectAddr = cfg.Port
+    cfg.HSTSPreload = true
+
+    err := cfg.Validate()
+    if err == nil {
+        t.Fatal("want errors")
+    }
+    for _, want := range []string{
+        "tls_cert_file and tls_key_file must be set together",
+        "tls_min_version",
+        "TLS_RSA_WITH_RC4_128_SHA (insecure)",
+        "http_redirect_addr must differ from port",
+        "hsts_preload needs",
+    } {
+        if !strings.Contains(err.Error(), want) {
+            t.Errorf("missing problem %q in:\n%v", want, err)
+        }
+    }
+
+    // HSTS and the redirect listener need TLS
+    cfg = defaults()
+    cfg.APIKeys = []string{"admin-key"}
+    cfg.DBPath = filepath.Join(dir, "snapurl.db")
+    cfg.HTTPRedirectAddr = ":80"
+    cfg.HSTSMaxAge = time.Hour
+    err = cfg.Validate()
+    if err == nil || !strings.Contains(err.Error(), "http_redirect_addr needs") || !strings.Contains(err.Error(), "hsts_max_age is only sent over HTTPS") {
+        t.Fatalf("want TLS-only options rejected, got %v", err)
+    }
+}
+
+func TestValidateAdminAddr(t *testing.T) {
+    dir := t.TempDir()
+    for addr, want := range map[string]string{
+        "127.0.0.1:9090":                  "",
+        "unix:" + dir + "/run/admin.sock": "",
+        ":8080":                           "admin_addr must differ",
+        "unix:admin.sock":                 "want an absolute socket path",
+        "localhost":                       `admin_addr "localhost"`,
+    } {
+        cfg := defaults()
+        cfg.APIKeys = []string{"admin-key"}
+        cfg.DBPath = filepath.Join(dir, "snapurl.db")
+        cfg.AdminAddr = addr
+        err := cfg.Validate()
+        switch {
+        case want == "" && err != nil:
+            t.Errorf("%s: %v", addr, err)
+        case want != "" && (err == nil || !strings.Contains(err.Error(), want)):
+            t.Errorf("%s: want %q, got %v", addr, want, err)
+        }
+    }
+}
@@ -0,0 +1,350 @@
+package datastore
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/mattn/go-sqlite3"
+)
+
+// backupStepPages is how many pages are copied per backup step; the source
+// is only locked while a step runs, so writers are not blocked for long.
+const backupStepPages = 256
+
+// Backup writes a consistent snapshot of the live database to destPath
+// using the SQLite online backup API. The snapshot is written next to
+// destPath first and renamed into place once complete.
+func Backup(ctx context.Context, db *sql.DB, destPath string) error {
+    tmp := destPath + ".tmp"
+    os.Remove(tmp)
+    if err := backupToFile(ctx, db, tmp); err != nil {
+        os.Remove(tmp)
+        return err
+    }
+    if err := os.Rename(tmp, destPath); err != nil {
+        os.Remove(tmp)
+        return fmt.Errorf("move backup into place: %w", err)
+    }
+    return nil
+}
+
+// BackupTo streams a consistent snapshot of the live database to w. The
+// snapshot is staged in a temporary file so w sees a complete database.
+func BackupTo(ctx context.Context, db *sql.DB, w io.Writer) error {
+    f, err := os.CreateTemp("", "snapurl-backup-*.db")
+    if err != nil {
+        return fmt.Errorf("create temp file: %w", err)
+    }
+    tmp := f.Name()
+    f.Close()
+    defer os.Remove(tmp)
+
+    if err := backupToFile(ctx, db, tmp); err != nil {
+        return err
+    }
+    f, err = os.Open(tmp)
+    if err != nil {
+        return fmt.Errorf("open snapshot: %w", err)
+    }
+    defer f.Close()
+    if _, err := io.Copy(w, f); err != nil {
+        return fmt.Errorf("stream snapshot: %w", err)
+    }
+    return nil
+}
+
+func backupToFile(ctx context.Context, db *sql.DB, path string) error {
+    dest, err := sql.Open("sqlite3", path)
+    if err != nil {
+        return fmt.Errorf("open backup file: %w", err)
+    }
+    defer dest.Close()
+
+    destConn, err := dest.Conn(ctx)
+    if err != nil {
+        return fmt.Errorf("open backup file: %w", err)
+    }
+    defer destConn.Close()
+    srcConn, err := db.Conn(ctx)
+    if err != nil {
+        return fmt.Errorf("acquire source connection: %w", err)
+    }
+    defer srcConn.Close()
+
+    return destConn.Raw(func(destRaw any) error {
+        return srcConn.Raw(func(srcRaw any) error {
+            destSQLite, ok1 := destRaw.(*sqlite3.SQLiteConn)
+            srcSQLite, ok2 := srcRaw.(*sqlite3.SQLiteConn)
+            if !ok1 || !ok2 {
+                return fmt.Errorf("backup requires sqlite3 connections")
+            }
+
+            bk, err := destSQLite.Backup("main", srcSQLite, "main")
+            if err != nil {
+                return fmt.Errorf("start backup: %w", err)
+            }
+            for {
+                done, err := bk.Step(backupStepPages)
+                if err != nil {
+                    bk.Close()
+                    return fmt.Errorf("backup step: %w", err)
+                }
+                if done {
+                    break
+                }
+                select {
+                case <-ctx.Done():
+                    bk.Close()
+                    return ctx.Err()
+                default:
+                }
+            }
+            if err := bk.Finish(); err != nil {
+                return fmt.Errorf("finish backup: %w", err)
+            }
+            return nil
+        })
+    })
+}
+
+// Verify opens the database at path read-only and checks that it passes
+// SQLite's integrity check and carries the snapurl schema.
+func Verify(path string) error {
+    if _, err := os.Stat(path); err != nil {
+        return err
+    }
+    db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+    if err != nil {
+        return fmt.Errorf("open %s: %w", path, err)
+    }
+    defer db.Close()
+
+    var result string
+    if err := db.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+        return fmt.Errorf("integrity check: %w", err)
+    }
+    if result != "ok" {
+        return fmt.Errorf("integrity check failed: %s", result)
+    }
+    var n int
+    if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name IN ('links', 'schema_migrations')").Scan(&n); err != nil {
+        return fmt.Errorf("read schema: %w", err)
+    }
+    if n != 2 {
+        return fmt.Errorf("%s is not a snapurl database", path)
+    }
+    return nil
+}
+
+// ErrDatabaseInUse is returned by Restore when another connection, such
+// as a running server, has the database open.
+var ErrDatabaseInUse = errors.New("database is in use; stop the server first")
+
+// journalSuffixes name the files SQLite keeps next to a database.
+var journalSuffixes = []string{"-wal", "-shm", "-journal"}
+
+// Restore replaces the database at dbPath with the backup at backupPath
+// after verifying the backup. The server must not be running, which is
+// checked by taking an exclusive lock. The previous database, with its
+// WAL checkpointed into it, is kept as dbPath + ".pre-restore-<time>" and
+// its path is returned ("" when there was none).
+func Restore(backupPath, dbPath string) (string, error) {
+    if err := Verify(backupPath); err != nil {
+        return "", fmt.Errorf("backup rejected: %w", err)
+    }
+    _, err := os.Stat(dbPath)
+    exists := err == nil
+    if exists {
+        if err := checkpointIdle(dbPath); err != nil {
+            return "", err
+        }
+    }
+
+    // Copy first so a failure never leaves dbPath half written
+    tmp := dbPath + ".restore-tmp"
+    if err := copyFile(backupPath, tmp); err != nil {
+        os.Remove(tmp)
+        return "", err
+    }
+    if err := Verify(tmp); err != nil {
+        os.Remove(tmp)
+        return "", fmt.Errorf("copied backup rejected: %w", err)
+    }
+    if !exists {
+        if err := os.Rename(tmp, dbPath); err != nil {
+            os.Remove(tmp)
+            return "", fmt.Errorf("swap in backup: %w", err)
+        }
+        return "", nil
+    }
+
+    // Journal files move along with the old database: they belong to it
+    // and must not be applied to the new one
+    previous := dbPath + ".pre-restore-" + time.Now().UTC().Format("20060102-150405")
+    moved, err := moveDatabase(dbPath, previous)
+    if err != nil {
+        moveBack(moved, dbPath, previous)
+        os.Remove(tmp)
+        return "", fmt.Errorf("keep current database: %w", err)
+    }
+    if err := os.Rename(tmp, dbPath); err != nil {
+        moveBack(moved, dbPath, previous)
+        os.Remove(tmp)
+        return "", fmt.Errorf("swap in backup: %w", err)
+    }
+    return previous, nil
+}
+
+// checkpointIdle takes an exclusive lock on the database at path, failing
+// with ErrDatabaseInUse when another connection holds it open, and folds
+// its WAL into the main file.
+func checkpointIdle(path string) error {
+    db, err := sql.Open("sqlite3", path+"?_locking_mode=EXCLUSIVE&_busy_timeout=0")
+    if err != nil {
+        return fmt.Errorf("open %s: %w", path, err)
+    }
+    defer db.Close()
+    db.SetMaxOpenConns(1)
+
+    // A write transaction makes the exclusive lock stick until Close
+    if _, err := db.Exec("BEGIN EXCLUSIVE"); err != nil {
+        if isBusy(err) {
+            return ErrDatabaseInUse
+        }
+        return fmt.Errorf("lock %s: %w", path, err)
+    }
+    if _, err := db.Exec("COMMIT"); err != nil {
+        return fmt.Errorf("lock %s: %w", path, err)
+    }
+    if _, err := db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+        return fmt.Errorf("checkpoint %s: %w", path, err)
+    }
+    return nil
+}
+
+func isBusy(err error) bool {
+    var serr sqlite3.Error
+    return errors.As(err, &serr) && (serr.Code == sqlite3.ErrBusy || serr.Code == sqlite3.ErrLocked)
+}
+
+// moveDatabase renames the database at from and its journal files to to.
+// It returns the suffixes moved so far, "" standing for the main file.
+func moveDatabase(from, to string) ([]string, error) {
+    var moved []string
+    for _, suffix := range append([]string{""}, journalSuffixes...) {
+        err := os.Rename(from+suffix, to+suffix)
+        if suffix != "" && errors.Is(err, os.ErrNotExist) {
+            continue
+        }
+        if err != nil {
+            return moved, err
+        }
+        moved = append(moved, suffix)
+    }
+    return moved, nil
+}
+
+// moveBack undoes moveDatabase.
+func moveBack(moved []string, dbPath, previous string) {
+    for _, suffix := range moved {
+        if err := os.Rename(previous+suffix, dbPath+suffix); err != nil {
+            log.Printf("restore: move %s back: %v", previous+suffix, err)
+        }
+    }
+}
+
+func copyFile(src, dst string) error {
+    in, err := os.Open(src)
+    if err != nil {
+        return fmt.Errorf("open %s: %w", src, err)
+    }
+    defer in.Close()
+    out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+    if err != nil {
+        return fmt.Errorf("create %s: %w", dst, err)
+    }
+    if _, err := io.Copy(out, in); err != nil {
+        out.Close()
+        return fmt.Errorf("copy to %s: %w", dst, err)
+    }
+    if err := out.Sync(); err != nil {
+        out.Close()
+        return fmt.Errorf("sync %s: %w", dst, err)
+    }
+    return out.Close()
+}
+
+// backupPrefix and backupLayout name scheduled backups so they sort by time.
+const (
+    backupPrefix = "snapurl-"
+    backupLayout = "20060102-150405"
+)
+
+// BackupToDir writes a timestamped backup into dir and then deletes the
+// oldest backups beyond keep (keep <= 0 keeps everything). It returns the
+// path of the new backup.
+func BackupToDir(ctx context.Context, db *sql.DB, dir string, keep int) (string, error) {
+    if err := os.MkdirAll(dir, 0o755); err != nil {
+        return "", fmt.Errorf("create backup dir: %w", err)
+    }
+    path := filepath.Join(dir, backupPrefix+time.Now().UTC().Format(backupLayout)+".db")
+    if err := Backup(ctx, db, path); err != nil {
+        return "", err
+    }
+    if keep > 0 {
+        if err := pruneBackups(dir, keep); err != nil {
+            return path, err
+        }
+    }
+    return path, nil
+}
+
+func pruneBackups(dir string, keep int) error {
+    entries, err := os.ReadDir(dir)
+    if err != nil {
+        return fmt.Errorf("list backups: %w", err)
+    }
+    var names []string
+    for _, e := range entries {
+        if !e.IsDir() && strings.HasPrefix(e.Name(), backupPrefix) && strings.HasSuffix(e.Name(), ".db") {
+            names = append(names, e.Name())
+        }
+    }
+    sort.Strings(names)
+    for len(names) > keep {
+        if err := os.Remove(filepath.Join(dir, names[0])); err != nil {
+            return fmt.Errorf("remove old backup: %w", err)
+        }
+        names = names[1:]
+    }
+    return nil
+}
+
+// ScheduleBackups writes a backup into dir every interval until ctx is
+// done, keeping the newest keep files.
+func ScheduleBackups(ctx context.Context, db *sql.DB, dir string, interval time.Duration, keep int) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+            path, err := BackupToDir(ctx, db, dir, keep)
+            if err != nil {
+                log.Printf("scheduled backup: %v", err)
+                continue
+            }
+            log.Printf("scheduled backup written to %s", path)
+        }
+    }
+}
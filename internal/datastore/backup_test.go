@@ -0,0 +1,126 @@
+package datastore
+
+import (
+    "bytes"
+    "context"
+    "database/sql"
+    "errors"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+    dir := t.TempDir()
+    dbPath := filepath.Join(dir, "snapurl.db")
+    db, err := OpenDB(dbPath)
+    if err != nil {
+        t.Fatalf("OpenDB: %v", err)
+    }
+    defer db.Close()
+    db.Exec("INSERT INTO links (shortcode, target_url) VALUES ('before', 'https://a.example')")
+
+    // 1) Online backup while the database is open
+    ctx := context.Background()
+    backupPath := filepath.Join(dir, "backup.db")
+    if err := Backup(ctx, db, backupPath); err != nil {
+        t.Fatalf("Backup: %v", err)
+    }
+    if err := Verify(backupPath); err != nil {
+        t.Fatalf("Verify: %v", err)
+    }
+    var buf bytes.Buffer
+    if err := BackupTo(ctx, db, &buf); err != nil || !bytes.HasPrefix(buf.Bytes(), []byte("SQLite format 3\x00")) {
+        t.Fatalf("BackupTo: %v", err)
+    }
+
+    // 2) A database that is open elsewhere, like a running server's, is
+    // not replaced
+    db.Close()
+    store, err := Connect(dbPath, DefaultOptions())
+    if err != nil {
+        t.Fatalf("Connect: %v", err)
+    }
+    defer store.Close()
+    store.Write.Exec("PRAGMA wal_autocheckpoint = 0")
+    store.Write.Exec("INSERT INTO links (shortcode, target_url) VALUES ('after', 'https://b.example')")
+    if _, err := Restore(backupPath, dbPath); !errors.Is(err, ErrDatabaseInUse) {
+        t.Fatalf("Restore of an open database: want ErrDatabaseInUse, got %v", err)
+    }
+
+    // 3) Restore brings back the snapshot and keeps the replaced file,
+    // including writes only found in its WAL after an unclean stop
+    crashed := filepath.Join(t.TempDir(), "snapurl.db")
+    for _, suffix := range []string{"", "-wal"} {
+        if err := copyFile(dbPath+suffix, crashed+suffix); err != nil {
+            t.Fatalf("copy %s: %v", suffix, err)
+        }
+    }
+    previous, err := Restore(backupPath, crashed)
+    if err != nil {
+        t.Fatalf("Restore: %v", err)
+    }
+    count := func(path string) int {
+        db, _ := sql.Open("sqlite3", path)
+        defer db.Close()
+        var n int
+        db.QueryRow("SELECT COUNT(*) FROM links").Scan(&n)
+        return n
+    }
+    if n := count(previous); n != 2 {
+        t.Errorf("previous database: want 2 links, got %d", n)
+    }
+    if n := count(crashed); n != 1 {
+        t.Errorf("restored links: want 1, got %d", n)
+    }
+
+    // 4) Corrupt or foreign files are rejected before anything is swapped
+    junk := filepath.Join(dir, "junk.db")
+    os.WriteFile(junk, []byte("not a database"), 0o644)
+    if _, err := Restore(junk, dbPath); err == nil {
+        t.Error("expected junk backup to be rejected")
+    }
+    empty := filepath.Join(dir, "empty.db")
+    other, _ := sql.Open("sqlite3", empty)
+    other.Exec("CREATE TABLE t (x)")
+    other.Close()
+    if _, err := Restore(empty, dbPath); err == nil {
+        t.Error("expected non-snapurl database to be rejected")
+    }
+}
+
+func TestBackupRetention(t *testing.T) {
+    db, err := sql.Open("sqlite3", ":memory:")
+    if err != nil {
+        t.Fatalf("open DB: %v", err)
+    }
+    defer db.Close()
+    if err := RunMigrations(db); err != nil {
+        t.Fatalf("migrations: %v", err)
+    }
+
+    dir := t.TempDir()
+    for _, name := range []string{"snapurl-20250101-000000.db", "snapurl-20250102-000000.db", "snapurl-20250103-000000.db", "notes.txt"} {
+        os.WriteFile(filepath.Join(dir, name), nil, 0o644)
+    }
+    path, err := BackupToDir(context.Background(), db, dir, 2)
+    if err != nil {
+        t.Fatalf("BackupToDir: %v", err)
+    }
+
+    entries, _ := os.ReadDir(dir)
+    var names []string
+    for _, e := range entries {
+        names = append(names, e.Name())
+    }
+    want := []string{"notes.txt", "snapurl-20250103-000000.db", filepath.Base(path)}
+    if len(names) != len(want) {
+        t.Fatalf("after retention: want %v, got %v", want, names)
+    }
+    for i := range want {
+        if names[i] != want[i] {
+            t.Errorf("after retention: want %v, got %v", want, names)
+            break
+        }
+    }
+}
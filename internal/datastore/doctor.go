@@ -0,0 +1,345 @@
+package datastore
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "os"
+    "sort"
+    "strings"
+)
+
+// Doctor check statuses. Warnings point at data worth a look; failures at
+// a damaged or mismatched database.
+const (
+    CheckOK   = "ok"
+    CheckWarn = "warn"
+    CheckFail = "fail"
+)
+
+// maxProblems caps the problems listed per check.
+const maxProblems = 20
+
+// Check is the outcome of one doctor check.
+type Check struct {
+    Name     string   `json:"name"`
+    Status   string   `json:"status"`
+    Problems []string `json:"problems,omitempty"`
+}
+
+// FileSizes are the on-disk sizes of the database in bytes.
+type FileSizes struct {
+    DB          int64 `json:"db"`
+    WAL         int64 `json:"wal"`
+    SHM         int64 `json:"shm"`
+    Reclaimable int64 `json:"reclaimable"` // free pages VACUUM would return
+}
+
+// DoctorReport is the result of Doctor.
+type DoctorReport struct {
+    OK          bool      `json:"ok"`
+    Path        string    `json:"path"`
+    Checks      []Check   `json:"checks"`
+    Sizes       FileSizes `json:"sizes"`
+    Maintenance []string  `json:"maintenance,omitempty"`
+    // SizesAfter is set when maintenance ran.
+    SizesAfter *FileSizes `json:"sizes_after,omitempty"`
+}
+
+// DoctorOptions selects the maintenance Doctor runs after its checks.
+type DoctorOptions struct {
+    Vacuum  bool
+    Analyze bool
+}
+
+// Doctor checks the health of the database: SQLite's integrity and
+// foreign key checks, pending or unknown migrations, tables and indexes
+// against a freshly migrated schema, rows pointing at missing workspaces
+// and duplicate reusable links. Hits are stored on the link rows, so there
+// are no separate click rows to check. Maintenance runs only when every
+// check passed without failures.
+func Doctor(ctx context.Context, db *sql.DB, opts DoctorOptions) (DoctorReport, error) {
+    report := DoctorReport{OK: true}
+
+    path, err := databasePath(ctx, db)
+    if err != nil {
+        return report, err
+    }
+    report.Path = path
+    if report.Sizes, err = fileSizes(ctx, db, path); err != nil {
+        return report, err
+    }
+
+    checks := []func(context.Context, *sql.DB) (Check, error){
+        checkIntegrity,
+        checkForeignKeys,
+        checkMigrations,
+        checkSchemaObjects,
+        checkOrphans,
+        checkDuplicateTargets,
+    }
+    for _, run := range checks {
+        c, err := run(ctx, db)
+        if err != nil {
+            return report, fmt.Errorf("%s: %w", c.Name, err)
+        }
+        if c.Status == CheckFail {
+            report.OK = false
+        }
+        report.Checks = append(report.Checks, c)
+    }
+
+    if !report.OK || (!opts.Vacuum && !opts.Analyze) {
+        return report, nil
+    }
+    if opts.Analyze {
+        if _, err := db.ExecContext(ctx, "ANALYZE"); err != nil {
+            return report, fmt.Errorf("analyze: %w", err)
+        }
+        report.Maintenance = append(report.Maintenance, "analyze")
+    }
+    if opts.Vacuum {
+        if _, err := db.ExecContext(ctx, "VACUUM"); err != nil {
+            return report, fmt.Errorf("vacuum: %w", err)
+        }
+        report.Maintenance = append(report.Maintenance, "vacuum")
+    }
+    after, err := fileSizes(ctx, db, path)
+    if err != nil {
+        return report, err
+    }
+    report.SizesAfter = &after
+    return report, nil
+}
+
+// databasePath returns the file of the main database ("" for in-memory
+// databases).
+func databasePath(ctx context.Context, db *sql.DB) (string, error) {
+    rows, err := db.QueryContext(ctx, "PRAGMA database_list")
+    if err != nil {
+        return "", fmt.Errorf("database list: %w", err)
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var seq int
+        var name, file string
+        if err := rows.Scan(&seq, &name, &file); err != nil {
+            return "", fmt.Errorf("database list: %w", err)
+        }
+        if name == "main" {
+            return file, nil
+        }
+    }
+    return "", rows.Err()
+}
+
+func fileSizes(ctx context.Context, db *sql.DB, path string) (FileSizes, error) {
+    var sizes FileSizes
+    var free, pageSize int64
+    if err := db.QueryRowContext(ctx, "PRAGMA freelist_count").Scan(&free); err != nil {
+        return sizes, fmt.Errorf("freelist count: %w", err)
+    }
+    if err := db.QueryRowContext(ctx, "PRAGMA page_size").Scan(&pageSize); err != nil {
+        return sizes, fmt.Errorf("page size: %w", err)
+    }
+    sizes.Reclaimable = free * pageSize
+    if path == "" {
+        return sizes, nil
+    }
+    for _, f := range []struct {
+        suffix string
+        size   *int64
+    }{{"", &sizes.DB}, {"-wal", &sizes.WAL}, {"-shm", &sizes.SHM}} {
+        if info, err := os.Stat(path + f.suffix); err == nil {
+            *f.size = info.Size()
+        }
+    }
+    return sizes, nil
+}
+
+// newCheck turns a list of problems into a check with the given status,
+// or an ok one when there are none.
+func newCheck(name, status string, problems []string) Check {
+    if len(problems) == 0 {
+        return Check{Name: name, Status: CheckOK}
+    }
+    if len(problems) > maxProblems {
+        more := len(problems) - maxProblems
+        problems = append(problems[:maxProblems], fmt.Sprintf("... and %d more", more))
+    }
+    return Check{Name: name, Status: status, Problems: problems}
+}
+
+// queryStrings runs a query returning one text column per row.
+func queryStrings(ctx context.Context, db *sql.DB, query string, args ...any) ([]string, error) {
+    rows, err := db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    var out []string
+    for rows.Next() {
+        var s string
+        if err := rows.Scan(&s); err != nil {
+            return nil, err
+        }
+        out = append(out, s)
+    }
+    return out, rows.Err()
+}
+
+func checkIntegrity(ctx context.Context, db *sql.DB) (Check, error) {
+    const name = "integrity_check"
+    results, err := queryStrings(ctx, db, "PRAGMA integrity_check")
+    if err != nil {
+        return Check{Name: name}, err
+    }
+    if len(results) == 1 && results[0] == "ok" {
+        results = nil
+    }
+    return newCheck(name, CheckFail, results), nil
+}
+
+func checkForeignKeys(ctx context.Context, db *sql.DB) (Check, error) {
+    const name = "foreign_key_check"
+    rows, err := db.QueryContext(ctx, "PRAGMA foreign_key_check")
+    if err != nil {
+        return Check{Name: name}, err
+    }
+    defer rows.Close()
+    var problems []string
+    for rows.Next() {
+        var table, parent string
+        var rowid sql.NullInt64
+        var fkid int
+        if err := rows.Scan(&table, &rowid, &parent, &fkid); err != nil {
+            return Check{Name: name}, err
+        }
+        problems = append(problems, fmt.Sprintf("%s row %d references a missing %s row", table, rowid.Int64, parent))
+    }
+    if err := rows.Err(); err != nil {
+        return Check{Name: name}, err
+    }
+    return newCheck(name, CheckFail, problems), nil
+}
+
+func checkMigrations(ctx context.Context, db *sql.DB) (Check, error) {
+    const name = "schema_version"
+    migrations, err := MigrationStatus(db)
+    if err != nil {
+        return Check{Name: name}, err
+    }
+    var problems []string
+    for _, m := range migrations {
+        switch {
+        case m.Unknown:
+            problems = append(problems, m.Name+" is applied but unknown to this binary")
+        case !m.Applied:
+            problems = append(problems, m.Name+" is pending")
+        }
+    }
+    return newCheck(name, CheckFail, problems), nil
+}
+
+// schemaObjectsQuery lists tables and indexes, leaving out SQLite's own.
+const schemaObjectsQuery = `SELECT type || ' ' || name FROM sqlite_master
+    WHERE type IN ('table', 'index') AND name NOT LIKE 'sqlite_%'`
+
+// checkSchemaObjects compares tables and indexes with a database built
+// from the embedded migrations.
+func checkSchemaObjects(ctx context.Context, db *sql.DB) (Check, error) {
+    const name = "schema_objects"
+    ref, err := sql.Open("sqlite3", ":memory:")
+    if err != nil {
+        return Check{Name: name}, err
+    }
+    defer ref.Close()
+    ref.SetMaxOpenConns(1)
+    if err := RunMigrations(ref); err != nil {
+        return Check{Name: name}, fmt.Errorf("build reference schema: %w", err)
+    }
+
+    want, err := queryStrings(ctx, ref, schemaObjectsQuery)
+    if err != nil {
+        return Check{Name: name}, err
+    }
+    have, err := queryStrings(ctx, db, schemaObjectsQuery)
+    if err != nil {
+        return Check{Name: name}, err
+    }
+
+    present := map[string]bool{}
+    for _, obj := range have {
+        present[obj] = true
+    }
+    expected := map[string]bool{}
+    var problems []string
+    for _, obj := range want {
+        expected[obj] = true
+        if !present[obj] {
+            problems = append(problems, "missing "+obj)
+        }
+    }
+    for _, obj := range have {
+        if !expected[obj] {
+            problems = append(problems, "unexpected "+obj)
+        }
+    }
+    sort.Strings(problems)
+    return newCheck(name, CheckFail, problems), nil
+}
+
+// checkOrphans looks for archived links of workspaces that no longer
+// exist; links_archive has no foreign key that foreign_key_check could
+// verify.
+func checkOrphans(ctx context.Context, db *sql.DB) (Check, error) {
+    const name = "orphaned_rows"
+    var n int
+    err := db.QueryRowContext(ctx,
+        "SELECT COUNT(*) FROM links_archive WHERE workspace_id NOT IN (SELECT id FROM workspaces)",
+    ).Scan(&n)
+    if err != nil && strings.Contains(err.Error(), "no such table") {
+        return newCheck(name, CheckWarn, nil), nil
+    }
+    if err != nil {
+        return Check{Name: name}, err
+    }
+    var problems []string
+    if n > 0 {
+        problems = append(problems, fmt.Sprintf("%d archived links in missing workspaces", n))
+    }
+    return newCheck(name, CheckWarn, problems), nil
+}
+
+// checkDuplicateTargets reports active, non-expiring links of one owner
+// and workspace that share a normalized target: reuse_existing would have
+// returned the first of them.
+func checkDuplicateTargets(ctx context.Context, db *sql.DB) (Check, error) {
+    const name = "duplicate_targets"
+    rows, err := db.QueryContext(ctx, `
+        SELECT workspace_id, owner_id, normalized_url, COUNT(*) FROM links
+        WHERE revoked = 0 AND expires_at IS NULL AND normalized_url != ''
+        GROUP BY workspace_id, owner_id, normalized_url
+        HAVING COUNT(*) > 1
+        ORDER BY COUNT(*) DESC`)
+    if err != nil && strings.Contains(err.Error(), "no such column") {
+        return newCheck(name, CheckWarn, nil), nil
+    }
+    if err != nil {
+        return Check{Name: name}, err
+    }
+    defer rows.Close()
+    var problems []string
+    for rows.Next() {
+        var workspace, n int
+        var owner, target string
+        if err := rows.Scan(&workspace, &owner, &target, &n); err != nil {
+            return Check{Name: name}, err
+        }
+        problems = append(problems, fmt.Sprintf("%d links to %s (workspace %d, owner %q)", n, target, workspace, owner))
+    }
+    if err := rows.Err(); err != nil {
+        return Check{Name: name}, err
+    }
+    return newCheck(name, CheckWarn, problems), nil
+}
@@ -0,0 +1,70 @@
+package datastore
+
+import (
+    "context"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestDoctor(t *testing.T) {
+    dbPath := filepath.Join(t.TempDir(), "snapurl.db")
+    db, err := OpenDB(dbPath)
+    if err != nil {
+        t.Fatalf("OpenDB: %v", err)
+    }
+    defer db.Close()
+    ctx := context.Background()
+
+    // 1) A freshly migrated database is healthy and can be maintained
+    report, err := Doctor(ctx, db, DoctorOptions{Vacuum: true, Analyze: true})
+    if err != nil {
+        t.Fatalf("Doctor: %v", err)
+    }
+    if !report.OK || report.Path != dbPath || report.Sizes.DB == 0 {
+        t.Fatalf("healthy DB: %+v", report)
+    }
+    for _, c := range report.Checks {
+        if c.Status != CheckOK {
+            t.Errorf("%s: %s %v", c.Name, c.Status, c.Problems)
+        }
+    }
+    if len(report.Maintenance) != 2 || report.SizesAfter == nil {
+        t.Errorf("maintenance: %v", report.Maintenance)
+    }
+
+    // 2) Drift and bad rows are reported and block maintenance
+    for _, stmt := range []string{
+        "DROP INDEX idx_links_normalized_url",
+        "INSERT INTO links (workspace_id, shortcode, target_url, normalized_url) VALUES (1, 'a', 'https://x.example', 'https://x.example')",
+        "INSERT INTO links (workspace_id, shortcode, target_url, normalized_url) VALUES (1, 'b', 'https://x.example', 'https://x.example')",
+        "INSERT INTO links (workspace_id, shortcode, target_url) VALUES (42, 'c', 'https://y.example')",
+        "INSERT INTO links_archive (id, workspace_id, shortcode, target_url, archived_at) VALUES (99, 42, 'd', 'https://z.example', CURRENT_TIMESTAMP)",
+    } {
+        if _, err := db.Exec(stmt); err != nil {
+            t.Fatalf("%s: %v", stmt, err)
+        }
+    }
+    report, err = Doctor(ctx, db, DoctorOptions{Vacuum: true})
+    if err != nil {
+        t.Fatalf("Doctor: %v", err)
+    }
+    if report.OK || len(report.Maintenance) != 0 {
+        t.Errorf("broken DB: ok=%v maintenance=%v", report.OK, report.Maintenance)
+    }
+    want := map[string]string{
+        "foreign_key_check": CheckFail,
+        "schema_objects":    "missing index idx_links_normalized_url",
+        "orphaned_rows":     CheckWarn,
+        "duplicate_targets": "2 links to https://x.example",
+    }
+    for _, c := range report.Checks {
+        expect, ok := want[c.Name]
+        if !ok {
+            continue
+        }
+        if c.Status == CheckOK || (expect != CheckFail && expect != CheckWarn && !strings.Contains(strings.Join(c.Problems, "\n"), expect)) {
+            t.Errorf("%s: want %q, got %s %v", c.Name, expect, c.Status, c.Problems)
+        }
+    }
+}
@@ -3,11 +3,17 @@ package datastore
 import (
     "database/sql"
     "embed"
+    "errors"
     "fmt"
     "io/fs"
+    "os"
     "path"
+    "path/filepath"
+    "regexp"
     "sort"
+    "strconv"
     "strings"
+    "time"
 )
 
 // Embed all SQL files under migrations/
@@ -15,45 +21,394 @@ import (
 //go:embed migrations/*.sql
 var migrationsFS embed.FS
 
-// RunMigrations applies all pending .sql files in order, ignoring
-// duplicate-column errors so it can be run idempotently.
-func RunMigrations(db *sql.DB) error {
-    const migrationsDir = "migrations"
+const migrationsDir = "migrations"
+
+// downSuffix marks the file that reverts the migration of the same name.
+const downSuffix = ".down.sql"
+
+// ErrSchemaBehind is returned by CheckSchema when migrations are pending.
+var ErrSchemaBehind = errors.New("database schema is behind")
+
+// Migration describes one migration and whether it has been applied.
+type Migration struct {
+    Version    int
+    Name       string // file name, e.g. "0007_link_dedup.sql"
+    Applied    bool
+    AppliedAt  sql.NullTime
+    Reversible bool // a .down.sql file exists
+    // Unknown is set for applied migrations this binary has no file for,
+    // i.e. the database was migrated by a newer version.
+    Unknown bool
+}
+
+// migrationVersion parses the numeric prefix of a migration file name.
+func migrationVersion(name string) (int, error) {
+    prefix, _, ok := strings.Cut(name, "_")
+    if !ok {
+        return 0, fmt.Errorf("migration %s: missing version prefix", name)
+    }
+    v, err := strconv.Atoi(prefix)
+    if err != nil {
+        return 0, fmt.Errorf("migration %s: invalid version %q", name, prefix)
+    }
+    return v, nil
+}
 
-    // Read the embedded migrations directory
+// embeddedMigrations lists the up migrations shipped with the binary,
+// oldest first.
+func embeddedMigrations() ([]Migration, error) {
     entries, err := fs.ReadDir(migrationsFS, migrationsDir)
     if err != nil {
-        return fmt.Errorf("read migrations dir: %w", err)
+        return nil, fmt.Errorf("read migrations dir: %w", err)
+    }
+    files := map[string]bool{}
+    for _, e := range entries {
+        files[e.Name()] = true
     }
 
-    // Sort so migrations run in lexicographical order
-    sort.Slice(entries, func(i, j int) bool {
-        return entries[i].Name() < entries[j].Name()
+    var migrations []Migration
+    for _, e := range entries {
+        name := e.Name()
+        if !strings.HasSuffix(name, ".sql") || strings.HasSuffix(name, downSuffix) {
+            continue
+        }
+        v, err := migrationVersion(name)
+        if err != nil {
+            return nil, err
+        }
+        migrations = append(migrations, Migration{
+            Version:    v,
+            Name:       name,
+            Reversible: files[downName(name)],
+        })
+    }
+    sort.Slice(migrations, func(i, j int) bool {
+        return migrations[i].Name < migrations[j].Name
     })
+    return migrations, nil
+}
+
+func downName(name string) string {
+    return strings.TrimSuffix(name, ".sql") + downSuffix
+}
+
+// MigrationStatus lists every known migration, applied or pending, oldest
+// first. It does not modify the database.
+func MigrationStatus(db *sql.DB) ([]Migration, error) {
+    migrations, err := embeddedMigrations()
+    if err != nil {
+        return nil, err
+    }
+    applied, err := appliedMigrations(db)
+    if err != nil {
+        return nil, err
+    }
 
-    // Execute each .sql file
-    for _, entry := range entries {
-        name := entry.Name()
-        if !strings.HasSuffix(name, ".sql") {
+    for i, m := range migrations {
+        if at, ok := applied[m.Name]; ok {
+            migrations[i].Applied = true
+            migrations[i].AppliedAt = at
+            delete(applied, m.Name)
+        }
+    }
+    for name, at := range applied {
+        v, _ := migrationVersion(name)
+        migrations = append(migrations, Migration{Version: v, Name: name, Applied: true, AppliedAt: at, Unknown: true})
+    }
+    sort.Slice(migrations, func(i, j int) bool {
+        return migrations[i].Name < migrations[j].Name
+    })
+    return migrations, nil
+}
+
+// CheckSchema returns an error wrapping ErrSchemaBehind when the binary
+// has migrations the database has not applied yet.
+func CheckSchema(db *sql.DB) error {
+    migrations, err := MigrationStatus(db)
+    if err != nil {
+        return err
+    }
+    var pending []string
+    for _, m := range migrations {
+        if !m.Applied {
+            pending = append(pending, m.Name)
+        }
+    }
+    if len(pending) > 0 {
+        return fmt.Errorf("%w: %d pending migration(s): %s", ErrSchemaBehind, len(pending), strings.Join(pending, ", "))
+    }
+    return nil
+}
+
+// RunMigrations applies all pending .sql files in order. Applied files are
+// recorded in schema_migrations so each one runs exactly once. Databases
+// created before that table existed re-run the early migrations, which are
+// idempotent: duplicate-column errors are ignored.
+func RunMigrations(db *sql.DB) error {
+    _, err := MigrateUp(db, 0)
+    return err
+}
+
+// MigrateUp applies pending migrations up to and including version target,
+// or all of them for a target of 0. It returns the names of the migrations
+// it applied.
+func MigrateUp(db *sql.DB, target int) ([]string, error) {
+    if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+        version TEXT PRIMARY KEY,
+        applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    )`); err != nil {
+        return nil, fmt.Errorf("create schema_migrations: %w", err)
+    }
+
+    migrations, err := MigrationStatus(db)
+    if err != nil {
+        return nil, err
+    }
+
+    var done []string
+    for _, m := range migrations {
+        if m.Applied || (target > 0 && m.Version > target) {
             continue
         }
 
         // Build the embedded path (always with forward slashes)
-        p := path.Join(migrationsDir, name)
+        sqlBytes, err := migrationsFS.ReadFile(path.Join(migrationsDir, m.Name))
+        if err != nil {
+            return done, fmt.Errorf("read migration %s: %w", m.Name, err)
+        }
+        if err := applyMigration(db, m.Name, string(sqlBytes)); err != nil {
+            return done, fmt.Errorf("exec migration %s: %w", m.Name, err)
+        }
+        done = append(done, m.Name)
+    }
+    return done, nil
+}
+
+// MigrateDown reverts applied migrations newer than version target, newest
+// first, and returns their names. Nothing is reverted unless every one of
+// them has a .down.sql file.
+func MigrateDown(db *sql.DB, target int) ([]string, error) {
+    migrations, err := MigrationStatus(db)
+    if err != nil {
+        return nil, err
+    }
 
-        sqlBytes, err := migrationsFS.ReadFile(p)
+    var revert []Migration
+    for i := len(migrations) - 1; i >= 0; i-- {
+        m := migrations[i]
+        if !m.Applied || m.Version <= target {
+            continue
+        }
+        if m.Unknown {
+            return nil, fmt.Errorf("migration %s is not known to this binary", m.Name)
+        }
+        if !m.Reversible {
+            return nil, fmt.Errorf("migration %s cannot be reverted: no %s", m.Name, downName(m.Name))
+        }
+        revert = append(revert, m)
+    }
+
+    var done []string
+    for _, m := range revert {
+        sqlBytes, err := migrationsFS.ReadFile(path.Join(migrationsDir, downName(m.Name)))
         if err != nil {
-            return fmt.Errorf("read migration %s: %w", name, err)
+            return done, fmt.Errorf("read migration %s: %w", downName(m.Name), err)
+        }
+        if err := revertMigration(db, m.Name, string(sqlBytes)); err != nil {
+            return done, fmt.Errorf("revert migration %s: %w", m.Name, err)
         }
+        done = append(done, m.Name)
+    }
+    return done, nil
+}
+
+// appliedMigrations returns the recorded migration file names and when
+// they were applied. A database without schema_migrations has none.
+func appliedMigrations(db *sql.DB) (map[string]sql.NullTime, error) {
+    applied := make(map[string]sql.NullTime)
+
+    var n int
+    if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'").Scan(&n); err != nil {
+        return nil, fmt.Errorf("query schema_migrations: %w", err)
+    }
+    if n == 0 {
+        return applied, nil
+    }
+
+    rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+    if err != nil {
+        return nil, fmt.Errorf("query schema_migrations: %w", err)
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var version string
+        var at sql.NullTime
+        if err := rows.Scan(&version, &at); err != nil {
+            return nil, fmt.Errorf("scan schema_migrations: %w", err)
+        }
+        applied[version] = at
+    }
+    return applied, rows.Err()
+}
+
+// applyMigration runs one migration file and records it in a single
+// transaction.
+func applyMigration(db *sql.DB, name, script string) error {
+    err := execMigration(db, name, script, false)
+    if err != nil && isDuplicateColumn(err) {
+        // An "ALTER TABLE ... ADD COLUMN" that was applied before tracking
+        // existed: run the file again one statement at a time, skipping
+        // only the columns that are already there.
+        err = execMigration(db, name, script, true)
+    }
+    return err
+}
+
+func execMigration(db *sql.DB, name, script string, stepwise bool) error {
+    tx, err := db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    if !stepwise {
+        if _, err := tx.Exec(script); err != nil {
+            return err
+        }
+    } else {
+        for _, stmt := range splitStatements(script) {
+            _, err := tx.Exec(stmt)
+            if err != nil && !(isDuplicateColumn(err) && isAddColumn(stmt)) {
+                return err
+            }
+        }
+    }
+
+    if _, err := tx.Exec("INSERT INTO schema_migrations (version) VALUES (?)", name); err != nil {
+        return err
+    }
+    return tx.Commit()
+}
+
+func isDuplicateColumn(err error) bool {
+    return strings.Contains(err.Error(), "duplicate column name")
+}
+
+var addColumn = regexp.MustCompile(`(?is)^\s*ALTER\s+TABLE\s+.+\s+ADD\s+(COLUMN\s+)?`)
 
-        if _, err := db.Exec(string(sqlBytes)); err != nil {
-            // If it's an "ALTER TABLE ... ADD COLUMN" that's already been applied, skip it
-            if strings.Contains(err.Error(), "duplicate column name") {
+func isAddColumn(stmt string) bool {
+    return addColumn.MatchString(stmt)
+}
+
+// splitStatements splits a script on the semicolons that end statements,
+// ignoring those in quotes and comments, and drops the comments. It does
+// not understand CREATE TRIGGER bodies.
+func splitStatements(script string) []string {
+    var stmts []string
+    var cur strings.Builder
+    flush := func() {
+        if stmt := strings.TrimSpace(cur.String()); stmt != "" {
+            stmts = append(stmts, stmt)
+        }
+        cur.Reset()
+    }
+    for i := 0; i < len(script); i++ {
+        c := script[i]
+        switch {
+        case c == '\'' || c == '"' || c == '`':
+            end := strings.IndexByte(script[i+1:], c)
+            if end < 0 {
+                cur.WriteString(script[i:])
+                i = len(script)
                 continue
             }
-            return fmt.Errorf("exec migration %s: %w", name, err)
+            cur.WriteString(script[i : i+end+2])
+            i += end + 1
+        case strings.HasPrefix(script[i:], "--"):
+            end := strings.IndexByte(script[i:], '\n')
+            if end < 0 {
+                end = len(script) - i
+            }
+            i += end - 1
+        case strings.HasPrefix(script[i:], "/*"):
+            end := strings.Index(script[i+2:], "*/")
+            if end < 0 {
+                end = len(script) - i - 2
+            }
+            i += end + 3
+        case c == ';':
+            flush()
+        default:
+            cur.WriteByte(c)
         }
     }
+    flush()
+    return stmts
+}
 
-    return nil
+// revertMigration runs a down file and forgets the migration in a single
+// transaction.
+func revertMigration(db *sql.DB, name, script string) error {
+    tx, err := db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.Exec(script); err != nil {
+        return err
+    }
+    if _, err := tx.Exec("DELETE FROM schema_migrations WHERE version = ?", name); err != nil {
+        return err
+    }
+    return tx.Commit()
+}
+
+var nonSlug = regexp.MustCompile(`[^a-z0-9]+`)
+
+// CreateMigration writes an empty up and down migration to dir, numbered
+// after the newest file there, and returns their paths.
+func CreateMigration(dir, name string) (string, string, error) {
+    slug := strings.Trim(nonSlug.ReplaceAllString(strings.ToLower(name), "_"), "_")
+    if slug == "" {
+        return "", "", fmt.Errorf("invalid migration name %q", name)
+    }
+
+    entries, err := os.ReadDir(dir)
+    if err != nil {
+        return "", "", fmt.Errorf("read migrations dir: %w", err)
+    }
+    next := 1
+    for _, e := range entries {
+        if v, err := migrationVersion(e.Name()); err == nil && v >= next {
+            next = v + 1
+        }
+    }
+
+    base := fmt.Sprintf("%04d_%s", next, slug)
+    up := filepath.Join(dir, base+".sql")
+    down := filepath.Join(dir, base+downSuffix)
+    created := time.Now().UTC().Format(time.RFC3339)
+    if err := writeNew(up, fmt.Sprintf("-- %s (created %s)\n", name, created)); err != nil {
+        return "", "", err
+    }
+    if err := writeNew(down, fmt.Sprintf("-- Reverts %s.sql\n", base)); err != nil {
+        os.Remove(up)
+        return "", "", err
+    }
+    return up, down, nil
+}
+
+// writeNew creates a file that must not exist yet.
+func writeNew(path, content string) error {
+    f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+    if err != nil {
+        return err
+    }
+    if _, err := f.WriteString(content); err != nil {
+        f.Close()
+        return err
+    }
+    return f.Close()
 }
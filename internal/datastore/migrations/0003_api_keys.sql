@@ -0,0 +1,11 @@
+-- Stores API keys managed through /api/v1/keys (only the hash of the secret)
+CREATE TABLE IF NOT EXISTS api_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL DEFAULT '',
+    prefix TEXT NOT NULL,
+    key_hash TEXT UNIQUE NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NULL,
+    revoked BOOLEAN DEFAULT 0,
+    rotated_from INTEGER NULL REFERENCES api_keys(id)
+);
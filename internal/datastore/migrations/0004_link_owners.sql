@@ -0,0 +1,14 @@
+-- Adds link ownership and API key scopes
+ALTER TABLE links
+ADD COLUMN owner_id TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE api_keys
+ADD COLUMN owner_id TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE api_keys
+ADD COLUMN scope TEXT NOT NULL DEFAULT 'user';
+
+CREATE INDEX IF NOT EXISTS idx_links_owner_id ON links (owner_id);
+
+-- Keys created before ownership existed each become their own owner
+UPDATE api_keys SET owner_id = 'key-' || id WHERE owner_id = '';
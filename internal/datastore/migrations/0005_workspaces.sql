@@ -0,0 +1,43 @@
+-- Adds workspaces, each with its own host names and shortcode namespace
+CREATE TABLE IF NOT EXISTS workspaces (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT UNIQUE NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT OR IGNORE INTO workspaces (id, name) VALUES (1, 'default');
+
+CREATE TABLE IF NOT EXISTS workspace_domains (
+    host TEXT PRIMARY KEY,
+    workspace_id INTEGER NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_workspace_domains_workspace_id ON workspace_domains (workspace_id);
+
+-- Shortcodes become unique per workspace instead of globally, which needs
+-- a table rebuild in SQLite
+CREATE TABLE links_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    workspace_id INTEGER NOT NULL DEFAULT 1 REFERENCES workspaces(id),
+    shortcode TEXT NOT NULL,
+    target_url TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    hits INTEGER DEFAULT 0,
+    expires_at TIMESTAMP NULL,
+    revoked BOOLEAN DEFAULT 0,
+    owner_id TEXT NOT NULL DEFAULT '',
+    UNIQUE (workspace_id, shortcode)
+);
+
+INSERT INTO links_new (id, shortcode, target_url, created_at, hits, expires_at, revoked, owner_id)
+SELECT id, shortcode, target_url, created_at, hits, expires_at, revoked, owner_id FROM links;
+
+DROP TABLE links;
+ALTER TABLE links_new RENAME TO links;
+
+CREATE INDEX idx_links_owner_id ON links (owner_id);
+
+-- Keys bound to a workspace always create links there
+ALTER TABLE api_keys
+ADD COLUMN workspace_id INTEGER NULL REFERENCES workspaces(id);
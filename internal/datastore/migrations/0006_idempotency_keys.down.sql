@@ -0,0 +1,3 @@
+-- Reverts 0006_idempotency_keys.sql; stored responses are lost
+DROP INDEX IF EXISTS idx_idempotency_keys_created_at;
+DROP TABLE IF EXISTS idempotency_keys;
@@ -0,0 +1,5 @@
+-- Reverts 0007_link_dedup.sql
+DROP INDEX IF EXISTS idx_links_normalized_url;
+
+ALTER TABLE links
+DROP COLUMN normalized_url;
@@ -0,0 +1,9 @@
+-- Normalized target URL used to find existing links for reuse
+ALTER TABLE links
+ADD COLUMN normalized_url TEXT NOT NULL DEFAULT '';
+
+-- Older rows keep an empty normalized_url: SQL cannot normalize URLs, so
+-- the server fills them in with service.BackfillNormalizedURLs on startup.
+-- Until then they are not reused.
+
+CREATE INDEX IF NOT EXISTS idx_links_normalized_url ON links (normalized_url, owner_id, workspace_id);
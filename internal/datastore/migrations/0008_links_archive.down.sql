@@ -0,0 +1,8 @@
+-- Reverts 0008_links_archive.sql; archived links are lost
+DROP INDEX IF EXISTS idx_links_revoked;
+DROP INDEX IF EXISTS idx_links_expires_at;
+DROP INDEX IF EXISTS idx_links_archive_shortcode;
+DROP TABLE IF EXISTS links_archive;
+
+ALTER TABLE links
+DROP COLUMN revoked_at;
@@ -0,0 +1,28 @@
+-- When a link was revoked, so old revoked links can be cleaned up
+ALTER TABLE links
+ADD COLUMN revoked_at TIMESTAMP NULL;
+
+-- Links revoked before this column existed count from the upgrade
+UPDATE links SET revoked_at = CURRENT_TIMESTAMP WHERE revoked = 1 AND revoked_at IS NULL;
+
+-- Expired and revoked links moved out of links by the janitor
+CREATE TABLE IF NOT EXISTS links_archive (
+    id INTEGER PRIMARY KEY,
+    workspace_id INTEGER NOT NULL,
+    shortcode TEXT NOT NULL,
+    target_url TEXT NOT NULL,
+    normalized_url TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP,
+    hits INTEGER DEFAULT 0,
+    expires_at TIMESTAMP NULL,
+    revoked BOOLEAN DEFAULT 0,
+    revoked_at TIMESTAMP NULL,
+    owner_id TEXT NOT NULL DEFAULT '',
+    archived_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_links_archive_shortcode ON links_archive (workspace_id, shortcode);
+
+-- Serve the active link count and the janitor without full table scans
+CREATE INDEX IF NOT EXISTS idx_links_expires_at ON links (expires_at) WHERE expires_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_links_revoked ON links (revoked, revoked_at);
@@ -0,0 +1,15 @@
+-- Reverts 0009_revocation_details.sql
+ALTER TABLE links_archive
+DROP COLUMN revoked_by;
+
+ALTER TABLE links_archive
+DROP COLUMN revoked_reason;
+
+ALTER TABLE links
+DROP COLUMN revoked_reason_public;
+
+ALTER TABLE links
+DROP COLUMN revoked_by;
+
+ALTER TABLE links
+DROP COLUMN revoked_reason;
@@ -0,0 +1,16 @@
+-- Why and by whom a link was revoked, and whether the reason is shown to
+-- visitors of the revoked link
+ALTER TABLE links
+ADD COLUMN revoked_reason TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE links
+ADD COLUMN revoked_by TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE links
+ADD COLUMN revoked_reason_public BOOLEAN NOT NULL DEFAULT 0;
+
+ALTER TABLE links_archive
+ADD COLUMN revoked_reason TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE links_archive
+ADD COLUMN revoked_by TEXT NOT NULL DEFAULT '';
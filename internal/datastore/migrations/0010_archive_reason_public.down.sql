@@ -0,0 +1,3 @@
+-- Reverts 0010_archive_reason_public.sql
+ALTER TABLE links_archive
+DROP COLUMN revoked_reason_public;
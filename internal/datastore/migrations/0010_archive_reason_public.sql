@@ -0,0 +1,3 @@
+-- Archived links keep whether their revocation reason was public
+ALTER TABLE links_archive
+ADD COLUMN revoked_reason_public BOOLEAN NOT NULL DEFAULT 0;
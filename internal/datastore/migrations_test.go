@@ -0,0 +1,122 @@
+package datastore
+
+import (
+    "database/sql"
+    "errors"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestMigrateUpAndDown(t *testing.T) {
+    db, err := sql.Open("sqlite3", ":memory:")
+    if err != nil {
+        t.Fatalf("open DB: %v", err)
+    }
+    defer db.Close()
+
+    // 1) A new database has everything pending
+    if err := CheckSchema(db); !errors.Is(err, ErrSchemaBehind) {
+        t.Fatalf("CheckSchema on empty DB: want ErrSchemaBehind, got %v", err)
+    }
+    all, err := MigrationStatus(db)
+    if err != nil {
+        t.Fatalf("MigrationStatus: %v", err)
+    }
+    latest := all[len(all)-1].Version
+
+    // 2) Up to a target version, then the rest
+    done, err := MigrateUp(db, 5)
+    if err != nil || len(done) != 5 {
+        t.Fatalf("MigrateUp(5): %v, %v", done, err)
+    }
+    if _, err := MigrateUp(db, 0); err != nil {
+        t.Fatalf("MigrateUp: %v", err)
+    }
+    if err := CheckSchema(db); err != nil {
+        t.Fatalf("CheckSchema after up: %v", err)
+    }
+
+    // 3) Down reverts newest first and the schema can be rebuilt
+    db.Exec("INSERT INTO links (shortcode, target_url) VALUES ('keep', 'https://a.example')")
+    done, err = MigrateDown(db, 5)
+    if err != nil {
+        t.Fatalf("MigrateDown(5): %v", err)
+    }
+    if len(done) != latest-5 || !strings.HasPrefix(done[0], "0010") {
+        t.Errorf("MigrateDown(5): reverted %v", done)
+    }
+    if _, err := db.Exec("SELECT normalized_url FROM links"); err == nil {
+        t.Error("normalized_url still exists after reverting 0007")
+    }
+    if _, err := MigrateUp(db, 0); err != nil {
+        t.Fatalf("MigrateUp after down: %v", err)
+    }
+    var n int
+    db.QueryRow("SELECT COUNT(*) FROM links WHERE shortcode = 'keep'").Scan(&n)
+    if n != 1 {
+        t.Error("link lost across down and up")
+    }
+
+    // 4) Irreversible migrations stop down before anything is reverted
+    if _, err := MigrateDown(db, 3); err == nil {
+        t.Fatal("MigrateDown past an irreversible migration: want error")
+    }
+    if err := CheckSchema(db); err != nil {
+        t.Errorf("failed down must not revert anything: %v", err)
+    }
+}
+
+func TestCreateMigration(t *testing.T) {
+    dir := t.TempDir()
+    os.WriteFile(filepath.Join(dir, "0041_old.sql"), nil, 0o644)
+
+    up, down, err := CreateMigration(dir, "Add click log!")
+    if err != nil {
+        t.Fatalf("CreateMigration: %v", err)
+    }
+    if filepath.Base(up) != "0042_add_click_log.sql" || filepath.Base(down) != "0042_add_click_log.down.sql" {
+        t.Errorf("CreateMigration: got %s, %s", up, down)
+    }
+    if _, _, err := CreateMigration(dir, "!!"); err == nil {
+        t.Error("CreateMigration with empty name: want error")
+    }
+}
+
+func TestMigrateUpPreTrackingColumns(t *testing.T) {
+    db, err := sql.Open("sqlite3", ":memory:")
+    if err != nil {
+        t.Fatalf("open DB: %v", err)
+    }
+    defer db.Close()
+    db.SetMaxOpenConns(1)
+
+    // A database from before schema_migrations, where only the first
+    // column of 0002 had been added
+    if _, err := MigrateUp(db, 1); err != nil {
+        t.Fatalf("MigrateUp(1): %v", err)
+    }
+    if _, err := db.Exec("ALTER TABLE links ADD COLUMN expires_at TIMESTAMP NULL"); err != nil {
+        t.Fatal(err)
+    }
+
+    if _, err := MigrateUp(db, 0); err != nil {
+        t.Fatalf("MigrateUp: %v", err)
+    }
+    if _, err := db.Exec("SELECT revoked FROM links"); err != nil {
+        t.Errorf("statement after the duplicate column was skipped: %v", err)
+    }
+    if err := CheckSchema(db); err != nil {
+        t.Errorf("CheckSchema: %v", err)
+    }
+}
+
+func TestSplitStatements(t *testing.T) {
+    script := "-- comment; not a statement\nCREATE TABLE t (a TEXT DEFAULT ';');\n/* x; */ INSERT INTO t VALUES ('it''s;');\n"
+    got := splitStatements(script)
+    want := []string{"CREATE TABLE t (a TEXT DEFAULT ';')", "INSERT INTO t VALUES ('it''s;')"}
+    if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+        t.Errorf("splitStatements = %q, want %q", got, want)
+    }
+}
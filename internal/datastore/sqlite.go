@@ -3,14 +3,36 @@ package datastore
 import (
     "database/sql"
     "fmt"
+    "net/url"
     "os"
     "path/filepath"
+    "runtime"
+    "strconv"
+    "time"
 
     _ "github.com/mattn/go-sqlite3"
+    "github.com/valorm/snapurl/internal/config"
 )
 
 // OpenDB opens (or creates) the SQLite file at `path` and runs migrations.
 func OpenDB(path string) (*sql.DB, error) {
+    db, err := Open(path)
+    if err != nil {
+        return nil, err
+    }
+
+    // Run all migrations
+    if err := RunMigrations(db); err != nil {
+        db.Close()
+        return nil, fmt.Errorf("run migrations: %w", err)
+    }
+
+    return db, nil
+}
+
+// Open opens (or creates) the SQLite file at `path` without migrating it.
+// Use CheckSchema to make sure the schema is current.
+func Open(path string) (*sql.DB, error) {
     // Ensure parent directory exists
     dir := filepath.Dir(path)
     if err := os.MkdirAll(dir, 0o755); err != nil {
@@ -21,12 +43,153 @@ func OpenDB(path string) (*sql.DB, error) {
     if err != nil {
         return nil, fmt.Errorf("open sqlite db: %w", err)
     }
+    return db, nil
+}
 
-    // Run all migrations
-    if err := RunMigrations(db); err != nil {
-        db.Close()
-        return nil, fmt.Errorf("run migrations: %w", err)
+// Options tune the SQLite connections opened by Connect. Zero values leave
+// SQLite's or database/sql's defaults in place.
+type Options struct {
+    JournalMode string        // e.g. "WAL", "DELETE"
+    Synchronous string        // e.g. "NORMAL", "FULL"
+    BusyTimeout time.Duration // how long to wait for a lock before "database is locked"
+    CacheSizeKB int           // page cache per connection
+
+    // Read pool limits; the writer always has a single connection.
+    MaxReadConns    int
+    MaxIdleConns    int
+    ConnMaxLifetime time.Duration
+}
+
+// DefaultOptions are WAL with NORMAL sync, which is durable across
+// application crashes, and a five second busy timeout.
+func DefaultOptions() Options {
+    return Options{
+        JournalMode:  "WAL",
+        Synchronous:  "NORMAL",
+        BusyTimeout:  5 * time.Second,
+        MaxReadConns: runtime.NumCPU(),
+        MaxIdleConns: 2,
     }
+}
 
-    return db, nil
+// ConfigOptions returns the connection options set in cfg, with
+// DefaultOptions for the ones left empty.
+func ConfigOptions(cfg *config.Config) Options {
+    opts := DefaultOptions()
+    if cfg.DBJournalMode != "" {
+        opts.JournalMode = cfg.DBJournalMode
+    }
+    if cfg.DBSynchronous != "" {
+        opts.Synchronous = cfg.DBSynchronous
+    }
+    if cfg.DBBusyTimeout > 0 {
+        opts.BusyTimeout = cfg.DBBusyTimeout
+    }
+    if cfg.DBCacheSizeKB > 0 {
+        opts.CacheSizeKB = cfg.DBCacheSizeKB
+    }
+    if cfg.DBMaxReadConns > 0 {
+        opts.MaxReadConns = cfg.DBMaxReadConns
+    }
+    if cfg.DBMaxIdleConns > 0 {
+        opts.MaxIdleConns = cfg.DBMaxIdleConns
+    }
+    opts.ConnMaxLifetime = cfg.DBConnMaxLifetime
+    return opts
+}
+
+// DB holds the two connection pools of a database. SQLite allows a single
+// writer at a time, so writes go through one connection and wait on its
+// pool instead of failing with "database is locked"; reads use their own
+// pool, which WAL lets run alongside the writer.
+type DB struct {
+    Write *sql.DB
+    Read  *sql.DB
+}
+
+// Single wraps one pool for both reads and writes, e.g. for in-memory
+// databases, which cannot be shared between pools.
+func Single(db *sql.DB) *DB {
+    return &DB{Write: db, Read: db}
+}
+
+// Close closes both pools.
+func (d *DB) Close() error {
+    err := d.Write.Close()
+    if d.Read != d.Write {
+        if rerr := d.Read.Close(); err == nil {
+            err = rerr
+        }
+    }
+    return err
+}
+
+// Connect opens the SQLite file at path (creating it if needed) with a
+// writer connection and a read-only pool tuned by opts. It does not run
+// migrations.
+func Connect(path string, opts Options) (*DB, error) {
+    if path != ":memory:" {
+        if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+            return nil, fmt.Errorf("create data dir: %w", err)
+        }
+    }
+
+    params := url.Values{}
+    if opts.JournalMode != "" {
+        params.Set("_journal_mode", opts.JournalMode)
+    }
+    if opts.Synchronous != "" {
+        params.Set("_synchronous", opts.Synchronous)
+    }
+    if opts.BusyTimeout > 0 {
+        params.Set("_busy_timeout", strconv.FormatInt(opts.BusyTimeout.Milliseconds(), 10))
+    }
+    if opts.CacheSizeKB > 0 {
+        // Negative sizes are in KiB rather than pages
+        params.Set("_cache_size", strconv.Itoa(-opts.CacheSizeKB))
+    }
+
+    // Take the write lock when a transaction starts, so it never has to be
+    // upgraded later (which fails immediately instead of waiting)
+    wparams := cloneValues(params)
+    wparams.Set("_txlock", "immediate")
+    write, err := sql.Open("sqlite3", path+"?"+wparams.Encode())
+    if err != nil {
+        return nil, fmt.Errorf("open sqlite db: %w", err)
+    }
+    write.SetMaxOpenConns(1)
+    write.SetMaxIdleConns(1)
+    write.SetConnMaxLifetime(0)
+    if err := write.Ping(); err != nil {
+        write.Close()
+        return nil, fmt.Errorf("open sqlite db: %w", err)
+    }
+    if path == ":memory:" {
+        return Single(write), nil
+    }
+
+    rparams := cloneValues(params)
+    rparams.Set("_query_only", "true")
+    read, err := sql.Open("sqlite3", path+"?"+rparams.Encode())
+    if err != nil {
+        write.Close()
+        return nil, fmt.Errorf("open sqlite read pool: %w", err)
+    }
+    if opts.MaxReadConns > 0 {
+        read.SetMaxOpenConns(opts.MaxReadConns)
+    }
+    if opts.MaxIdleConns > 0 {
+        read.SetMaxIdleConns(opts.MaxIdleConns)
+    }
+    read.SetConnMaxLifetime(opts.ConnMaxLifetime)
+
+    return &DB{Write: write, Read: read}, nil
+}
+
+func cloneValues(v url.Values) url.Values {
+    out := url.Values{}
+    for k, vs := range v {
+        out[k] = append([]string(nil), vs...)
+    }
+    return out
 }
@@ -0,0 +1,77 @@
+package datastore
+
+import (
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+)
+
+func TestConnect(t *testing.T) {
+    store, err := Connect(filepath.Join(t.TempDir(), "snapurl.db"), DefaultOptions())
+    if err != nil {
+        t.Fatalf("Connect: %v", err)
+    }
+    defer store.Close()
+    if err := RunMigrations(store.Write); err != nil {
+        t.Fatalf("RunMigrations: %v", err)
+    }
+
+    // 1) Both pools see WAL and the busy timeout
+    var mode string
+    if err := store.Read.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil || mode != "wal" {
+        t.Fatalf("journal_mode = %q, %v; want wal", mode, err)
+    }
+    var timeout int
+    if err := store.Write.QueryRow("PRAGMA busy_timeout").Scan(&timeout); err != nil || timeout != 5000 {
+        t.Fatalf("busy_timeout = %d, %v; want 5000", timeout, err)
+    }
+
+    // 2) The read pool refuses writes
+    _, err = store.Read.Exec("INSERT INTO workspaces (name) VALUES ('nope')")
+    if err == nil || !strings.Contains(err.Error(), "readonly") {
+        t.Fatalf("write on read pool: want readonly error, got %v", err)
+    }
+
+    // 3) Concurrent writers and readers don't hit "database is locked"
+    if _, err := store.Write.Exec("CREATE TABLE counter (n INTEGER)"); err != nil {
+        t.Fatalf("create table: %v", err)
+    }
+    var wg sync.WaitGroup
+    errs := make(chan error, 100)
+    for i := 0; i < 50; i++ {
+        wg.Add(2)
+        go func(i int) {
+            defer wg.Done()
+            tx, err := store.Write.Begin()
+            if err != nil {
+                errs <- err
+                return
+            }
+            defer tx.Rollback()
+            if _, err := tx.Exec("INSERT INTO counter (n) VALUES (?)", i); err != nil {
+                errs <- err
+                return
+            }
+            if err := tx.Commit(); err != nil {
+                errs <- err
+            }
+        }(i)
+        go func() {
+            defer wg.Done()
+            var n int
+            if err := store.Read.QueryRow("SELECT COUNT(*) FROM counter").Scan(&n); err != nil {
+                errs <- err
+            }
+        }()
+    }
+    wg.Wait()
+    close(errs)
+    for err := range errs {
+        t.Errorf("concurrent access: %v", err)
+    }
+    var n int
+    if err := store.Read.QueryRow("SELECT COUNT(*) FROM counter").Scan(&n); err != nil || n != 50 {
+        t.Fatalf("rows = %d, %v; want 50", n, err)
+    }
+}
@@ -37,6 +37,15 @@ func (l *IPRateLimiter) GetLimiter(ip string) *rate.Limiter {
     return limiter
 }
 
+// SetRate changes the allowed requests per second. Existing buckets are
+// dropped so every IP starts over at the new rate.
+func (l *IPRateLimiter) SetRate(rps int) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    l.rps = rps
+    l.limiterMap = make(map[string]*rate.Limiter)
+}
+
 // Middleware wraps a handler to enforce rate limits
 func (l *IPRateLimiter) Middleware(next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
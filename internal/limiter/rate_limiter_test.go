@@ -32,3 +32,32 @@ func TestRateLimiting(t *testing.T) {
         t.Errorf("Expected 429, got %d", rr.Code)
     }
 }
+
+func TestSetRate(t *testing.T) {
+    limiter := NewIPRateLimiter(1)
+    handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusOK)
+    }))
+    req, _ := http.NewRequest("GET", "/", nil)
+    req.RemoteAddr = "192.168.1.1"
+
+    serve := func() int {
+        rr := httptest.NewRecorder()
+        handler.ServeHTTP(rr, req)
+        return rr.Code
+    }
+    if serve() != http.StatusOK || serve() != http.StatusTooManyRequests {
+        t.Fatal("Expected the second request to be limited at 1 RPS")
+    }
+
+    // The new rate applies at once, with a fresh bucket
+    limiter.SetRate(3)
+    for i := 0; i < 3; i++ {
+        if code := serve(); code != http.StatusOK {
+            t.Errorf("Request %d after SetRate: expected 200, got %d", i+1, code)
+        }
+    }
+    if code := serve(); code != http.StatusTooManyRequests {
+        t.Errorf("Expected 429, got %d", code)
+    }
+}
@@ -0,0 +1,63 @@
+// Package logging gates log output by a level that can be changed while the
+// server runs.
+package logging
+
+import (
+    "fmt"
+    "log"
+    "log/slog"
+    "strings"
+)
+
+var level slog.LevelVar // Info until SetLevel is called
+
+// ParseLevel accepts debug, info, warn or error; empty means info.
+func ParseLevel(name string) (slog.Level, error) {
+    switch strings.ToLower(name) {
+    case "debug":
+        return slog.LevelDebug, nil
+    case "", "info":
+        return slog.LevelInfo, nil
+    case "warn", "warning":
+        return slog.LevelWarn, nil
+    case "error":
+        return slog.LevelError, nil
+    }
+    return 0, fmt.Errorf("unknown log level %q", name)
+}
+
+// SetLevel changes the level; messages below it are dropped.
+func SetLevel(name string) error {
+    l, err := ParseLevel(name)
+    if err != nil {
+        return err
+    }
+    level.Set(l)
+    return nil
+}
+
+// Enabled reports whether messages at l are logged.
+func Enabled(l slog.Level) bool {
+    return l >= level.Level()
+}
+
+// Debugf logs details only needed when tracking down a problem.
+func Debugf(format string, args ...any) {
+    if Enabled(slog.LevelDebug) {
+        log.Printf(format, args...)
+    }
+}
+
+// Infof logs routine events such as served requests.
+func Infof(format string, args ...any) {
+    if Enabled(slog.LevelInfo) {
+        log.Printf(format, args...)
+    }
+}
+
+// Warnf logs problems the server recovered from.
+func Warnf(format string, args ...any) {
+    if Enabled(slog.LevelWarn) {
+        log.Printf(format, args...)
+    }
+}
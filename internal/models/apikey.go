@@ -0,0 +1,28 @@
+package models
+
+import (
+    "database/sql"
+    "time"
+)
+
+// Key scopes. Admin keys can manage keys and act on every link; user keys
+// only see links they own.
+const (
+    ScopeUser  = "user"
+    ScopeAdmin = "admin"
+)
+
+// APIKey is a database-managed API key. The secret itself is never stored,
+// only its SHA-256 hash and a short prefix for identification.
+type APIKey struct {
+    ID          int
+    Name        string
+    OwnerID     string
+    Scope       string
+    WorkspaceID int // 0 when the key is not bound to a workspace
+    Prefix      string
+    CreatedAt   time.Time
+    ExpiresAt   sql.NullTime
+    Revoked     bool
+    RotatedFrom sql.NullInt64
+}
@@ -6,11 +6,19 @@ import (
 )
 
 type Link struct {
-    ID         int
-    Shortcode  string
-    TargetURL  string
-    CreatedAt  time.Time
-    Hits       int
-    ExpiresAt  sql.NullTime
-    Revoked    bool
+    ID          int
+    WorkspaceID int
+    Shortcode   string
+    TargetURL   string
+    CreatedAt   time.Time
+    Hits        int
+    ExpiresAt   sql.NullTime
+    Revoked     bool
+    OwnerID     string
+
+    // Revocation details; empty unless Revoked
+    RevokedAt     sql.NullTime
+    RevokedReason string
+    RevokedBy     string
+    ReasonPublic  bool
 }
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// DefaultWorkspaceID is the workspace used for hosts that are not mapped
+// to any other workspace.
+const DefaultWorkspaceID = 1
+
+// Workspace is an independent shortcode namespace served on its own hosts.
+type Workspace struct {
+    ID        int
+    Name      string
+    CreatedAt time.Time
+    Domains   []string
+}
@@ -0,0 +1,249 @@
+package service
+
+import (
+    "crypto/sha256"
+    "database/sql"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "time"
+
+    "github.com/valorm/snapurl/internal/models"
+    "github.com/valorm/snapurl/pkg/util"
+)
+
+const (
+    apiKeyPrefix     = "snap_"
+    apiKeySecretLen  = 32
+    apiKeyDisplayLen = 12
+)
+
+var (
+    // ErrNotFound is returned when the requested record does not exist.
+    ErrNotFound = errors.New("not found")
+    // ErrKeyInactive is returned when rotating a revoked or expired key.
+    ErrKeyInactive = errors.New("api key is no longer active")
+)
+
+const apiKeyColumns = "id, name, owner_id, scope, COALESCE(workspace_id, 0), prefix, created_at, expires_at, revoked, rotated_from"
+
+// scanAPIKey reads a row selected with apiKeyColumns.
+func scanAPIKey(row interface{ Scan(...any) error }) (models.APIKey, error) {
+    var k models.APIKey
+    err := row.Scan(&k.ID, &k.Name, &k.OwnerID, &k.Scope, &k.WorkspaceID, &k.Prefix, &k.CreatedAt, &k.ExpiresAt, &k.Revoked, &k.RotatedFrom)
+    return k, err
+}
+
+// nullableID maps a zero id to NULL.
+func nullableID(id int) sql.NullInt64 {
+    return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
+
+// hashAPIKey returns the hex-encoded SHA-256 of a key secret.
+func hashAPIKey(secret string) string {
+    sum := sha256.Sum256([]byte(secret))
+    return hex.EncodeToString(sum[:])
+}
+
+// newAPIKeySecret generates a fresh secret and its display prefix.
+func newAPIKeySecret() (string, string, error) {
+    code, err := util.GenerateCode(apiKeySecretLen)
+    if err != nil {
+        return "", "", fmt.Errorf("generate key: %w", err)
+    }
+    secret := apiKeyPrefix + code
+    return secret, secret[:apiKeyDisplayLen], nil
+}
+
+// CreateAPIKey stores a new key and returns it together with its secret.
+// The secret is only available here; afterwards only its hash is kept.
+// Links created with the key belong to ownerID and, when workspaceID is
+// not zero, are always created in that workspace.
+func CreateAPIKey(db *sql.DB, name, ownerID, scope string, workspaceID int) (models.APIKey, string, error) {
+    if ownerID == "" {
+        return models.APIKey{}, "", fmt.Errorf("owner id must not be empty")
+    }
+    if scope != models.ScopeUser && scope != models.ScopeAdmin {
+        return models.APIKey{}, "", fmt.Errorf("unknown scope %q", scope)
+    }
+
+    secret, prefix, err := newAPIKeySecret()
+    if err != nil {
+        return models.APIKey{}, "", err
+    }
+
+    createdAt := time.Now().UTC()
+    res, err := db.Exec(
+        "INSERT INTO api_keys (name, owner_id, scope, workspace_id, prefix, key_hash, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+        name, ownerID, scope, nullableID(workspaceID), prefix, hashAPIKey(secret), createdAt,
+    )
+    if err != nil {
+        return models.APIKey{}, "", fmt.Errorf("insert api key: %w", err)
+    }
+
+    id, _ := res.LastInsertId()
+    key := models.APIKey{
+        ID:          int(id),
+        Name:        name,
+        OwnerID:     ownerID,
+        Scope:       scope,
+        WorkspaceID: workspaceID,
+        Prefix:      prefix,
+        CreatedAt:   createdAt,
+    }
+    return key, secret, nil
+}
+
+// ListAPIKeys returns all keys, including revoked and expired ones.
+func ListAPIKeys(db *sql.DB) ([]models.APIKey, error) {
+    rows, err := db.Query("SELECT " + apiKeyColumns + " FROM api_keys ORDER BY id")
+    if err != nil {
+        return nil, fmt.Errorf("query api keys: %w", err)
+    }
+    defer rows.Close()
+
+    keys := []models.APIKey{}
+    for rows.Next() {
+        k, err := scanAPIKey(rows)
+        if err != nil {
+            return nil, fmt.Errorf("scan api key: %w", err)
+        }
+        keys = append(keys, k)
+    }
+    return keys, rows.Err()
+}
+
+// HasAdminKey reports whether the database holds an admin key that is
+// neither revoked nor expired.
+func HasAdminKey(db *sql.DB) (bool, error) {
+    keys, err := ListAPIKeys(db)
+    if err != nil {
+        return false, err
+    }
+    for _, k := range keys {
+        if k.Scope == models.ScopeAdmin && !k.Revoked && (!k.ExpiresAt.Valid || k.ExpiresAt.Time.After(time.Now())) {
+            return true, nil
+        }
+    }
+    return false, nil
+}
+
+// RevokeAPIKey disables a key immediately.
+func RevokeAPIKey(db *sql.DB, id int) error {
+    res, err := db.Exec("UPDATE api_keys SET revoked = 1 WHERE id = ?", id)
+    if err != nil {
+        return fmt.Errorf("revoke api key: %w", err)
+    }
+    rows, err := res.RowsAffected()
+    if err != nil {
+        return fmt.Errorf("check rows affected: %w", err)
+    }
+    if rows == 0 {
+        return ErrNotFound
+    }
+    return nil
+}
+
+// OriginalAPIKeyID follows rotated_from back from key id to the key its
+// rotation chain started with, whose id stays the same across rotations.
+func OriginalAPIKeyID(db *sql.DB, id int) (int, error) {
+    var original int
+    err := db.QueryRow(
+        `WITH RECURSIVE chain(id, rotated_from) AS (
+            SELECT id, rotated_from FROM api_keys WHERE id = ?
+            UNION ALL
+            SELECT k.id, k.rotated_from FROM api_keys k JOIN chain c ON k.id = c.rotated_from
+         )
+         SELECT id FROM chain WHERE rotated_from IS NULL`,
+        id,
+    ).Scan(&original)
+    if err == sql.ErrNoRows {
+        return 0, ErrNotFound
+    }
+    if err != nil {
+        return 0, fmt.Errorf("query api key chain: %w", err)
+    }
+    return original, nil
+}
+
+// RotateAPIKey issues a replacement for key `id`. The old key keeps working
+// for `overlap` so clients can switch over without downtime.
+func RotateAPIKey(db *sql.DB, id int, overlap time.Duration) (models.APIKey, string, error) {
+    tx, err := db.Begin()
+    if err != nil {
+        return models.APIKey{}, "", fmt.Errorf("begin tx: %w", err)
+    }
+    defer tx.Rollback()
+
+    old, err := scanAPIKey(tx.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE id = ?", id))
+    if err == sql.ErrNoRows {
+        return models.APIKey{}, "", ErrNotFound
+    }
+    if err != nil {
+        return models.APIKey{}, "", fmt.Errorf("query api key: %w", err)
+    }
+
+    now := time.Now().UTC()
+    if old.Revoked || (old.ExpiresAt.Valid && !old.ExpiresAt.Time.After(now)) {
+        return models.APIKey{}, "", ErrKeyInactive
+    }
+
+    secret, prefix, err := newAPIKeySecret()
+    if err != nil {
+        return models.APIKey{}, "", err
+    }
+    res, err := tx.Exec(
+        "INSERT INTO api_keys (name, owner_id, scope, workspace_id, prefix, key_hash, created_at, rotated_from) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+        old.Name, old.OwnerID, old.Scope, nullableID(old.WorkspaceID), prefix, hashAPIKey(secret), now, id,
+    )
+    if err != nil {
+        return models.APIKey{}, "", fmt.Errorf("insert api key: %w", err)
+    }
+    newID, _ := res.LastInsertId()
+
+    // Never extend an expiry that is already sooner than the overlap window
+    oldExpiry := now.Add(overlap)
+    if !old.ExpiresAt.Valid || old.ExpiresAt.Time.After(oldExpiry) {
+        if _, err := tx.Exec("UPDATE api_keys SET expires_at = ? WHERE id = ?", oldExpiry, id); err != nil {
+            return models.APIKey{}, "", fmt.Errorf("expire old api key: %w", err)
+        }
+    }
+
+    if err := tx.Commit(); err != nil {
+        return models.APIKey{}, "", fmt.Errorf("commit rotation: %w", err)
+    }
+
+    key := models.APIKey{
+        ID:          int(newID),
+        Name:        old.Name,
+        OwnerID:     old.OwnerID,
+        Scope:       old.Scope,
+        WorkspaceID: old.WorkspaceID,
+        Prefix:      prefix,
+        CreatedAt:   now,
+        RotatedFrom: sql.NullInt64{Int64: int64(id), Valid: true},
+    }
+    return key, secret, nil
+}
+
+// AuthenticateAPIKey looks up an active key by its secret.
+func AuthenticateAPIKey(db *sql.DB, secret string) (models.APIKey, error) {
+    k, err := scanAPIKey(db.QueryRow(
+        "SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = ?",
+        hashAPIKey(secret),
+    ))
+    if err == sql.ErrNoRows {
+        return models.APIKey{}, ErrNotFound
+    }
+    if err != nil {
+        return models.APIKey{}, fmt.Errorf("query api key: %w", err)
+    }
+
+    if k.Revoked {
+        return models.APIKey{}, fmt.Errorf("api key revoked")
+    }
+    if k.ExpiresAt.Valid && !k.ExpiresAt.Time.After(time.Now()) {
+        return models.APIKey{}, fmt.Errorf("api key expired")
+    }
+    return k, nil
+}
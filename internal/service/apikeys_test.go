@@ -0,0 +1,117 @@
+package service
+
+import (
+    "database/sql"
+    "errors"
+    "testing"
+    "time"
+
+    _ "github.com/mattn/go-sqlite3"
+    "github.com/valorm/snapurl/internal/datastore"
+    "github.com/valorm/snapurl/internal/models"
+)
+
+func TestAPIKeyLifecycle(t *testing.T) {
+    db, err := sql.Open("sqlite3", ":memory:")
+    if err != nil {
+        t.Fatalf("open DB: %v", err)
+    }
+    defer db.Close()
+    if err := datastore.RunMigrations(db); err != nil {
+        t.Fatalf("migrations: %v", err)
+    }
+
+    // 1) Create and authenticate
+    key, secret, err := CreateAPIKey(db, "ci", "team-a", models.ScopeUser, 0)
+    if err != nil {
+        t.Fatalf("CreateAPIKey: %v", err)
+    }
+    if secret == "" || key.Prefix == "" {
+        t.Fatal("empty secret or prefix")
+    }
+    if _, err := AuthenticateAPIKey(db, secret); err != nil {
+        t.Fatalf("AuthenticateAPIKey: %v", err)
+    }
+    if _, err := AuthenticateAPIKey(db, "snap_wrong"); !errors.Is(err, ErrNotFound) {
+        t.Fatalf("unknown key: want ErrNotFound, got %v", err)
+    }
+
+    // 2) Rotate with overlap: both keys work
+    rotated, newSecret, err := RotateAPIKey(db, key.ID, time.Hour)
+    if err != nil {
+        t.Fatalf("RotateAPIKey: %v", err)
+    }
+    if !rotated.RotatedFrom.Valid || int(rotated.RotatedFrom.Int64) != key.ID {
+        t.Errorf("rotated_from: want %d, got %+v", key.ID, rotated.RotatedFrom)
+    }
+    if rotated.OwnerID != "team-a" || rotated.Scope != models.ScopeUser {
+        t.Errorf("rotation must keep owner and scope, got %q/%q", rotated.OwnerID, rotated.Scope)
+    }
+    if _, err := AuthenticateAPIKey(db, secret); err != nil {
+        t.Errorf("old key within overlap: %v", err)
+    }
+    if _, err := AuthenticateAPIKey(db, newSecret); err != nil {
+        t.Errorf("new key: %v", err)
+    }
+
+    // 3) Rotate without overlap: old key stops working immediately
+    _, newest, err := RotateAPIKey(db, rotated.ID, 0)
+    if err != nil {
+        t.Fatalf("RotateAPIKey (no overlap): %v", err)
+    }
+    if _, err := AuthenticateAPIKey(db, newSecret); err == nil {
+        t.Error("expected rotated key to be expired")
+    }
+    if _, _, err := RotateAPIKey(db, rotated.ID, time.Hour); !errors.Is(err, ErrKeyInactive) {
+        t.Errorf("rotate expired key: want ErrKeyInactive, got %v", err)
+    }
+
+    // 4) Revoke
+    keys, err := ListAPIKeys(db)
+    if err != nil {
+        t.Fatalf("ListAPIKeys: %v", err)
+    }
+    if len(keys) != 3 {
+        t.Fatalf("ListAPIKeys: want 3 keys, got %d", len(keys))
+    }
+    if err := RevokeAPIKey(db, keys[2].ID); err != nil {
+        t.Fatalf("RevokeAPIKey: %v", err)
+    }
+    if _, err := AuthenticateAPIKey(db, newest); err == nil {
+        t.Error("expected revoked key to be rejected")
+    }
+    if err := RevokeAPIKey(db, 999); !errors.Is(err, ErrNotFound) {
+        t.Errorf("revoke missing key: want ErrNotFound, got %v", err)
+    }
+}
+
+func TestHasAdminKey(t *testing.T) {
+    db, err := sql.Open("sqlite3", ":memory:")
+    if err != nil {
+        t.Fatalf("open DB: %v", err)
+    }
+    defer db.Close()
+    if err := datastore.RunMigrations(db); err != nil {
+        t.Fatalf("migrations: %v", err)
+    }
+
+    has := func() bool {
+        ok, err := HasAdminKey(db)
+        if err != nil {
+            t.Fatalf("HasAdminKey: %v", err)
+        }
+        return ok
+    }
+    CreateAPIKey(db, "ci", "team-a", models.ScopeUser, 0)
+    if has() {
+        t.Error("user key counted as admin key")
+    }
+    key, _, _ := CreateAPIKey(db, "ops", "ops", models.ScopeAdmin, 0)
+    if !has() {
+        t.Error("admin key not found")
+    }
+    RevokeAPIKey(db, key.ID)
+    if has() {
+        t.Error("revoked admin key counted")
+    }
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net"
+    "net/http"
+    "net/url"
+    "strings"
+    "syscall"
+    "time"
+)
+
+var (
+    // ErrRedirectLoop is returned for targets on one of our own short
+    // domains.
+    ErrRedirectLoop = errors.New("url points back to this shortener")
+    // ErrShortenerChain is returned for targets on another URL shortener
+    // when expansion is disabled.
+    ErrShortenerChain = errors.New("url points to another url shortener")
+    // ErrChainTooLong is returned when expanding takes more hops than
+    // allowed.
+    ErrChainTooLong = errors.New("redirect chain too long")
+    // ErrExpandFailed is returned when another shortener's link cannot be
+    // followed.
+    ErrExpandFailed = errors.New("could not expand shortened url")
+)
+
+// DefaultMaxRedirectDepth caps expansion when no limit is configured.
+const DefaultMaxRedirectDepth = 5
+
+// Expander follows links of other URL shorteners to their destination.
+type Expander struct {
+    // Shorteners are host names of known shorteners; subdomains match too.
+    Shorteners []string
+    // Expand enables following shortener links instead of rejecting them.
+    Expand bool
+    // MaxDepth caps the number of shortener hops followed.
+    MaxDepth int
+    // Client performs the requests; it must not follow redirects itself.
+    Client *http.Client
+}
+
+// NewExpander builds an Expander whose client resolves host names through
+// the DNS server at resolverAddr ("host:port", empty for the system
+// resolver) and refuses to connect to loopback, private and link-local
+// addresses.
+func NewExpander(shorteners []string, expand bool, maxDepth int, resolverAddr string, timeout time.Duration) *Expander {
+    dialer := &net.Dialer{Timeout: timeout, Control: refusePrivate}
+    if resolverAddr != "" {
+        dialer.Resolver = &net.Resolver{
+            PreferGo: true,
+            Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+                var d net.Dialer
+                return d.DialContext(ctx, network, resolverAddr)
+            },
+        }
+    }
+    return &Expander{
+        Shorteners: shorteners,
+        Expand:     expand,
+        MaxDepth:   maxDepth,
+        Client: &http.Client{
+            Timeout:   timeout,
+            Transport: &http.Transport{DialContext: dialer.DialContext},
+            CheckRedirect: func(*http.Request, []*http.Request) error {
+                return http.ErrUseLastResponse
+            },
+        },
+    }
+}
+
+// refusePrivate keeps expansion requests away from internal addresses.
+func refusePrivate(_, address string, _ syscall.RawConn) error {
+    host, _, err := net.SplitHostPort(address)
+    if err != nil {
+        return err
+    }
+    ip := net.ParseIP(host)
+    if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+        return fmt.Errorf("refusing to connect to %s", host)
+    }
+    return nil
+}
+
+// IsShortener reports whether host belongs to a known shortener.
+func (e *Expander) IsShortener(host string) bool {
+    host = NormalizeHost(host)
+    for _, s := range e.Shorteners {
+        s = NormalizeHost(s)
+        if host == s || strings.HasSuffix(host, "."+s) {
+            return true
+        }
+    }
+    return false
+}
+
+// Resolve checks a target URL for redirect loops and shortener chains. isOwn
+// reports whether a host is one of our short domains. Links on known
+// shorteners are rejected, or followed hop by hop when Expand is set; the
+// final destination is returned.
+func (e *Expander) Resolve(ctx context.Context, target string, isOwn func(host string) bool) (string, error) {
+    maxDepth := e.MaxDepth
+    if maxDepth <= 0 {
+        maxDepth = DefaultMaxRedirectDepth
+    }
+
+    current := target
+    for depth := 0; ; depth++ {
+        u, err := url.Parse(current)
+        if err != nil {
+            return "", fmt.Errorf("%w: %v", ErrExpandFailed, err)
+        }
+        host := NormalizeHost(u.Hostname())
+        if isOwn(host) {
+            return "", fmt.Errorf("%w (%s)", ErrRedirectLoop, host)
+        }
+        if !e.IsShortener(host) {
+            return current, nil
+        }
+        if !e.Expand {
+            return "", fmt.Errorf("%w (%s); link to the final destination instead", ErrShortenerChain, host)
+        }
+        if depth >= maxDepth {
+            return "", fmt.Errorf("%w: more than %d hops", ErrChainTooLong, maxDepth)
+        }
+
+        next, err := e.follow(ctx, u)
+        if err != nil {
+            return "", err
+        }
+        current = next
+    }
+}
+
+// follow asks a shortener where one of its links points.
+func (e *Expander) follow(ctx context.Context, u *url.URL) (string, error) {
+    req, err := http.NewRequestWithContext(ctx, http.MethodHead, u.String(), nil)
+    if err != nil {
+        return "", fmt.Errorf("%w: %v", ErrExpandFailed, err)
+    }
+    resp, err := e.Client.Do(req)
+    if err != nil {
+        return "", fmt.Errorf("%w: %v", ErrExpandFailed, err)
+    }
+    resp.Body.Close()
+
+    loc := resp.Header.Get("Location")
+    if resp.StatusCode < 300 || resp.StatusCode >= 400 || loc == "" {
+        return "", fmt.Errorf("%w: %s answered %d without a redirect", ErrExpandFailed, u.Host, resp.StatusCode)
+    }
+    next, err := u.Parse(loc)
+    if err != nil {
+        return "", fmt.Errorf("%w: bad Location %q", ErrExpandFailed, loc)
+    }
+    return next.String(), nil
+}
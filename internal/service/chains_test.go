@@ -0,0 +1,78 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "testing"
+    "time"
+)
+
+func TestExpanderResolve(t *testing.T) {
+    // A fake shortener: /a -> /b -> /c -> destination, /self -> own domain
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        switch r.URL.Path {
+        case "/a":
+            http.Redirect(w, r, "/b", http.StatusMovedPermanently)
+        case "/b":
+            http.Redirect(w, r, "/c", http.StatusFound)
+        case "/c":
+            http.Redirect(w, r, "https://dest.example/page", http.StatusFound)
+        case "/self":
+            http.Redirect(w, r, "https://sn.ap/xyz", http.StatusFound)
+        default:
+            http.NotFound(w, r)
+        }
+    }))
+    defer srv.Close()
+    host := NormalizeHost(srv.Listener.Addr().String())
+
+    client := srv.Client()
+    client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+    e := &Expander{Shorteners: []string{host, "bit.ly"}, Expand: true, MaxDepth: 3, Client: client}
+    isOwn := func(h string) bool { return h == "sn.ap" }
+    ctx := context.Background()
+
+    got, err := e.Resolve(ctx, srv.URL+"/a", isOwn)
+    if err != nil || got != "https://dest.example/page" {
+        t.Fatalf("Resolve chain: got %q, %v", got, err)
+    }
+    if got, err := e.Resolve(ctx, "https://example.com/x", isOwn); err != nil || got != "https://example.com/x" {
+        t.Errorf("Resolve plain url: got %q, %v", got, err)
+    }
+
+    cases := map[string]error{
+        "https://SN.AP/abc":  ErrRedirectLoop,
+        srv.URL + "/self":    ErrRedirectLoop,
+        srv.URL + "/missing": ErrExpandFailed,
+    }
+    for target, want := range cases {
+        if _, err := e.Resolve(ctx, target, isOwn); !errors.Is(err, want) {
+            t.Errorf("Resolve(%q): want %v, got %v", target, want, err)
+        }
+    }
+
+    e.MaxDepth = 2
+    if _, err := e.Resolve(ctx, srv.URL+"/a", isOwn); !errors.Is(err, ErrChainTooLong) {
+        t.Errorf("depth cap: want ErrChainTooLong, got %v", err)
+    }
+
+    e.Expand = false
+    if _, err := e.Resolve(ctx, "https://go.bit.ly/x", isOwn); !errors.Is(err, ErrShortenerChain) {
+        t.Errorf("no expansion: want ErrShortenerChain, got %v", err)
+    }
+}
+
+func TestExpanderRefusesPrivateAddresses(t *testing.T) {
+    srv := httptest.NewServer(http.RedirectHandler("https://dest.example/", http.StatusFound))
+    defer srv.Close()
+    u, _ := url.Parse(srv.URL)
+
+    e := NewExpander([]string{u.Hostname()}, true, 0, "", time.Second)
+    _, err := e.Resolve(context.Background(), srv.URL, func(string) bool { return false })
+    if !errors.Is(err, ErrExpandFailed) {
+        t.Errorf("want ErrExpandFailed for loopback target, got %v", err)
+    }
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "log"
+    "sync"
+    "time"
+
+    "github.com/valorm/snapurl/internal/telemetry"
+)
+
+// hitFlushTimeout bounds how long a flush waits for the writer, e.g.
+// behind a running import batch, before it gives up and tries again later.
+const hitFlushTimeout = 5 * time.Second
+
+type hitKey struct {
+    workspaceID int
+    code        string
+}
+
+// HitCounter counts redirects in memory and adds them to the links in one
+// transaction a short delay after the first pending hit, so redirects never
+// wait for the database writer. It needs no goroutine of its own; call
+// Flush before the process exits so pending hits are not lost.
+type HitCounter struct {
+    db    *sql.DB
+    delay time.Duration
+
+    flushing sync.Mutex // serializes flushes, so Flush waits for one in flight
+
+    mu        sync.Mutex
+    pending   map[hitKey]int
+    scheduled bool
+}
+
+// NewHitCounter returns a counter that writes to db delay after a hit.
+func NewHitCounter(db *sql.DB, delay time.Duration) *HitCounter {
+    return &HitCounter{db: db, delay: delay, pending: map[hitKey]int{}}
+}
+
+// Add records a hit on a link.
+func (h *HitCounter) Add(workspaceID int, code string) {
+    telemetry.Increment("redirects_served")
+
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    h.pending[hitKey{workspaceID, code}]++
+    h.schedule()
+}
+
+// schedule arranges a flush unless one is pending; h.mu must be held.
+func (h *HitCounter) schedule() {
+    if h.scheduled {
+        return
+    }
+    h.scheduled = true
+    time.AfterFunc(h.delay, func() {
+        if err := h.Flush(); err != nil {
+            log.Printf("hits: %v", err)
+        }
+    })
+}
+
+// Flush writes the pending hits now, after any flush already in progress.
+// Hits that could not be written are kept and retried after the delay.
+func (h *HitCounter) Flush() error {
+    h.flushing.Lock()
+    defer h.flushing.Unlock()
+
+    h.mu.Lock()
+    pending := h.pending
+    h.pending, h.scheduled = map[hitKey]int{}, false
+    h.mu.Unlock()
+    if len(pending) == 0 {
+        return nil
+    }
+
+    err := h.write(pending)
+    if err != nil {
+        h.mu.Lock()
+        for k, n := range pending {
+            h.pending[k] += n
+        }
+        h.schedule()
+        h.mu.Unlock()
+    }
+    return err
+}
+
+func (h *HitCounter) write(pending map[hitKey]int) error {
+    ctx, cancel := context.WithTimeout(context.Background(), hitFlushTimeout)
+    defer cancel()
+    tx, err := h.db.BeginTx(ctx, nil)
+    if err != nil {
+        return fmt.Errorf("begin tx: %w", err)
+    }
+    defer tx.Rollback()
+    for k, n := range pending {
+        _, err := tx.ExecContext(ctx,
+            "UPDATE links SET hits = hits + ? WHERE workspace_id = ? AND shortcode = ?",
+            n, k.workspaceID, k.code,
+        )
+        if err != nil {
+            return fmt.Errorf("add hits: %w", err)
+        }
+    }
+    if err := tx.Commit(); err != nil {
+        return fmt.Errorf("commit hits: %w", err)
+    }
+    return nil
+}
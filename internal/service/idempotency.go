@@ -0,0 +1,105 @@
+package service
+
+import (
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "strings"
+    "time"
+)
+
+var (
+    // ErrIdempotencyMismatch is returned when a key is reused with a
+    // different request.
+    ErrIdempotencyMismatch = errors.New("idempotency key reused with a different request")
+    // ErrIdempotencyInFlight is returned while the first request with a key
+    // is still being processed.
+    ErrIdempotencyInFlight = errors.New("request with this idempotency key is in progress")
+)
+
+// StoredResponse is a response remembered for an idempotency key.
+type StoredResponse struct {
+    StatusCode int
+    Header     http.Header
+    Body       []byte
+}
+
+// BeginIdempotent claims an idempotency key for a request. It returns the
+// stored response when the key was already used with the same request
+// hash within window, or nil when the caller should process the request
+// and then call CompleteIdempotent or AbortIdempotent.
+func BeginIdempotent(db *sql.DB, ownerID, key, requestHash string, window time.Duration) (*StoredResponse, error) {
+    now := time.Now().UTC()
+    cutoff := now.Add(-window)
+
+    // Expired entries no longer count; drop them as we go
+    if _, err := db.Exec("DELETE FROM idempotency_keys WHERE created_at <= ?", cutoff); err != nil {
+        return nil, fmt.Errorf("purge idempotency keys: %w", err)
+    }
+
+    _, err := db.Exec(
+        "INSERT INTO idempotency_keys (owner_id, idem_key, request_hash, created_at) VALUES (?, ?, ?, ?)",
+        ownerID, key, requestHash, now,
+    )
+    if err == nil {
+        return nil, nil
+    }
+    if !strings.Contains(err.Error(), "UNIQUE constraint failed") {
+        return nil, fmt.Errorf("insert idempotency key: %w", err)
+    }
+
+    var hash, headers string
+    var status int
+    var body []byte
+    err = db.QueryRow(
+        "SELECT request_hash, status_code, response_headers, response_body FROM idempotency_keys WHERE owner_id = ? AND idem_key = ?",
+        ownerID, key,
+    ).Scan(&hash, &status, &headers, &body)
+    if err != nil {
+        return nil, fmt.Errorf("query idempotency key: %w", err)
+    }
+
+    if hash != requestHash {
+        return nil, ErrIdempotencyMismatch
+    }
+    if status == 0 {
+        return nil, ErrIdempotencyInFlight
+    }
+
+    resp := &StoredResponse{StatusCode: status, Body: body}
+    if err := json.Unmarshal([]byte(headers), &resp.Header); err != nil {
+        return nil, fmt.Errorf("decode stored headers: %w", err)
+    }
+    return resp, nil
+}
+
+// CompleteIdempotent stores the response for a key claimed by
+// BeginIdempotent.
+func CompleteIdempotent(db *sql.DB, ownerID, key string, resp StoredResponse) error {
+    headers, err := json.Marshal(resp.Header)
+    if err != nil {
+        return fmt.Errorf("encode headers: %w", err)
+    }
+    _, err = db.Exec(
+        "UPDATE idempotency_keys SET status_code = ?, response_headers = ?, response_body = ? WHERE owner_id = ? AND idem_key = ?",
+        resp.StatusCode, string(headers), resp.Body, ownerID, key,
+    )
+    if err != nil {
+        return fmt.Errorf("store idempotent response: %w", err)
+    }
+    return nil
+}
+
+// AbortIdempotent releases a claimed key so the request can be retried.
+func AbortIdempotent(db *sql.DB, ownerID, key string) error {
+    _, err := db.Exec(
+        "DELETE FROM idempotency_keys WHERE owner_id = ? AND idem_key = ? AND status_code = 0",
+        ownerID, key,
+    )
+    if err != nil {
+        return fmt.Errorf("release idempotency key: %w", err)
+    }
+    return nil
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "log"
+    "strings"
+    "time"
+
+    "github.com/valorm/snapurl/internal/telemetry"
+)
+
+// Janitor modes: move old links to links_archive, or delete them.
+const (
+    JanitorArchive = "archive"
+    JanitorDelete  = "delete"
+)
+
+// janitorBatchSize bounds how many links one transaction moves, so
+// redirects are not blocked for long.
+const janitorBatchSize = 500
+
+// JanitorOptions configures PurgeLinks.
+type JanitorOptions struct {
+    // Retention is how long links stay after they expired or were revoked.
+    Retention time.Duration
+    // Mode is JanitorArchive (the default) or JanitorDelete.
+    Mode string
+}
+
+// PurgeResult counts the links removed by PurgeLinks.
+type PurgeResult struct {
+    Archived int `json:"archived"`
+    Deleted  int `json:"deleted"`
+}
+
+// PurgeLinks removes links that expired or were revoked more than
+// opts.Retention ago. Their hit counts live on the row and go with it: into
+// links_archive in archive mode, or away entirely in delete mode.
+func PurgeLinks(db *sql.DB, opts JanitorOptions) (PurgeResult, error) {
+    var result PurgeResult
+    switch opts.Mode {
+    case "":
+        opts.Mode = JanitorArchive
+    case JanitorArchive, JanitorDelete:
+    default:
+        return result, fmt.Errorf("unknown janitor mode %q", opts.Mode)
+    }
+    cutoff := time.Now().Add(-opts.Retention)
+
+    for {
+        n, err := purgeBatch(db, cutoff, opts.Mode)
+        if opts.Mode == JanitorArchive {
+            result.Archived += n
+        } else {
+            result.Deleted += n
+        }
+        if err != nil {
+            return result, err
+        }
+        if n < janitorBatchSize {
+            return result, nil
+        }
+    }
+}
+
+func purgeBatch(db *sql.DB, cutoff time.Time, mode string) (int, error) {
+    tx, err := db.Begin()
+    if err != nil {
+        return 0, fmt.Errorf("begin tx: %w", err)
+    }
+    defer tx.Rollback()
+
+    rows, err := tx.Query(
+        `SELECT id FROM links WHERE expires_at < ?
+         UNION SELECT id FROM links WHERE revoked = 1 AND revoked_at < ?
+         LIMIT ?`,
+        cutoff, cutoff, janitorBatchSize,
+    )
+    if err != nil {
+        return 0, fmt.Errorf("query old links: %w", err)
+    }
+    var ids []any
+    for rows.Next() {
+        var id int
+        if err := rows.Scan(&id); err != nil {
+            rows.Close()
+            return 0, fmt.Errorf("scan link id: %w", err)
+        }
+        ids = append(ids, id)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return 0, err
+    }
+    if len(ids) == 0 {
+        return 0, nil
+    }
+
+    in := "(" + strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",") + ")"
+    if mode == JanitorArchive {
+        _, err = tx.Exec(
+            `INSERT OR REPLACE INTO links_archive
+                (id, workspace_id, shortcode, target_url, normalized_url, created_at, hits, expires_at, revoked, revoked_at, revoked_reason, revoked_by, revoked_reason_public, owner_id, archived_at)
+             SELECT id, workspace_id, shortcode, target_url, normalized_url, created_at, hits, expires_at, revoked, revoked_at, revoked_reason, revoked_by, revoked_reason_public, owner_id, ?
+             FROM links WHERE id IN `+in,
+            append([]any{time.Now()}, ids...)...,
+        )
+        if err != nil {
+            return 0, fmt.Errorf("archive links: %w", err)
+        }
+    }
+    if _, err := tx.Exec("DELETE FROM links WHERE id IN "+in, ids...); err != nil {
+        return 0, fmt.Errorf("delete links: %w", err)
+    }
+    if err := tx.Commit(); err != nil {
+        return 0, fmt.Errorf("commit purge: %w", err)
+    }
+
+    counter := "links_archived"
+    if mode == JanitorDelete {
+        counter = "links_deleted"
+    }
+    telemetry.Add(counter, uint64(len(ids)))
+    return len(ids), nil
+}
+
+// RunJanitor purges old links every interval until ctx is done.
+func RunJanitor(ctx context.Context, db *sql.DB, interval time.Duration, opts JanitorOptions) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+            result, err := PurgeLinks(db, opts)
+            if err != nil {
+                log.Printf("janitor: %v", err)
+            }
+            if result.Archived+result.Deleted > 0 {
+                log.Printf("janitor: archived %d, deleted %d links", result.Archived, result.Deleted)
+            }
+        }
+    }
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+    "database/sql"
+    "errors"
+    "testing"
+    "time"
+
+    _ "github.com/mattn/go-sqlite3"
+    "github.com/valorm/snapurl/internal/datastore"
+    "github.com/valorm/snapurl/internal/models"
+    "github.com/valorm/snapurl/internal/telemetry"
+)
+
+func TestPurgeLinks(t *testing.T) {
+    db, err := sql.Open("sqlite3", ":memory:")
+    if err != nil {
+        t.Fatalf("open DB: %v", err)
+    }
+    defer db.Close()
+    if err := datastore.RunMigrations(db); err != nil {
+        t.Fatalf("migrations: %v", err)
+    }
+
+    now := time.Now()
+    old := now.Add(-40 * 24 * time.Hour)
+    recent := now.Add(-time.Hour)
+    mustCreate := func(expiry *time.Time) string {
+        link, _, err := CreateLink(db, "https://example.com", CreateLinkOptions{Expiry: expiry})
+        if err != nil {
+            t.Fatalf("CreateLink: %v", err)
+        }
+        return link.Shortcode
+    }
+    exists := func(table, code string) bool {
+        var n int
+        if err := db.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE shortcode = ?", code).Scan(&n); err != nil {
+            t.Fatalf("count %s: %v", table, err)
+        }
+        return n > 0
+    }
+
+    active := mustCreate(nil)
+    oldExpired := mustCreate(&old)
+    recentExpired := mustCreate(&recent)
+    oldRevoked := mustCreate(nil)
+    recentRevoked := mustCreate(nil)
+    for _, code := range []string{oldRevoked, recentRevoked} {
+        if err := RevokeLink(db, 1, code, "", Revocation{Reason: "spam", Public: true}); err != nil {
+            t.Fatalf("RevokeLink: %v", err)
+        }
+    }
+    if _, err := db.Exec("UPDATE links SET revoked_at = ?, hits = 7 WHERE shortcode = ?", old, oldRevoked); err != nil {
+        t.Fatalf("age revocation: %v", err)
+    }
+    if _, err := db.Exec("UPDATE links SET revoked_at = ? WHERE shortcode = ?", recent, recentRevoked); err != nil {
+        t.Fatalf("age revocation: %v", err)
+    }
+
+    // 1) Archive mode moves only links past the retention
+    before, _ := telemetry.GetMetrics(db)
+    opts := JanitorOptions{Retention: 30 * 24 * time.Hour}
+    result, err := PurgeLinks(db, opts)
+    if err != nil {
+        t.Fatalf("PurgeLinks: %v", err)
+    }
+    if result.Archived != 2 || result.Deleted != 0 {
+        t.Fatalf("want 2 archived, got %+v", result)
+    }
+    for _, code := range []string{oldExpired, oldRevoked} {
+        if exists("links", code) || !exists("links_archive", code) {
+            t.Errorf("%s: expected to be archived", code)
+        }
+    }
+    for _, code := range []string{active, recentExpired, recentRevoked} {
+        if !exists("links", code) {
+            t.Errorf("%s: expected to be kept", code)
+        }
+    }
+    var hits int
+    var reason string
+    var public bool
+    db.QueryRow("SELECT hits, revoked_reason, revoked_reason_public FROM links_archive WHERE shortcode = ?", oldRevoked).Scan(&hits, &reason, &public)
+    if hits != 7 || reason != "spam" || !public {
+        t.Errorf("archived link: want 7 hits and public reason, got %d, %q, %v", hits, reason, public)
+    }
+    after, _ := telemetry.GetMetrics(db)
+    if got := after["links_archived"] - before["links_archived"]; got != 2 {
+        t.Errorf("links_archived metric: want +2, got +%d", got)
+    }
+
+    // 2) Delete mode with a shorter retention removes the recent ones too
+    result, err = PurgeLinks(db, JanitorOptions{Retention: time.Minute, Mode: JanitorDelete})
+    if err != nil {
+        t.Fatalf("PurgeLinks (delete): %v", err)
+    }
+    if result.Deleted != 2 || result.Archived != 0 {
+        t.Fatalf("want 2 deleted, got %+v", result)
+    }
+    if exists("links_archive", recentExpired) || exists("links", recentExpired) {
+        t.Error("deleted link must not be archived")
+    }
+    if !exists("links", active) {
+        t.Error("active link must be kept")
+    }
+
+    // 3) Archived shortcodes stay reserved
+    im, err := BeginImport(db, ConflictOverwrite, false)
+    if err != nil {
+        t.Fatalf("BeginImport: %v", err)
+    }
+    _, err = im.Add(models.Link{Shortcode: oldRevoked, TargetURL: "https://example.org"})
+    im.Rollback()
+    if !errors.Is(err, ErrInvalidImport) {
+        t.Errorf("import of archived shortcode: want ErrInvalidImport, got %v", err)
+    }
+
+    defer func(f func() (string, error)) { generateCode = f }(generateCode)
+    candidates := []string{oldRevoked, "fresh001"}
+    generateCode = func() (string, error) {
+        code := candidates[0]
+        candidates = candidates[1:]
+        return code, nil
+    }
+    if link, _, err := CreateLink(db, "https://example.org", CreateLinkOptions{}); err != nil || link.Shortcode != "fresh001" {
+        t.Errorf("CreateLink with an archived candidate: got %q, %v", link.Shortcode, err)
+    }
+
+    if _, err := PurgeLinks(db, JanitorOptions{Mode: "shred"}); err == nil {
+        t.Error("expected error for unknown mode")
+    }
+}
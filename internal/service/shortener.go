@@ -2,7 +2,10 @@ package service
 
 import (
     "database/sql"
+    "errors"
     "fmt"
+    "net/url"
+    "strings"
     "time"
 
     "github.com/valorm/snapurl/internal/models"
@@ -10,90 +13,313 @@ import (
     "github.com/valorm/snapurl/pkg/util"
 )
 
-func CreateLink(db *sql.DB, targetURL string, expiry *time.Time) (models.Link, error) {
-    var link models.Link
-    var unique bool
+const linkColumns = "id, workspace_id, shortcode, target_url, created_at, hits, expires_at, revoked, owner_id, revoked_at, revoked_reason, revoked_by, revoked_reason_public"
 
-    for i := 0; i < 10; i++ {
-        code, err := util.GenerateCode(8)
-        if err != nil {
-            return models.Link{}, fmt.Errorf("generate code: %w", err)
+// scanLink reads a row selected with linkColumns.
+func scanLink(row interface{ Scan(...any) error }) (models.Link, error) {
+    var l models.Link
+    err := row.Scan(&l.ID, &l.WorkspaceID, &l.Shortcode, &l.TargetURL, &l.CreatedAt, &l.Hits, &l.ExpiresAt, &l.Revoked, &l.OwnerID, &l.RevokedAt, &l.RevokedReason, &l.RevokedBy, &l.ReasonPublic)
+    return l, err
+}
+
+var (
+    // ErrLinkExpired is returned by ResolveLink for expired links.
+    ErrLinkExpired = errors.New("link expired")
+    // ErrLinkRevoked is returned by ResolveLink for revoked links.
+    ErrLinkRevoked = errors.New("link revoked")
+)
+
+// CreateLinkOptions holds the optional parts of a new link. A zero
+// WorkspaceID means the default workspace. With ReuseExisting set and no
+// Expiry, an active non-expiring link of the same owner and workspace for
+// the same normalized target is returned instead of creating a new one.
+type CreateLinkOptions struct {
+    Expiry        *time.Time
+    OwnerID       string
+    WorkspaceID   int
+    ReuseExisting bool
+}
+
+// NormalizeTargetURL returns the form of a target URL used to detect
+// duplicates: scheme and host lowercased, default ports dropped and an empty
+// path written as "/". Unparseable input is returned unchanged.
+func NormalizeTargetURL(raw string) string {
+    u, ok := canonicalURL(raw)
+    if !ok {
+        return raw
+    }
+    if u.Path == "" && u.RawPath == "" {
+        u.Path = "/"
+    }
+    return u.String()
+}
+
+// normalizeBatchSize bounds how many links one BackfillNormalizedURLs
+// transaction updates.
+const normalizeBatchSize = 500
+
+// BackfillNormalizedURLs fills in normalized_url for links stored before
+// the column existed, which migration 0007 leaves empty because SQL cannot
+// normalize URLs. Until then such links are never reused. It returns how
+// many links it updated; run it after migrating.
+func BackfillNormalizedURLs(db *sql.DB) (int, error) {
+    total, after := 0, 0
+    for {
+        n, last, err := backfillBatch(db, after)
+        total += n
+        if err != nil || n < normalizeBatchSize {
+            return total, err
         }
+        after = last
+    }
+}
 
-        var dummy int
-        err = db.QueryRow("SELECT 1 FROM links WHERE shortcode = ?", code).Scan(&dummy)
-        if err == sql.ErrNoRows {
-            link.Shortcode = code
-            unique = true
-            break
+func backfillBatch(db *sql.DB, after int) (n, last int, err error) {
+    tx, err := db.Begin()
+    if err != nil {
+        return 0, 0, fmt.Errorf("begin tx: %w", err)
+    }
+    defer tx.Rollback()
+
+    rows, err := tx.Query(
+        "SELECT id, target_url FROM links WHERE normalized_url = '' AND id > ? ORDER BY id LIMIT ?",
+        after, normalizeBatchSize,
+    )
+    if err != nil {
+        return 0, 0, fmt.Errorf("query links: %w", err)
+    }
+    targets := map[int]string{}
+    for rows.Next() {
+        var id int
+        var target string
+        if err := rows.Scan(&id, &target); err != nil {
+            rows.Close()
+            return 0, 0, fmt.Errorf("scan link: %w", err)
         }
-        if err != nil && err != sql.ErrNoRows {
-            return models.Link{}, fmt.Errorf("check code uniqueness: %w", err)
+        targets[id], last = target, id
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return 0, 0, err
+    }
+
+    for id, target := range targets {
+        if _, err := tx.Exec("UPDATE links SET normalized_url = ? WHERE id = ?", NormalizeTargetURL(target), id); err != nil {
+            return 0, 0, fmt.Errorf("update link %d: %w", id, err)
         }
     }
+    if err := tx.Commit(); err != nil {
+        return 0, 0, fmt.Errorf("commit: %w", err)
+    }
+    return len(targets), last, nil
+}
 
-    if !unique {
-        return models.Link{}, fmt.Errorf("failed to generate unique code after 10 attempts")
+// canonicalURL parses raw and lowercases its scheme and host and drops a
+// default port. It reports false for unparseable URLs and ones without a
+// host.
+func canonicalURL(raw string) (*url.URL, bool) {
+    u, err := url.Parse(raw)
+    if err != nil || u.Host == "" {
+        return nil, false
+    }
+    u.Scheme = strings.ToLower(u.Scheme)
+    host := strings.ToLower(u.Hostname())
+    port := u.Port()
+    if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+        port = ""
+    }
+    if strings.Contains(host, ":") {
+        host = "[" + host + "]"
     }
+    if port != "" {
+        host += ":" + port
+    }
+    u.Host = host
+    return u, true
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx.
+type querier interface {
+    Exec(query string, args ...any) (sql.Result, error)
+    QueryRow(query string, args ...any) *sql.Row
+}
+
+// maxCodeAttempts bounds retries when a generated code is already taken.
+const maxCodeAttempts = 10
+
+// generateCode makes candidate shortcodes; tests replace it.
+var generateCode = func() (string, error) { return util.GenerateCode(8) }
+
+// findReusableLink returns an active, non-expiring link for a normalized
+// target, or sql.ErrNoRows.
+func findReusableLink(q querier, normalized, ownerID string, workspaceID int) (models.Link, error) {
+    return scanLink(q.QueryRow(
+        "SELECT "+linkColumns+" FROM links WHERE normalized_url = ? AND owner_id = ? AND workspace_id = ? AND revoked = 0 AND expires_at IS NULL ORDER BY id LIMIT 1",
+        normalized, ownerID, workspaceID,
+    ))
+}
 
-    createdAt := time.Now()
-    expiresAt := sql.NullTime{}
-    if expiry != nil {
-        expiresAt.Time = *expiry
-        expiresAt.Valid = true
+// CreateLink stores a new link, or returns an existing one when
+// opts.ReuseExisting finds one. It reports whether a link was created.
+func CreateLink(db *sql.DB, targetURL string, opts CreateLinkOptions) (models.Link, bool, error) {
+    link, created, err := createLink(db, targetURL, opts)
+    if err != nil {
+        return models.Link{}, false, err
+    }
+    if created {
+        telemetry.Increment("urls_created")
     }
+    return link, created, nil
+}
 
-    res, err := db.Exec(
-        "INSERT INTO links (shortcode, target_url, created_at, expires_at, revoked) VALUES (?, ?, ?, ?, ?)",
-        link.Shortcode, targetURL, createdAt, expiresAt, false,
-    )
+// LinkRequest is one link of a CreateLinks batch.
+type LinkRequest struct {
+    TargetURL string
+    Options   CreateLinkOptions
+}
+
+// CreateLinks creates a batch of links in a single transaction: either all
+// of them are stored or none is. Options behave as in CreateLink; created
+// reports for each link whether it is new.
+func CreateLinks(db *sql.DB, reqs []LinkRequest) (links []models.Link, created []bool, err error) {
+    tx, err := db.Begin()
     if err != nil {
-        return models.Link{}, fmt.Errorf("insert link: %w", err)
+        return nil, nil, fmt.Errorf("begin tx: %w", err)
     }
+    defer tx.Rollback()
 
-    id, _ := res.LastInsertId()
-    link.ID = int(id)
-    link.TargetURL = targetURL
-    link.CreatedAt = createdAt
-    link.Hits = 0
-    link.ExpiresAt = expiresAt
-    link.Revoked = false
+    links = make([]models.Link, 0, len(reqs))
+    created = make([]bool, 0, len(reqs))
+    var n int
+    for i, req := range reqs {
+        link, isNew, err := createLink(tx, req.TargetURL, req.Options)
+        if err != nil {
+            return nil, nil, fmt.Errorf("link %d: %w", i, err)
+        }
+        if isNew {
+            n++
+        }
+        links = append(links, link)
+        created = append(created, isNew)
+    }
 
-    // increment metrics
-    telemetry.Increment("urls_created")
-    return link, nil
+    if err := tx.Commit(); err != nil {
+        return nil, nil, fmt.Errorf("commit links: %w", err)
+    }
+    for i := 0; i < n; i++ {
+        telemetry.Increment("urls_created")
+    }
+    return links, created, nil
 }
 
-func ResolveLink(db *sql.DB, code string) (models.Link, error) {
-    var link models.Link
-    var expiresAt sql.NullTime
+// createLink stores a link under a fresh random code. Instead of checking
+// each candidate code first, it inserts and retries with a new code when
+// the unique constraint rejects it or the code belongs to an archived link
+// (the insert then stores nothing). It reports whether a new link was
+// created rather than an existing one reused.
+func createLink(q querier, targetURL string, opts CreateLinkOptions) (models.Link, bool, error) {
+    if opts.WorkspaceID == 0 {
+        opts.WorkspaceID = models.DefaultWorkspaceID
+    }
 
-    err := db.QueryRow(
-        "SELECT id, target_url, created_at, hits, expires_at, revoked FROM links WHERE shortcode = ?",
-        code,
-    ).Scan(&link.ID, &link.TargetURL, &link.CreatedAt, &link.Hits, &expiresAt, &link.Revoked)
+    normalized := NormalizeTargetURL(targetURL)
+    if opts.ReuseExisting && opts.Expiry == nil {
+        existing, err := findReusableLink(q, normalized, opts.OwnerID, opts.WorkspaceID)
+        if err == nil {
+            return existing, false, nil
+        }
+        if err != sql.ErrNoRows {
+            return models.Link{}, false, fmt.Errorf("find existing link: %w", err)
+        }
+    }
+
+    link := models.Link{
+        WorkspaceID: opts.WorkspaceID,
+        TargetURL:   targetURL,
+        CreatedAt:   time.Now(),
+        OwnerID:     opts.OwnerID,
+    }
+    if opts.Expiry != nil {
+        link.ExpiresAt = sql.NullTime{Time: *opts.Expiry, Valid: true}
+    }
+
+    for i := 0; i < maxCodeAttempts; i++ {
+        code, err := generateCode()
+        if err != nil {
+            return models.Link{}, false, fmt.Errorf("generate code: %w", err)
+        }
+
+        res, err := q.Exec(
+            `INSERT INTO links (workspace_id, shortcode, target_url, normalized_url, created_at, expires_at, revoked, owner_id)
+             SELECT ?, ?, ?, ?, ?, ?, ?, ?
+             WHERE NOT EXISTS (SELECT 1 FROM links_archive WHERE workspace_id = ? AND shortcode = ?)`,
+            link.WorkspaceID, code, targetURL, normalized, link.CreatedAt, link.ExpiresAt, false, link.OwnerID,
+            link.WorkspaceID, code,
+        )
+        if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed") {
+            continue
+        }
+        if err != nil {
+            return models.Link{}, false, fmt.Errorf("insert link: %w", err)
+        }
+        if n, err := res.RowsAffected(); err != nil {
+            return models.Link{}, false, fmt.Errorf("check rows affected: %w", err)
+        } else if n == 0 {
+            continue
+        }
+
+        id, _ := res.LastInsertId()
+        link.ID = int(id)
+        link.Shortcode = code
+        return link, true, nil
+    }
+    return models.Link{}, false, fmt.Errorf("failed to generate unique code after %d attempts", maxCodeAttempts)
+}
+
+// shortcodeArchived reports whether the janitor archived a link with code,
+// which keeps the code from being imported again.
+func shortcodeArchived(q querier, workspaceID int, code string) (bool, error) {
+    var n int
+    err := q.QueryRow(
+        "SELECT COUNT(*) FROM links_archive WHERE workspace_id = ? AND shortcode = ?",
+        workspaceID, code,
+    ).Scan(&n)
+    if err != nil {
+        return false, fmt.Errorf("query archive: %w", err)
+    }
+    return n > 0, nil
+}
+
+// ResolveLink returns the active link for a shortcode in a workspace.
+// Expired and revoked links are returned along with ErrLinkExpired or
+// ErrLinkRevoked, so callers can explain why the link is gone.
+func ResolveLink(db *sql.DB, workspaceID int, code string) (models.Link, error) {
+    link, err := scanLink(db.QueryRow(
+        "SELECT "+linkColumns+" FROM links WHERE workspace_id = ? AND shortcode = ?",
+        workspaceID, code,
+    ))
     if err == sql.ErrNoRows {
-        return models.Link{}, fmt.Errorf("link not found")
+        return models.Link{}, fmt.Errorf("link %w", ErrNotFound)
     }
     if err != nil {
         return models.Link{}, fmt.Errorf("query link: %w", err)
     }
 
-    link.Shortcode = code
-    link.ExpiresAt = expiresAt
-
-    if expiresAt.Valid && expiresAt.Time.Before(time.Now()) {
-        return models.Link{}, fmt.Errorf("link expired")
-    }
     if link.Revoked {
-        return models.Link{}, fmt.Errorf("link revoked")
+        return link, ErrLinkRevoked
+    }
+    if link.ExpiresAt.Valid && link.ExpiresAt.Time.Before(time.Now()) {
+        return link, ErrLinkExpired
     }
 
     return link, nil
 }
 
-func IncrementHits(db *sql.DB, code string) error {
-    res, err := db.Exec("UPDATE links SET hits = hits + 1 WHERE shortcode = ?", code)
+func IncrementHits(db *sql.DB, workspaceID int, code string) error {
+    res, err := db.Exec(
+        "UPDATE links SET hits = hits + 1 WHERE workspace_id = ? AND shortcode = ?",
+        workspaceID, code,
+    )
     if err != nil {
         return fmt.Errorf("increment hits: %w", err)
     }
@@ -109,8 +335,23 @@ func IncrementHits(db *sql.DB, code string) error {
     return nil
 }
 
-func RevokeLink(db *sql.DB, code string) error {
-    res, err := db.Exec("UPDATE links SET revoked = 1 WHERE shortcode = ?", code)
+// Revocation records why a link was revoked and by whom. Public reasons
+// are shown to visitors of the revoked link.
+type Revocation struct {
+    Reason string
+    Actor  string
+    Public bool
+}
+
+// RevokeLink marks a link as revoked. A non-empty ownerID restricts the
+// operation to links of that owner; links owned by someone else are
+// reported as ErrNotFound. Revoking a revoked link again replaces the
+// reason but keeps the original revocation time.
+func RevokeLink(db *sql.DB, workspaceID int, code, ownerID string, rev Revocation) error {
+    res, err := db.Exec(
+        "UPDATE links SET revoked = 1, revoked_at = COALESCE(revoked_at, ?), revoked_reason = ?, revoked_by = ?, revoked_reason_public = ? WHERE workspace_id = ? AND shortcode = ? AND (? = '' OR owner_id = ?)",
+        time.Now(), rev.Reason, rev.Actor, rev.Public, workspaceID, code, ownerID, ownerID,
+    )
     if err != nil {
         return fmt.Errorf("revoke link: %w", err)
     }
@@ -119,7 +360,131 @@ func RevokeLink(db *sql.DB, code string) error {
         return fmt.Errorf("check rows affected: %w", err)
     }
     if rows == 0 {
-        return fmt.Errorf("no link found to revoke")
+        return ErrNotFound
     }
     return nil
 }
+
+// UnrevokeLink makes a revoked link resolve again and clears its
+// revocation details. A non-empty ownerID restricts the operation to links
+// of that owner. The expiry is left alone: an expired link stays expired.
+func UnrevokeLink(db *sql.DB, workspaceID int, code, ownerID string) (models.Link, error) {
+    res, err := db.Exec(
+        "UPDATE links SET revoked = 0, revoked_at = NULL, revoked_reason = '', revoked_by = '', revoked_reason_public = 0 WHERE workspace_id = ? AND shortcode = ? AND (? = '' OR owner_id = ?)",
+        workspaceID, code, ownerID, ownerID,
+    )
+    if err != nil {
+        return models.Link{}, fmt.Errorf("unrevoke link: %w", err)
+    }
+    rows, err := res.RowsAffected()
+    if err != nil {
+        return models.Link{}, fmt.Errorf("check rows affected: %w", err)
+    }
+    if rows == 0 {
+        return models.Link{}, ErrNotFound
+    }
+    return GetLink(db, workspaceID, code, ownerID)
+}
+
+// DeleteLink removes a link for good, hit count included. Unlike
+// RevokeLink it frees the shortcode for reuse.
+func DeleteLink(db *sql.DB, workspaceID int, code string) error {
+    res, err := db.Exec("DELETE FROM links WHERE workspace_id = ? AND shortcode = ?", workspaceID, code)
+    if err != nil {
+        return fmt.Errorf("delete link: %w", err)
+    }
+    rows, err := res.RowsAffected()
+    if err != nil {
+        return fmt.Errorf("check rows affected: %w", err)
+    }
+    if rows == 0 {
+        return ErrNotFound
+    }
+    return nil
+}
+
+// GetLink returns a link regardless of its state. A non-empty ownerID
+// restricts the lookup to links of that owner.
+func GetLink(db *sql.DB, workspaceID int, code, ownerID string) (models.Link, error) {
+    link, err := scanLink(db.QueryRow(
+        "SELECT "+linkColumns+" FROM links WHERE workspace_id = ? AND shortcode = ? AND (? = '' OR owner_id = ?)",
+        workspaceID, code, ownerID, ownerID,
+    ))
+    if err == sql.ErrNoRows {
+        return models.Link{}, ErrNotFound
+    }
+    if err != nil {
+        return models.Link{}, fmt.Errorf("query link: %w", err)
+    }
+    return link, nil
+}
+
+// ListLinksFilter narrows ListLinks. An empty OwnerID lists every owner
+// and a zero WorkspaceID every workspace.
+type ListLinksFilter struct {
+    OwnerID     string
+    WorkspaceID int
+    Limit       int
+    Offset      int
+}
+
+// ListLinks returns links newest first.
+func ListLinks(db *sql.DB, f ListLinksFilter) ([]models.Link, error) {
+    if f.Limit <= 0 {
+        f.Limit = 100
+    }
+
+    rows, err := db.Query(
+        "SELECT "+linkColumns+" FROM links WHERE (? = '' OR owner_id = ?) AND (? = 0 OR workspace_id = ?) ORDER BY id DESC LIMIT ? OFFSET ?",
+        f.OwnerID, f.OwnerID, f.WorkspaceID, f.WorkspaceID, f.Limit, f.Offset,
+    )
+    if err != nil {
+        return nil, fmt.Errorf("query links: %w", err)
+    }
+    defer rows.Close()
+
+    links := []models.Link{}
+    for rows.Next() {
+        link, err := scanLink(rows)
+        if err != nil {
+            return nil, fmt.Errorf("scan link: %w", err)
+        }
+        links = append(links, link)
+    }
+    return links, rows.Err()
+}
+
+// LinkUpdate lists the fields to change; nil fields are left untouched.
+type LinkUpdate struct {
+    TargetURL   *string
+    Expiry      *time.Time
+    ClearExpiry bool
+}
+
+// UpdateLink applies upd to a link and returns the result. A non-empty
+// ownerID restricts the update to links of that owner.
+func UpdateLink(db *sql.DB, workspaceID int, code, ownerID string, upd LinkUpdate) (models.Link, error) {
+    link, err := GetLink(db, workspaceID, code, ownerID)
+    if err != nil {
+        return models.Link{}, err
+    }
+
+    if upd.TargetURL != nil {
+        link.TargetURL = *upd.TargetURL
+    }
+    if upd.ClearExpiry {
+        link.ExpiresAt = sql.NullTime{}
+    }
+    if upd.Expiry != nil {
+        link.ExpiresAt = sql.NullTime{Time: *upd.Expiry, Valid: true}
+    }
+
+    _, err = db.Exec(
+        "UPDATE links SET target_url = ?, normalized_url = ?, expires_at = ? WHERE id = ?",
+        link.TargetURL, NormalizeTargetURL(link.TargetURL), link.ExpiresAt, link.ID,
+    )
+    if err != nil {
+        return models.Link{}, fmt.Errorf("update link: %w", err)
+    }
+    return link, nil
+}
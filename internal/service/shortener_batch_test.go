@@ -0,0 +1,62 @@
+package service
+
+import (
+    "database/sql"
+    "testing"
+
+    _ "github.com/mattn/go-sqlite3"
+    "github.com/valorm/snapurl/internal/datastore"
+)
+
+func TestCreateLinks(t *testing.T) {
+    db, err := sql.Open("sqlite3", ":memory:")
+    if err != nil {
+        t.Fatalf("open DB: %v", err)
+    }
+    defer db.Close()
+    if err := datastore.RunMigrations(db); err != nil {
+        t.Fatalf("migrations: %v", err)
+    }
+
+    existing, _, _ := CreateLink(db, "https://a.example", CreateLinkOptions{OwnerID: "team-a"})
+
+    // 1) A batch is stored at once; reuse works against earlier rows
+    links, created, err := CreateLinks(db, []LinkRequest{
+        {TargetURL: "https://a.example", Options: CreateLinkOptions{OwnerID: "team-a", ReuseExisting: true}},
+        {TargetURL: "https://b.example", Options: CreateLinkOptions{OwnerID: "team-a"}},
+        {TargetURL: "https://c.example", Options: CreateLinkOptions{OwnerID: "team-a"}},
+    })
+    if err != nil {
+        t.Fatalf("CreateLinks: %v", err)
+    }
+    if len(links) != 3 || links[0].Shortcode != existing.Shortcode {
+        t.Fatalf("CreateLinks: unexpected result %+v", links)
+    }
+    if created[0] || !created[1] || !created[2] {
+        t.Errorf("created = %v, want [false true true]", created)
+    }
+    if links[1].Shortcode == "" || links[1].Shortcode == links[2].Shortcode {
+        t.Error("batch links need distinct codes")
+    }
+    var count int
+    db.QueryRow("SELECT COUNT(*) FROM links").Scan(&count)
+    if count != 3 {
+        t.Errorf("links after batch: want 3, got %d", count)
+    }
+
+    // 2) A failing insert rolls back the whole batch
+    db.Exec(`CREATE TRIGGER fail_insert BEFORE INSERT ON links
+        WHEN NEW.target_url = 'https://fail.example'
+        BEGIN SELECT RAISE(ABORT, 'boom'); END`)
+    _, _, err = CreateLinks(db, []LinkRequest{
+        {TargetURL: "https://d.example"},
+        {TargetURL: "https://fail.example"},
+    })
+    if err == nil {
+        t.Fatal("expected batch error")
+    }
+    db.QueryRow("SELECT COUNT(*) FROM links").Scan(&count)
+    if count != 3 {
+        t.Errorf("links after failed batch: want 3, got %d", count)
+    }
+}
@@ -3,8 +3,10 @@ package service
 import (
     "database/sql"
     "testing"
+    "time"
 
     _ "github.com/mattn/go-sqlite3"
+    "github.com/valorm/snapurl/internal/models"
 )
 
 func TestIncrementHits(t *testing.T) {
@@ -14,6 +16,7 @@ func TestIncrementHits(t *testing.T) {
     db.Exec(`
         CREATE TABLE links (
             id INTEGER PRIMARY KEY AUTOINCREMENT,
+            workspace_id INTEGER NOT NULL DEFAULT 1,
             shortcode TEXT UNIQUE NOT NULL,
             target_url TEXT NOT NULL,
             created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
@@ -28,7 +31,7 @@ func TestIncrementHits(t *testing.T) {
     db.Exec("INSERT INTO links (shortcode, target_url) VALUES (?, ?)", code, "https://x")
 
     // Increment once
-    if err := IncrementHits(db, code); err != nil {
+    if err := IncrementHits(db, models.DefaultWorkspaceID, code); err != nil {
         t.Fatalf("first increment: %v", err)
     }
     // Verify
@@ -39,14 +42,76 @@ func TestIncrementHits(t *testing.T) {
     }
 
     // Increment again
-    IncrementHits(db, code)
+    IncrementHits(db, models.DefaultWorkspaceID, code)
     db.QueryRow("SELECT hits FROM links WHERE shortcode = ?", code).Scan(&hits)
     if hits != 2 {
         t.Fatalf("expected 2 hits, got %d", hits)
     }
 
     // Try incrementing nonexistent code
-    if err := IncrementHits(db, "nope"); err == nil {
+    if err := IncrementHits(db, models.DefaultWorkspaceID, "nope"); err == nil {
         t.Fatal("expected error for nonexistent code")
     }
 }
+
+func TestHitCounter(t *testing.T) {
+    db, _ := sql.Open("sqlite3", ":memory:")
+    defer db.Close()
+    db.SetMaxOpenConns(1)
+    db.Exec(`
+        CREATE TABLE links (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            workspace_id INTEGER NOT NULL DEFAULT 1,
+            shortcode TEXT NOT NULL,
+            target_url TEXT NOT NULL,
+            hits INTEGER DEFAULT 0
+        );
+    `)
+    db.Exec("INSERT INTO links (workspace_id, shortcode, target_url) VALUES (1, 'a', 'https://x'), (2, 'a', 'https://x'), (1, 'b', 'https://x')")
+    hits := func(workspaceID int, code string) int {
+        var n int
+        db.QueryRow("SELECT hits FROM links WHERE workspace_id = ? AND shortcode = ?", workspaceID, code).Scan(&n)
+        return n
+    }
+
+    // 1) Hits are kept in memory until flushed
+    h := NewHitCounter(db, time.Hour)
+    h.Add(1, "a")
+    h.Add(1, "a")
+    h.Add(2, "a")
+    if n := hits(1, "a"); n != 0 {
+        t.Fatalf("hits before flush: %d", n)
+    }
+    if err := h.Flush(); err != nil {
+        t.Fatalf("Flush: %v", err)
+    }
+    if hits(1, "a") != 2 || hits(2, "a") != 1 || hits(1, "b") != 0 {
+        t.Errorf("hits after flush: %d %d %d", hits(1, "a"), hits(2, "a"), hits(1, "b"))
+    }
+
+    // 2) Hits that fail to be written are kept and retried after the delay
+    h = NewHitCounter(db, 10*time.Millisecond)
+    db.Exec("CREATE TRIGGER fail_hits BEFORE UPDATE ON links BEGIN SELECT RAISE(ABORT, 'busy'); END")
+    h.Add(1, "b")
+    if err := h.Flush(); err == nil {
+        t.Fatal("Flush: want error")
+    }
+    db.Exec("DROP TRIGGER fail_hits")
+    deadline := time.Now().Add(2 * time.Second)
+    for hits(1, "b") != 1 && time.Now().Before(deadline) {
+        time.Sleep(10 * time.Millisecond)
+    }
+    if n := hits(1, "b"); n != 1 {
+        t.Errorf("hits after retry: want 1, got %d", n)
+    }
+
+    // 3) Without an explicit flush, hits are written after the delay
+    h.Add(1, "b")
+    deadline = time.Now().Add(2 * time.Second)
+    for hits(1, "b") != 2 && time.Now().Before(deadline) {
+        time.Sleep(10 * time.Millisecond)
+    }
+    if n := hits(1, "b"); n != 2 {
+        t.Errorf("hits after delay: want 2, got %d", n)
+    }
+}
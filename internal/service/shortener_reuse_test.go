@@ -0,0 +1,108 @@
+package service
+
+import (
+    "database/sql"
+    "testing"
+    "time"
+
+    _ "github.com/mattn/go-sqlite3"
+    "github.com/valorm/snapurl/internal/datastore"
+)
+
+func TestNormalizeTargetURL(t *testing.T) {
+    cases := map[string]string{
+        "HTTPS://Example.COM":           "https://example.com/",
+        "https://example.com:443/a?b=1": "https://example.com/a?b=1",
+        "http://example.com:8080/A":     "http://example.com:8080/A",
+        "http://[::1]:80/":              "http://[::1]/",
+        "not a url":                     "not a url",
+    }
+    for in, want := range cases {
+        if got := NormalizeTargetURL(in); got != want {
+            t.Errorf("NormalizeTargetURL(%q): want %q, got %q", in, want, got)
+        }
+    }
+}
+
+func TestCreateLinkReuseExisting(t *testing.T) {
+    db, err := sql.Open("sqlite3", ":memory:")
+    if err != nil {
+        t.Fatalf("open DB: %v", err)
+    }
+    defer db.Close()
+    if err := datastore.RunMigrations(db); err != nil {
+        t.Fatalf("migrations: %v", err)
+    }
+
+    reuse := CreateLinkOptions{OwnerID: "team-a", ReuseExisting: true}
+    first, created, err := CreateLink(db, "https://Example.com", reuse)
+    if err != nil || !created {
+        t.Fatalf("CreateLink: %v, created %v", err, created)
+    }
+
+    // 1) Same normalized target and owner returns the existing link
+    again, created, err := CreateLink(db, "https://example.com:443/", reuse)
+    if err != nil || created {
+        t.Fatalf("CreateLink (reuse): %v, created %v", err, created)
+    }
+    if again.Shortcode != first.Shortcode {
+        t.Errorf("reuse: want %s, got %s", first.Shortcode, again.Shortcode)
+    }
+
+    // 2) Without the option, other owners and expiring links get new codes
+    fresh, _, _ := CreateLink(db, "https://example.com", CreateLinkOptions{OwnerID: "team-a"})
+    other, _, _ := CreateLink(db, "https://example.com", CreateLinkOptions{OwnerID: "team-b", ReuseExisting: true})
+    future := time.Now().Add(time.Hour)
+    expiring, _, _ := CreateLink(db, "https://example.com", CreateLinkOptions{OwnerID: "team-a", ReuseExisting: true, Expiry: &future})
+    for name, l := range map[string]string{"no reuse": fresh.Shortcode, "other owner": other.Shortcode, "expiry": expiring.Shortcode} {
+        if l == "" || l == first.Shortcode {
+            t.Errorf("%s: expected a new link, got %q", name, l)
+        }
+    }
+
+    // 3) Revoked links are not reused
+    if err := RevokeLink(db, first.WorkspaceID, first.Shortcode, "", Revocation{}); err != nil {
+        t.Fatalf("RevokeLink: %v", err)
+    }
+    if err := RevokeLink(db, fresh.WorkspaceID, fresh.Shortcode, "", Revocation{}); err != nil {
+        t.Fatalf("RevokeLink: %v", err)
+    }
+    after, _, err := CreateLink(db, "https://example.com", reuse)
+    if err != nil {
+        t.Fatalf("CreateLink (after revoke): %v", err)
+    }
+    if after.Shortcode == first.Shortcode || after.Shortcode == fresh.Shortcode {
+        t.Error("revoked link was reused")
+    }
+}
+
+func TestBackfillNormalizedURLs(t *testing.T) {
+    db, err := sql.Open("sqlite3", ":memory:")
+    if err != nil {
+        t.Fatalf("open DB: %v", err)
+    }
+    defer db.Close()
+    if err := datastore.RunMigrations(db); err != nil {
+        t.Fatalf("migrations: %v", err)
+    }
+
+    // 1) Links stored before migration 0007 have no normalized URL
+    db.Exec("INSERT INTO links (shortcode, target_url, owner_id) VALUES ('legacy1', 'HTTPS://Example.COM:443', 'team-a')")
+    if n, err := BackfillNormalizedURLs(db); err != nil || n != 1 {
+        t.Fatalf("BackfillNormalizedURLs: %d, %v", n, err)
+    }
+    var normalized string
+    db.QueryRow("SELECT normalized_url FROM links WHERE shortcode = 'legacy1'").Scan(&normalized)
+    if normalized != "https://example.com/" {
+        t.Errorf("normalized_url: got %q", normalized)
+    }
+
+    // 2) Afterwards they are reused, and a second run has nothing to do
+    link, created, err := CreateLink(db, "https://example.com/", CreateLinkOptions{OwnerID: "team-a", ReuseExisting: true})
+    if err != nil || created || link.Shortcode != "legacy1" {
+        t.Errorf("CreateLink (reuse): %q, created %v, %v", link.Shortcode, created, err)
+    }
+    if n, err := BackfillNormalizedURLs(db); err != nil || n != 0 {
+        t.Errorf("second BackfillNormalizedURLs: %d, %v", n, err)
+    }
+}
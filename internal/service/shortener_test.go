@@ -2,10 +2,12 @@ package service
 
 import (
     "database/sql"
+    "errors"
     "testing"
     "time"
 
     _ "github.com/mattn/go-sqlite3"
+    "github.com/valorm/snapurl/internal/models"
 )
 
 func TestCreateAndResolveLink(t *testing.T) {
@@ -20,12 +22,24 @@ func TestCreateAndResolveLink(t *testing.T) {
     _, err = db.Exec(`
         CREATE TABLE links (
             id INTEGER PRIMARY KEY AUTOINCREMENT,
+            workspace_id INTEGER NOT NULL DEFAULT 1,
             shortcode TEXT UNIQUE NOT NULL,
             target_url TEXT NOT NULL,
+            normalized_url TEXT NOT NULL DEFAULT '',
             created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
             hits INTEGER DEFAULT 0,
             expires_at TIMESTAMP NULL,
-            revoked BOOLEAN DEFAULT 0
+            revoked BOOLEAN DEFAULT 0,
+            owner_id TEXT NOT NULL DEFAULT '',
+            revoked_at TIMESTAMP NULL,
+            revoked_reason TEXT NOT NULL DEFAULT '',
+            revoked_by TEXT NOT NULL DEFAULT '',
+            revoked_reason_public BOOLEAN NOT NULL DEFAULT 0
+        );
+        CREATE TABLE links_archive (
+            id INTEGER PRIMARY KEY,
+            workspace_id INTEGER NOT NULL,
+            shortcode TEXT NOT NULL
         )
     `)
     if err != nil {
@@ -33,7 +47,7 @@ func TestCreateAndResolveLink(t *testing.T) {
     }
 
     // 1) Create link without expiry
-    link, err := CreateLink(db, "https://example.com", nil)
+    link, _, err := CreateLink(db, "https://example.com", CreateLinkOptions{})
     if err != nil {
         t.Fatalf("CreateLink: %v", err)
     }
@@ -42,7 +56,7 @@ func TestCreateAndResolveLink(t *testing.T) {
     }
 
     // Resolve it
-    resolved, err := ResolveLink(db, link.Shortcode)
+    resolved, err := ResolveLink(db, models.DefaultWorkspaceID, link.Shortcode)
     if err != nil {
         t.Fatalf("ResolveLink: %v", err)
     }
@@ -52,14 +66,17 @@ func TestCreateAndResolveLink(t *testing.T) {
 
     // 2) Create with expiry in the past
     past := time.Now().Add(-1 * time.Hour)
-    expiredLink, err := CreateLink(db, "https://expired.com", &past)
+    expiredLink, _, err := CreateLink(db, "https://expired.com", CreateLinkOptions{Expiry: &past})
     if err != nil {
         t.Fatalf("CreateLink (expired): %v", err)
     }
 
     // Attempt to resolve expired
-    _, err = ResolveLink(db, expiredLink.Shortcode)
+    _, err = ResolveLink(db, models.DefaultWorkspaceID, expiredLink.Shortcode)
     if err == nil {
         t.Fatal("expected error resolving expired link")
     }
+    if !errors.Is(err, ErrLinkExpired) {
+        t.Errorf("want ErrLinkExpired, got %v", err)
+    }
 }
@@ -0,0 +1,266 @@
+package service
+
+import (
+    "database/sql"
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/valorm/snapurl/internal/models"
+)
+
+// Conflict policies for ImportLinks when a shortcode already exists in the
+// workspace.
+const (
+    ConflictSkip      = "skip"
+    ConflictOverwrite = "overwrite"
+    ConflictFail      = "fail"
+)
+
+var (
+    // ErrImportConflict is returned by (*Importer).CheckConflicts and Add
+    // under ConflictFail.
+    ErrImportConflict = errors.New("shortcode already exists")
+    // ErrInvalidImport wraps errors about a single imported link that do
+    // not affect the rest of the import.
+    ErrInvalidImport = errors.New("invalid link")
+)
+
+const maxShortcodeLen = 64
+
+// reservedShortcodes are paths served by other routes.
+var reservedShortcodes = map[string]bool{"api": true, "health": true, "metrics": true, "shorten": true}
+
+// ExportLinks calls fn for every link matching f, oldest first, while
+// reading them from the database. Limit and Offset are ignored.
+func ExportLinks(db *sql.DB, f ListLinksFilter, fn func(models.Link) error) error {
+    rows, err := db.Query(
+        "SELECT "+linkColumns+" FROM links WHERE (? = '' OR owner_id = ?) AND (? = 0 OR workspace_id = ?) ORDER BY id",
+        f.OwnerID, f.OwnerID, f.WorkspaceID, f.WorkspaceID,
+    )
+    if err != nil {
+        return fmt.Errorf("query links: %w", err)
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        link, err := scanLink(rows)
+        if err != nil {
+            return fmt.Errorf("scan link: %w", err)
+        }
+        if err := fn(link); err != nil {
+            return err
+        }
+    }
+    return rows.Err()
+}
+
+// Import outcomes reported by (*Importer).Add.
+const (
+    ImportCreated     = "created"
+    ImportOverwritten = "overwritten"
+    ImportSkipped     = "skipped"
+)
+
+// importBatchSize bounds the links an Importer writes per transaction, so
+// other writers wait for at most one batch.
+const importBatchSize = 500
+
+// Importer adds links with their original shortcodes in transactions of
+// up to importBatchSize links. Nothing of the current batch is stored
+// until it fills up or Commit is called; in a dry run every batch is
+// rolled back instead.
+type Importer struct {
+    db         *sql.DB
+    conflict   string
+    dryRun     bool
+    workspaces map[int]bool
+
+    tx      *sql.Tx // current batch, nil between batches
+    pending int
+}
+
+// BeginImport starts an import with the given conflict policy.
+func BeginImport(db *sql.DB, conflict string, dryRun bool) (*Importer, error) {
+    switch conflict {
+    case ConflictSkip, ConflictOverwrite, ConflictFail:
+    default:
+        return nil, fmt.Errorf("unknown conflict policy %q", conflict)
+    }
+    im := &Importer{db: db, conflict: conflict, dryRun: dryRun, workspaces: map[int]bool{}}
+
+    rows, err := db.Query("SELECT id FROM workspaces")
+    if err != nil {
+        return nil, fmt.Errorf("query workspaces: %w", err)
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var id int
+        if err := rows.Scan(&id); err != nil {
+            return nil, fmt.Errorf("scan workspace: %w", err)
+        }
+        im.workspaces[id] = true
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+    return im, nil
+}
+
+// CheckConflicts returns ErrImportConflict under ConflictFail when one of
+// the links' shortcodes already exists, so a failing import stores
+// nothing. Other policies never conflict.
+func (im *Importer) CheckConflicts(links []models.Link) error {
+    if im.conflict != ConflictFail {
+        return nil
+    }
+    for _, link := range links {
+        workspaceID := link.WorkspaceID
+        if workspaceID == 0 {
+            workspaceID = models.DefaultWorkspaceID
+        }
+        var n int
+        err := im.db.QueryRow(
+            "SELECT COUNT(*) FROM links WHERE workspace_id = ? AND shortcode = ?",
+            workspaceID, link.Shortcode,
+        ).Scan(&n)
+        if err != nil {
+            return fmt.Errorf("query link: %w", err)
+        }
+        if n > 0 {
+            return fmt.Errorf("%w: %s", ErrImportConflict, link.Shortcode)
+        }
+    }
+    return nil
+}
+
+// Add imports one link, keeping its shortcode, hits, timestamps and
+// revocation details. The target URL must already be validated. A zero
+// WorkspaceID means the default workspace, a zero CreatedAt means now and
+// a revoked link without RevokedAt counts as revoked now.
+func (im *Importer) Add(link models.Link) (string, error) {
+    if link.WorkspaceID == 0 {
+        link.WorkspaceID = models.DefaultWorkspaceID
+    }
+    if !im.workspaces[link.WorkspaceID] {
+        return "", fmt.Errorf("%w: unknown workspace %d", ErrInvalidImport, link.WorkspaceID)
+    }
+    if err := validShortcode(link.Shortcode); err != nil {
+        return "", err
+    }
+    if link.CreatedAt.IsZero() {
+        link.CreatedAt = time.Now()
+    }
+    if !link.Revoked {
+        link.RevokedAt, link.RevokedReason, link.RevokedBy, link.ReasonPublic = sql.NullTime{}, "", "", false
+    } else if !link.RevokedAt.Valid {
+        link.RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+    }
+
+    if im.tx == nil {
+        tx, err := im.db.Begin()
+        if err != nil {
+            return "", fmt.Errorf("begin tx: %w", err)
+        }
+        im.tx = tx
+    }
+    outcome, err := im.add(link)
+    if err != nil {
+        return "", err
+    }
+    if im.pending++; im.pending >= importBatchSize {
+        if err := im.endBatch(); err != nil {
+            return "", err
+        }
+    }
+    return outcome, nil
+}
+
+func (im *Importer) add(link models.Link) (string, error) {
+    archived, err := shortcodeArchived(im.tx, link.WorkspaceID, link.Shortcode)
+    if err != nil {
+        return "", err
+    }
+    if archived {
+        return "", fmt.Errorf("%w: shortcode %q belongs to an archived link", ErrInvalidImport, link.Shortcode)
+    }
+
+    var id int
+    err = im.tx.QueryRow(
+        "SELECT id FROM links WHERE workspace_id = ? AND shortcode = ?",
+        link.WorkspaceID, link.Shortcode,
+    ).Scan(&id)
+    switch {
+    case err == sql.ErrNoRows:
+        _, err = im.tx.Exec(
+            "INSERT INTO links (workspace_id, shortcode, target_url, normalized_url, created_at, hits, expires_at, revoked, revoked_at, revoked_reason, revoked_by, revoked_reason_public, owner_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+            link.WorkspaceID, link.Shortcode, link.TargetURL, NormalizeTargetURL(link.TargetURL), link.CreatedAt, link.Hits, link.ExpiresAt, link.Revoked, link.RevokedAt, link.RevokedReason, link.RevokedBy, link.ReasonPublic, link.OwnerID,
+        )
+        if err != nil {
+            return "", fmt.Errorf("insert link: %w", err)
+        }
+        return ImportCreated, nil
+    case err != nil:
+        return "", fmt.Errorf("query link: %w", err)
+    }
+
+    switch im.conflict {
+    case ConflictSkip:
+        return ImportSkipped, nil
+    case ConflictFail:
+        return "", fmt.Errorf("%w: %s", ErrImportConflict, link.Shortcode)
+    }
+    _, err = im.tx.Exec(
+        "UPDATE links SET target_url = ?, normalized_url = ?, created_at = ?, hits = ?, expires_at = ?, revoked = ?, revoked_at = ?, revoked_reason = ?, revoked_by = ?, revoked_reason_public = ?, owner_id = ? WHERE id = ?",
+        link.TargetURL, NormalizeTargetURL(link.TargetURL), link.CreatedAt, link.Hits, link.ExpiresAt, link.Revoked, link.RevokedAt, link.RevokedReason, link.RevokedBy, link.ReasonPublic, link.OwnerID, id,
+    )
+    if err != nil {
+        return "", fmt.Errorf("overwrite link: %w", err)
+    }
+    return ImportOverwritten, nil
+}
+
+// endBatch commits the current batch, or rolls it back in a dry run.
+func (im *Importer) endBatch() error {
+    tx := im.tx
+    im.tx, im.pending = nil, 0
+    if im.dryRun {
+        return tx.Rollback()
+    }
+    if err := tx.Commit(); err != nil {
+        return fmt.Errorf("commit import: %w", err)
+    }
+    return nil
+}
+
+// Commit stores the last batch of imported links.
+func (im *Importer) Commit() error {
+    if im.tx == nil {
+        return nil
+    }
+    return im.endBatch()
+}
+
+// Rollback discards the current batch; batches already committed stay.
+// It is safe to call after Commit.
+func (im *Importer) Rollback() error {
+    if im.tx == nil {
+        return nil
+    }
+    tx := im.tx
+    im.tx, im.pending = nil, 0
+    return tx.Rollback()
+}
+
+// validShortcode accepts codes made of letters, digits, '-' and '_' that
+// do not collide with other routes.
+func validShortcode(code string) error {
+    invalid := strings.IndexFunc(code, func(r rune) bool {
+        return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_')
+    }) >= 0
+    if code == "" || len(code) > maxShortcodeLen || invalid || reservedShortcodes[code] {
+        return fmt.Errorf("%w: shortcode %q", ErrInvalidImport, code)
+    }
+    return nil
+}
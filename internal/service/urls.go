@@ -0,0 +1,123 @@
+package service
+
+import (
+    "errors"
+    "fmt"
+    "net"
+    "net/url"
+    "strings"
+    "unicode"
+
+    "github.com/valorm/snapurl/pkg/util"
+)
+
+// ErrInvalidURL wraps every target URL validation failure.
+var ErrInvalidURL = errors.New("invalid url")
+
+// Defaults used when the configuration leaves the URL policy empty.
+var DefaultAllowedSchemes = []string{"http", "https"}
+
+const DefaultMaxURLLength = 2048
+
+// ValidateTargetURL checks a target URL against the scheme allowlist and
+// length limit and returns it normalized: internationalized hosts are
+// converted to punycode, scheme and host lowercased and default ports
+// dropped; unlike NormalizeTargetURL the path is kept as given. Errors wrap
+// ErrInvalidURL and say what is wrong. Empty policy values use the defaults.
+func ValidateTargetURL(raw string, allowedSchemes []string, maxLength int) (string, error) {
+    if len(allowedSchemes) == 0 {
+        allowedSchemes = DefaultAllowedSchemes
+    }
+    if maxLength <= 0 {
+        maxLength = DefaultMaxURLLength
+    }
+
+    raw = strings.TrimSpace(raw)
+    if raw == "" {
+        return "", fmt.Errorf("%w: url is empty", ErrInvalidURL)
+    }
+    if len(raw) > maxLength {
+        return "", fmt.Errorf("%w: url is longer than %d characters", ErrInvalidURL, maxLength)
+    }
+    if strings.IndexFunc(raw, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0 {
+        return "", fmt.Errorf("%w: url contains whitespace or control characters", ErrInvalidURL)
+    }
+
+    u, err := url.Parse(raw)
+    if err != nil {
+        return "", fmt.Errorf("%w: cannot parse url", ErrInvalidURL)
+    }
+    if u.Scheme == "" {
+        return "", fmt.Errorf("%w: missing scheme, e.g. https://", ErrInvalidURL)
+    }
+    scheme := strings.ToLower(u.Scheme)
+    if !contains(allowedSchemes, scheme) {
+        return "", fmt.Errorf("%w: scheme %q is not allowed", ErrInvalidURL, scheme)
+    }
+
+    switch {
+    case u.Host != "":
+        host, err := validateHost(u.Hostname())
+        if err != nil {
+            return "", fmt.Errorf("%w: %v", ErrInvalidURL, err)
+        }
+        if port := u.Port(); port != "" {
+            host = net.JoinHostPort(host, port)
+        } else if strings.Contains(host, ":") {
+            host = "[" + host + "]"
+        }
+        u.Host = host
+    case scheme == "http" || scheme == "https":
+        return "", fmt.Errorf("%w: missing host", ErrInvalidURL)
+    case u.Opaque == "" && u.Path == "":
+        return "", fmt.Errorf("%w: nothing after the scheme", ErrInvalidURL)
+    }
+
+    normalized := u.String()
+    if c, ok := canonicalURL(normalized); ok {
+        normalized = c.String()
+    }
+    if len(normalized) > maxLength {
+        return "", fmt.Errorf("%w: url is longer than %d characters", ErrInvalidURL, maxLength)
+    }
+    return normalized, nil
+}
+
+// validateHost returns the ASCII form of a host name or IP address.
+func validateHost(host string) (string, error) {
+    if ip := net.ParseIP(host); ip != nil {
+        return ip.String(), nil
+    }
+
+    ascii, err := util.ToASCII(strings.TrimSuffix(host, "."))
+    if err != nil {
+        return "", fmt.Errorf("invalid host %q: %v", host, err)
+    }
+    if ascii == "" || len(ascii) > 253 {
+        return "", fmt.Errorf("invalid host %q: bad length", host)
+    }
+    for _, label := range strings.Split(ascii, ".") {
+        if label == "" || len(label) > 63 {
+            return "", fmt.Errorf("invalid host %q: bad label length", host)
+        }
+        if label[0] == '-' || label[len(label)-1] == '-' {
+            return "", fmt.Errorf("invalid host %q: label starts or ends with a hyphen", host)
+        }
+        for i := 0; i < len(label); i++ {
+            c := label[i]
+            if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+                return "", fmt.Errorf("invalid host %q: character %q not allowed", host, c)
+            }
+        }
+    }
+    return ascii, nil
+}
+
+func contains(list []string, s string) bool {
+    for _, v := range list {
+        if strings.EqualFold(v, s) {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+    "errors"
+    "strings"
+    "testing"
+)
+
+func TestValidateTargetURL(t *testing.T) {
+    valid := map[string]string{
+        "https://Example.COM":             "https://example.com",
+        "  http://example.com:80/a?b=c  ": "http://example.com/a?b=c",
+        "https://Bücher.example/straße":   "https://xn--bcher-kva.example/stra%C3%9Fe",
+        "http://[::1]:8080/x":             "http://[::1]:8080/x",
+        "https://127.0.0.1/":              "https://127.0.0.1/",
+    }
+    for in, want := range valid {
+        got, err := ValidateTargetURL(in, nil, 0)
+        if err != nil {
+            t.Errorf("ValidateTargetURL(%q): %v", in, err)
+            continue
+        }
+        if got != want {
+            t.Errorf("ValidateTargetURL(%q): want %q, got %q", in, want, got)
+        }
+    }
+
+    invalid := map[string]string{
+        "":                        "empty",
+        "javascript:alert(1)":     `scheme "javascript" is not allowed`,
+        "file:///etc/passwd":      `scheme "file" is not allowed`,
+        "example.com/path":        "missing scheme",
+        "https://":                "missing host",
+        "https:/path":             "missing host",
+        "https://exa mple.com":    "whitespace",
+        "https://-bad-.example":   "hyphen",
+        "https://bad_%21.example": "cannot parse",
+        "https://x.example/" + strings.Repeat("a", DefaultMaxURLLength): "longer than",
+    }
+    for in, want := range invalid {
+        _, err := ValidateTargetURL(in, nil, 0)
+        if !errors.Is(err, ErrInvalidURL) {
+            t.Errorf("ValidateTargetURL(%q): want ErrInvalidURL, got %v", in, err)
+            continue
+        }
+        if !strings.Contains(err.Error(), want) {
+            t.Errorf("ValidateTargetURL(%q): want error mentioning %q, got %q", in, want, err)
+        }
+    }
+
+    // A configured allowlist and limit replace the defaults
+    if _, err := ValidateTargetURL("mailto:ops@example.com", []string{"https", "mailto"}, 0); err != nil {
+        t.Errorf("mailto with allowlist: %v", err)
+    }
+    if _, err := ValidateTargetURL("http://example.com", []string{"https"}, 0); err == nil {
+        t.Error("expected http to be rejected by https-only allowlist")
+    }
+    if _, err := ValidateTargetURL("https://example.com/long", nil, 20); err == nil {
+        t.Error("expected max length to be enforced")
+    }
+}
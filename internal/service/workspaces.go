@@ -0,0 +1,199 @@
+package service
+
+import (
+    "database/sql"
+    "errors"
+    "fmt"
+    "net"
+    "strings"
+    "time"
+
+    "github.com/valorm/snapurl/internal/models"
+)
+
+// ErrDomainTaken is returned when a host is already mapped to a workspace.
+var ErrDomainTaken = errors.New("domain already belongs to a workspace")
+
+// NormalizeHost lowercases a host and strips any port and trailing dot so
+// it can be compared with stored workspace domains.
+func NormalizeHost(host string) string {
+    host = strings.TrimSpace(host)
+    if h, _, err := net.SplitHostPort(host); err == nil {
+        host = h
+    }
+    return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// CreateWorkspace creates a workspace served on the given hosts.
+func CreateWorkspace(db *sql.DB, name string, domains []string) (models.Workspace, error) {
+    tx, err := db.Begin()
+    if err != nil {
+        return models.Workspace{}, fmt.Errorf("begin tx: %w", err)
+    }
+    defer tx.Rollback()
+
+    createdAt := time.Now().UTC()
+    res, err := tx.Exec("INSERT INTO workspaces (name, created_at) VALUES (?, ?)", name, createdAt)
+    if err != nil {
+        return models.Workspace{}, fmt.Errorf("insert workspace: %w", err)
+    }
+    id, _ := res.LastInsertId()
+
+    ws := models.Workspace{ID: int(id), Name: name, CreatedAt: createdAt, Domains: []string{}}
+    for _, d := range domains {
+        host, err := addDomain(tx, ws.ID, d)
+        if err != nil {
+            return models.Workspace{}, err
+        }
+        ws.Domains = append(ws.Domains, host)
+    }
+
+    if err := tx.Commit(); err != nil {
+        return models.Workspace{}, fmt.Errorf("commit workspace: %w", err)
+    }
+    return ws, nil
+}
+
+// ListWorkspaces returns all workspaces with their domains.
+func ListWorkspaces(db *sql.DB) ([]models.Workspace, error) {
+    rows, err := db.Query("SELECT id, name, created_at FROM workspaces ORDER BY id")
+    if err != nil {
+        return nil, fmt.Errorf("query workspaces: %w", err)
+    }
+    defer rows.Close()
+
+    workspaces := []models.Workspace{}
+    index := make(map[int]int)
+    for rows.Next() {
+        ws := models.Workspace{Domains: []string{}}
+        if err := rows.Scan(&ws.ID, &ws.Name, &ws.CreatedAt); err != nil {
+            return nil, fmt.Errorf("scan workspace: %w", err)
+        }
+        index[ws.ID] = len(workspaces)
+        workspaces = append(workspaces, ws)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    domains, err := db.Query("SELECT host, workspace_id FROM workspace_domains ORDER BY rowid")
+    if err != nil {
+        return nil, fmt.Errorf("query workspace domains: %w", err)
+    }
+    defer domains.Close()
+    for domains.Next() {
+        var host string
+        var id int
+        if err := domains.Scan(&host, &id); err != nil {
+            return nil, fmt.Errorf("scan workspace domain: %w", err)
+        }
+        if i, ok := index[id]; ok {
+            workspaces[i].Domains = append(workspaces[i].Domains, host)
+        }
+    }
+    return workspaces, domains.Err()
+}
+
+// AddWorkspaceDomain maps an additional host to a workspace.
+func AddWorkspaceDomain(db *sql.DB, workspaceID int, domain string) (string, error) {
+    var exists int
+    err := db.QueryRow("SELECT 1 FROM workspaces WHERE id = ?", workspaceID).Scan(&exists)
+    if err == sql.ErrNoRows {
+        return "", ErrNotFound
+    }
+    if err != nil {
+        return "", fmt.Errorf("query workspace: %w", err)
+    }
+    return addDomain(db, workspaceID, domain)
+}
+
+// RemoveWorkspaceDomain unmaps a host from a workspace.
+func RemoveWorkspaceDomain(db *sql.DB, workspaceID int, domain string) error {
+    res, err := db.Exec(
+        "DELETE FROM workspace_domains WHERE host = ? AND workspace_id = ?",
+        NormalizeHost(domain), workspaceID,
+    )
+    if err != nil {
+        return fmt.Errorf("delete workspace domain: %w", err)
+    }
+    rows, err := res.RowsAffected()
+    if err != nil {
+        return fmt.Errorf("check rows affected: %w", err)
+    }
+    if rows == 0 {
+        return ErrNotFound
+    }
+    return nil
+}
+
+// WorkspaceForHost returns the workspace a request host belongs to. Hosts
+// that are not mapped belong to the default workspace.
+func WorkspaceForHost(db *sql.DB, host string) (int, error) {
+    id, err := LookupWorkspaceDomain(db, host)
+    if errors.Is(err, ErrNotFound) {
+        return models.DefaultWorkspaceID, nil
+    }
+    return id, err
+}
+
+// LookupWorkspaceDomain returns the workspace a host is mapped to, or
+// ErrNotFound when it is not mapped.
+func LookupWorkspaceDomain(db *sql.DB, host string) (int, error) {
+    var id int
+    err := db.QueryRow(
+        "SELECT workspace_id FROM workspace_domains WHERE host = ?",
+        NormalizeHost(host),
+    ).Scan(&id)
+    if err == sql.ErrNoRows {
+        return 0, ErrNotFound
+    }
+    if err != nil {
+        return 0, fmt.Errorf("query workspace domain: %w", err)
+    }
+    return id, nil
+}
+
+// PrimaryDomain returns the first host mapped to a workspace, or "" when
+// the workspace has none.
+func PrimaryDomain(db *sql.DB, workspaceID int) (string, error) {
+    var host string
+    err := db.QueryRow(
+        "SELECT host FROM workspace_domains WHERE workspace_id = ? ORDER BY rowid LIMIT 1",
+        workspaceID,
+    ).Scan(&host)
+    if err == sql.ErrNoRows {
+        return "", nil
+    }
+    if err != nil {
+        return "", fmt.Errorf("query primary domain: %w", err)
+    }
+    return host, nil
+}
+
+// addDomain inserts a normalized host for a workspace.
+func addDomain(db interface {
+    Exec(string, ...any) (sql.Result, error)
+    QueryRow(string, ...any) *sql.Row
+}, workspaceID int, domain string) (string, error) {
+    host := NormalizeHost(domain)
+    if host == "" {
+        return "", fmt.Errorf("domain must not be empty")
+    }
+
+    var owner int
+    err := db.QueryRow("SELECT workspace_id FROM workspace_domains WHERE host = ?", host).Scan(&owner)
+    if err == nil {
+        return "", ErrDomainTaken
+    }
+    if err != sql.ErrNoRows {
+        return "", fmt.Errorf("query workspace domain: %w", err)
+    }
+
+    if _, err := db.Exec(
+        "INSERT INTO workspace_domains (host, workspace_id, created_at) VALUES (?, ?, ?)",
+        host, workspaceID, time.Now().UTC(),
+    ); err != nil {
+        return "", fmt.Errorf("insert workspace domain: %w", err)
+    }
+    return host, nil
+}
@@ -3,21 +3,36 @@ package telemetry
 import (
     "database/sql"
     "sync/atomic"
+    "time"
 )
 
 // Atomic counters
 var (
     urlsCreated     uint64
     redirectsServed uint64
+    linksBlocked    uint64
+    linksArchived   uint64
+    linksDeleted    uint64
 )
 
 // Increment increases the named counter
 func Increment(name string) {
+    Add(name, 1)
+}
+
+// Add increases the named counter by n
+func Add(name string, n uint64) {
     switch name {
     case "urls_created":
-        atomic.AddUint64(&urlsCreated, 1)
+        atomic.AddUint64(&urlsCreated, n)
     case "redirects_served":
-        atomic.AddUint64(&redirectsServed, 1)
+        atomic.AddUint64(&redirectsServed, n)
+    case "links_blocked":
+        atomic.AddUint64(&linksBlocked, n)
+    case "links_archived":
+        atomic.AddUint64(&linksArchived, n)
+    case "links_deleted":
+        atomic.AddUint64(&linksDeleted, n)
     }
 }
 
@@ -30,6 +45,9 @@ func GetMetrics(db *sql.DB) (map[string]uint64, error) {
     return map[string]uint64{
         "urls_created":     atomic.LoadUint64(&urlsCreated),
         "redirects_served": atomic.LoadUint64(&redirectsServed),
+        "links_blocked":    atomic.LoadUint64(&linksBlocked),
+        "links_archived":   atomic.LoadUint64(&linksArchived),
+        "links_deleted":    atomic.LoadUint64(&linksDeleted),
         "active_links":     active,
     }, nil
 }
@@ -37,12 +55,12 @@ func GetMetrics(db *sql.DB) (map[string]uint64, error) {
 // getActiveLinksCount counts non-expired, non-revoked links
 func getActiveLinksCount(db *sql.DB) (uint64, error) {
     var count uint64
+    // Count all unrevoked links minus the expired ones, so both halves can
+    // use an index instead of comparing every row
     row := db.QueryRow(`
-        SELECT COUNT(*) 
-        FROM links 
-        WHERE (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
-          AND revoked = 0
-    `)
+        SELECT (SELECT COUNT(*) FROM links WHERE revoked = 0)
+             - (SELECT COUNT(*) FROM links WHERE expires_at <= ? AND revoked = 0)
+    `, time.Now())
     if err := row.Scan(&count); err != nil {
         return 0, err
     }
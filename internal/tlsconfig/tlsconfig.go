@@ -0,0 +1,170 @@
+// Package tlsconfig builds the server's TLS settings and keeps its
+// certificate current when the files on disk are replaced.
+package tlsconfig
+
+import (
+    "crypto/tls"
+    "fmt"
+    "os"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/valorm/snapurl/internal/logging"
+)
+
+// ParseVersion accepts "1.2" or "1.3"; empty means 1.2.
+func ParseVersion(v string) (uint16, error) {
+    switch v {
+    case "", "1.2":
+        return tls.VersionTLS12, nil
+    case "1.3":
+        return tls.VersionTLS13, nil
+    }
+    return 0, fmt.Errorf("unsupported TLS version %q, want 1.2 or 1.3", v)
+}
+
+// CipherSuites maps Go's names of secure cipher suites, such as
+// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, to their IDs. Suites Go considers
+// insecure are rejected.
+func CipherSuites(names []string) ([]uint16, error) {
+    known := map[string]uint16{}
+    for _, s := range tls.CipherSuites() {
+        known[s.Name] = s.ID
+    }
+    insecure := map[string]bool{}
+    for _, s := range tls.InsecureCipherSuites() {
+        insecure[s.Name] = true
+    }
+
+    var ids []uint16
+    var bad []string
+    for _, name := range names {
+        id, ok := known[name]
+        switch {
+        case ok:
+            ids = append(ids, id)
+        case insecure[name]:
+            bad = append(bad, name+" (insecure)")
+        default:
+            bad = append(bad, name)
+        }
+    }
+    if len(bad) > 0 {
+        return nil, fmt.Errorf("unsupported cipher suites: %s", strings.Join(bad, ", "))
+    }
+    return ids, nil
+}
+
+// New returns the server TLS settings: the minimum version, the TLS 1.2
+// cipher suites (Go's defaults when empty; TLS 1.3 suites are not
+// configurable) and the certificate, read on every handshake so reloads
+// apply to new connections.
+func New(minVersion string, cipherSuites []string, cert *Certificate) (*tls.Config, error) {
+    version, err := ParseVersion(minVersion)
+    if err != nil {
+        return nil, err
+    }
+    ids, err := CipherSuites(cipherSuites)
+    if err != nil {
+        return nil, err
+    }
+    return &tls.Config{
+        MinVersion:     version,
+        CipherSuites:   ids,
+        GetCertificate: cert.GetCertificate,
+    }, nil
+}
+
+// Certificate is a key pair loaded from a certificate and a key file.
+type Certificate struct {
+    certFile string
+    keyFile  string
+
+    mu      sync.RWMutex
+    pair    *tls.Certificate
+    modTime time.Time // newest of the two files when last loaded
+}
+
+// LoadCertificate reads a PEM certificate (chain) and its key.
+func LoadCertificate(certFile, keyFile string) (*Certificate, error) {
+    c := &Certificate{certFile: certFile, keyFile: keyFile}
+    modTime, err := c.newestModTime()
+    if err != nil {
+        return nil, err
+    }
+    if err := c.load(modTime); err != nil {
+        return nil, err
+    }
+    return c, nil
+}
+
+func (c *Certificate) newestModTime() (time.Time, error) {
+    var newest time.Time
+    for _, f := range []string{c.certFile, c.keyFile} {
+        info, err := os.Stat(f)
+        if err != nil {
+            return time.Time{}, fmt.Errorf("stat certificate: %w", err)
+        }
+        if info.ModTime().After(newest) {
+            newest = info.ModTime()
+        }
+    }
+    return newest, nil
+}
+
+func (c *Certificate) load(modTime time.Time) error {
+    pair, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+    if err != nil {
+        return fmt.Errorf("load certificate: %w", err)
+    }
+    c.mu.Lock()
+    c.pair = &pair
+    c.modTime = modTime
+    c.mu.Unlock()
+    return nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (c *Certificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+    c.mu.RLock()
+    defer c.mu.RUnlock()
+    return c.pair, nil
+}
+
+// Reload rereads the files when one of them changed. On error, such as a
+// certificate that was replaced before its key, the previous pair stays in
+// use and the next Reload tries again.
+func (c *Certificate) Reload() (bool, error) {
+    modTime, err := c.newestModTime()
+    if err != nil {
+        return false, err
+    }
+    c.mu.RLock()
+    unchanged := modTime.Equal(c.modTime)
+    c.mu.RUnlock()
+    if unchanged {
+        return false, nil
+    }
+    return true, c.load(modTime)
+}
+
+// Watch polls the files every interval and reloads them on change until
+// stop is closed.
+func (c *Certificate) Watch(interval time.Duration, stop <-chan struct{}) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-stop:
+            return
+        case <-ticker.C:
+            reloaded, err := c.Reload()
+            if err != nil {
+                logging.Warnf("tls: %v", err)
+            } else if reloaded {
+                logging.Infof("tls: reloaded certificate from %s", c.certFile)
+            }
+        }
+    }
+}
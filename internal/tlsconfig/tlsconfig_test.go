@@ -0,0 +1,115 @@
+package tlsconfig
+
+import (
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/tls"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/pem"
+    "math/big"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+// writeCert writes a self-signed certificate for name and its key.
+func writeCert(t *testing.T, certFile, keyFile, name string) {
+    t.Helper()
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+    tmpl := &x509.Certificate{
+        SerialNumber: big.NewInt(time.Now().UnixNano()),
+        Subject:      pkix.Name{CommonName: name},
+        DNSNames:     []string{name},
+        NotBefore:    time.Now().Add(-time.Hour),
+        NotAfter:     time.Now().Add(time.Hour),
+    }
+    der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+    if err != nil {
+        t.Fatal(err)
+    }
+    keyDER, err := x509.MarshalECPrivateKey(key)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func servedName(t *testing.T, c *Certificate) string {
+    t.Helper()
+    pair, err := c.GetCertificate(nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    leaf, err := x509.ParseCertificate(pair.Certificate[0])
+    if err != nil {
+        t.Fatal(err)
+    }
+    return leaf.Subject.CommonName
+}
+
+func TestCertificateReload(t *testing.T) {
+    dir := t.TempDir()
+    certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+    writeCert(t, certFile, keyFile, "old.example")
+
+    c, err := LoadCertificate(certFile, keyFile)
+    if err != nil {
+        t.Fatalf("LoadCertificate: %v", err)
+    }
+    if reloaded, err := c.Reload(); reloaded || err != nil {
+        t.Fatalf("Reload without changes: %v, %v", reloaded, err)
+    }
+
+    // A certificate without its matching key keeps the old pair
+    writeCert(t, certFile, filepath.Join(dir, "other.key"), "new.example")
+    later := time.Now().Add(time.Minute)
+    os.Chtimes(certFile, later, later)
+    if _, err := c.Reload(); err == nil {
+        t.Fatal("Reload of mismatched pair: want error")
+    }
+    if name := servedName(t, c); name != "old.example" {
+        t.Fatalf("after failed reload serving %s, want old.example", name)
+    }
+
+    // Once both files are replaced the new pair is served
+    writeCert(t, certFile, keyFile, "new.example")
+    later = later.Add(time.Minute)
+    os.Chtimes(certFile, later, later)
+    if reloaded, err := c.Reload(); !reloaded || err != nil {
+        t.Fatalf("Reload: %v, %v", reloaded, err)
+    }
+    if name := servedName(t, c); name != "new.example" {
+        t.Fatalf("serving %s, want new.example", name)
+    }
+
+    cfg, err := New("1.3", nil, c)
+    if err != nil || cfg.MinVersion != tls.VersionTLS13 {
+        t.Fatalf("New: %v, %v", cfg, err)
+    }
+}
+
+func TestCipherSuites(t *testing.T) {
+    ids, err := CipherSuites([]string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"})
+    if err != nil || len(ids) != 1 || ids[0] != tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+        t.Fatalf("CipherSuites: %v, %v", ids, err)
+    }
+    _, err = CipherSuites([]string{"TLS_RSA_WITH_RC4_128_SHA", "TLS_MADE_UP"})
+    if err == nil || !strings.Contains(err.Error(), "TLS_RSA_WITH_RC4_128_SHA (insecure), TLS_MADE_UP") {
+        t.Fatalf("CipherSuites: want both suites rejected, got %v", err)
+    }
+    if _, err := ParseVersion("1.1"); err == nil {
+        t.Fatal("ParseVersion(1.1): want error")
+    }
+}
@@ -0,0 +1,493 @@
+// Package qrcode encodes short byte strings (such as short URLs) as QR
+// codes. It supports byte mode at error correction level M, versions 1-10,
+// which covers payloads of up to 213 bytes.
+package qrcode
+
+import (
+    "bytes"
+    "fmt"
+    "image"
+    "image/color"
+    "image/png"
+)
+
+const (
+    maxVersion = 10
+    quietZone  = 4
+)
+
+// blockSpec describes the error correction layout of one version at level M.
+type blockSpec struct {
+    ecPerBlock int
+    groups     [][2]int // {number of blocks, data codewords per block}
+}
+
+var levelM = [maxVersion + 1]blockSpec{
+    1:  {10, [][2]int{{1, 16}}},
+    2:  {16, [][2]int{{1, 28}}},
+    3:  {26, [][2]int{{1, 44}}},
+    4:  {18, [][2]int{{2, 32}}},
+    5:  {24, [][2]int{{2, 43}}},
+    6:  {16, [][2]int{{4, 27}}},
+    7:  {18, [][2]int{{4, 31}}},
+    8:  {22, [][2]int{{2, 38}, {2, 39}}},
+    9:  {22, [][2]int{{3, 36}, {2, 37}}},
+    10: {26, [][2]int{{4, 43}, {1, 44}}},
+}
+
+var alignmentCenters = [maxVersion + 1][]int{
+    2:  {6, 18},
+    3:  {6, 22},
+    4:  {6, 26},
+    5:  {6, 30},
+    6:  {6, 34},
+    7:  {6, 22, 38},
+    8:  {6, 24, 42},
+    9:  {6, 26, 46},
+    10: {6, 28, 50},
+}
+
+// Code is an encoded QR symbol.
+type Code struct {
+    Version int
+    Size    int
+    modules [][]bool
+    isFunc  [][]bool
+}
+
+// Dark reports whether the module at column x, row y is dark.
+func (c *Code) Dark(x, y int) bool {
+    return c.modules[y][x]
+}
+
+// Encode builds the smallest QR code that holds data.
+func Encode(data []byte) (*Code, error) {
+    return encode(data, -1)
+}
+
+// encode builds the code with the given mask, or the one with the lowest
+// penalty when mask is negative.
+func encode(data []byte, mask int) (*Code, error) {
+    version := 0
+    for v := 1; v <= maxVersion; v++ {
+        if 4+countBits(v)+len(data)*8 <= dataCapacity(v)*8 {
+            version = v
+            break
+        }
+    }
+    if version == 0 {
+        return nil, fmt.Errorf("qrcode: %d bytes exceed the supported capacity", len(data))
+    }
+
+    c := &Code{Version: version, Size: version*4 + 17}
+    c.modules = newGrid(c.Size)
+    c.isFunc = newGrid(c.Size)
+
+    c.drawFunctionPatterns()
+    c.drawCodewords(interleave(version, encodeData(version, data)))
+
+    if mask < 0 {
+        bestPenalty := -1
+        for m := 0; m < 8; m++ {
+            c.applyMask(m)
+            c.drawFormatBits(m)
+            if p := c.penalty(); bestPenalty < 0 || p < bestPenalty {
+                mask, bestPenalty = m, p
+            }
+            c.applyMask(m) // XOR again to undo
+        }
+    }
+    c.applyMask(mask)
+    c.drawFormatBits(mask)
+    return c, nil
+}
+
+// PNG renders the code with a quiet zone, scale pixels per module.
+func (c *Code) PNG(scale int) ([]byte, error) {
+    if scale <= 0 {
+        scale = 1
+    }
+    side := (c.Size + 2*quietZone) * scale
+    img := image.NewGray(image.Rect(0, 0, side, side))
+    for py := 0; py < side; py++ {
+        for px := 0; px < side; px++ {
+            x, y := px/scale-quietZone, py/scale-quietZone
+            v := color.Gray{Y: 0xff}
+            if x >= 0 && y >= 0 && x < c.Size && y < c.Size && c.modules[y][x] {
+                v = color.Gray{Y: 0}
+            }
+            img.SetGray(px, py, v)
+        }
+    }
+
+    var buf bytes.Buffer
+    if err := png.Encode(&buf, img); err != nil {
+        return nil, err
+    }
+    return buf.Bytes(), nil
+}
+
+func newGrid(size int) [][]bool {
+    g := make([][]bool, size)
+    for i := range g {
+        g[i] = make([]bool, size)
+    }
+    return g
+}
+
+// countBits is the width of the byte-mode character count field.
+func countBits(version int) int {
+    if version <= 9 {
+        return 8
+    }
+    return 16
+}
+
+// dataCapacity is the number of data codewords of a version.
+func dataCapacity(version int) int {
+    n := 0
+    for _, g := range levelM[version].groups {
+        n += g[0] * g[1]
+    }
+    return n
+}
+
+// encodeData builds the padded data codewords for byte mode.
+func encodeData(version int, data []byte) []byte {
+    var bits []bool
+    appendBits := func(v, n int) {
+        for i := n - 1; i >= 0; i-- {
+            bits = append(bits, (v>>i)&1 == 1)
+        }
+    }
+
+    appendBits(0x4, 4) // byte mode
+    appendBits(len(data), countBits(version))
+    for _, b := range data {
+        appendBits(int(b), 8)
+    }
+
+    capacity := dataCapacity(version) * 8
+    appendBits(0, min(4, capacity-len(bits))) // terminator
+    appendBits(0, (8-len(bits)%8)%8)
+
+    out := make([]byte, 0, capacity/8)
+    for i := 0; i < len(bits); i += 8 {
+        var b byte
+        for j := 0; j < 8; j++ {
+            if bits[i+j] {
+                b |= 1 << (7 - j)
+            }
+        }
+        out = append(out, b)
+    }
+    for pad := byte(0xEC); len(out) < capacity/8; pad ^= 0xEC ^ 0x11 {
+        out = append(out, pad)
+    }
+    return out
+}
+
+// interleave splits data into blocks, appends error correction and
+// interleaves the result as the symbol expects.
+func interleave(version int, data []byte) []byte {
+    spec := levelM[version]
+    divisor := rsDivisor(spec.ecPerBlock)
+
+    var dataBlocks, ecBlocks [][]byte
+    maxLen := 0
+    for _, g := range spec.groups {
+        for i := 0; i < g[0]; i++ {
+            block := data[:g[1]]
+            data = data[g[1]:]
+            dataBlocks = append(dataBlocks, block)
+            ecBlocks = append(ecBlocks, rsRemainder(block, divisor))
+            maxLen = max(maxLen, len(block))
+        }
+    }
+
+    var out []byte
+    for i := 0; i < maxLen; i++ {
+        for _, b := range dataBlocks {
+            if i < len(b) {
+                out = append(out, b[i])
+            }
+        }
+    }
+    for i := 0; i < spec.ecPerBlock; i++ {
+        for _, b := range ecBlocks {
+            out = append(out, b[i])
+        }
+    }
+    return out
+}
+
+func (c *Code) setFunc(x, y int, dark bool) {
+    c.modules[y][x] = dark
+    c.isFunc[y][x] = true
+}
+
+func (c *Code) drawFunctionPatterns() {
+    for i := 0; i < c.Size; i++ {
+        c.setFunc(6, i, i%2 == 0)
+        c.setFunc(i, 6, i%2 == 0)
+    }
+
+    c.drawFinder(3, 3)
+    c.drawFinder(c.Size-4, 3)
+    c.drawFinder(3, c.Size-4)
+
+    centers := alignmentCenters[c.Version]
+    last := len(centers) - 1
+    for i, cx := range centers {
+        for j, cy := range centers {
+            if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+                continue // overlaps a finder
+            }
+            for dy := -2; dy <= 2; dy++ {
+                for dx := -2; dx <= 2; dx++ {
+                    c.setFunc(cx+dx, cy+dy, max(abs(dx), abs(dy)) != 1)
+                }
+            }
+        }
+    }
+
+    c.drawFormatBits(0) // reserve the area; real bits come after masking
+    c.drawVersion()
+}
+
+// drawFinder draws a finder pattern and its separator around (x, y).
+func (c *Code) drawFinder(x, y int) {
+    for dy := -4; dy <= 4; dy++ {
+        for dx := -4; dx <= 4; dx++ {
+            xx, yy := x+dx, y+dy
+            if xx < 0 || yy < 0 || xx >= c.Size || yy >= c.Size {
+                continue
+            }
+            dist := max(abs(dx), abs(dy))
+            c.setFunc(xx, yy, dist != 2 && dist != 4)
+        }
+    }
+}
+
+// formatBits returns the 15-bit format information for level M.
+func formatBits(mask int) int {
+    data := mask // level M is 00
+    rem := data
+    for i := 0; i < 10; i++ {
+        rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+    }
+    return (data<<10 | rem) ^ 0x5412
+}
+
+func (c *Code) drawFormatBits(mask int) {
+    bits := formatBits(mask)
+    bit := func(i int) bool { return (bits>>i)&1 == 1 }
+
+    for i := 0; i <= 5; i++ {
+        c.setFunc(8, i, bit(i))
+    }
+    c.setFunc(8, 7, bit(6))
+    c.setFunc(8, 8, bit(7))
+    c.setFunc(7, 8, bit(8))
+    for i := 9; i < 15; i++ {
+        c.setFunc(14-i, 8, bit(i))
+    }
+
+    for i := 0; i < 8; i++ {
+        c.setFunc(c.Size-1-i, 8, bit(i))
+    }
+    for i := 8; i < 15; i++ {
+        c.setFunc(8, c.Size-15+i, bit(i))
+    }
+    c.setFunc(8, c.Size-8, true) // dark module
+}
+
+// versionBits returns the 18-bit version information (versions 7+).
+func versionBits(version int) int {
+    rem := version
+    for i := 0; i < 12; i++ {
+        rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+    }
+    return version<<12 | rem
+}
+
+func (c *Code) drawVersion() {
+    if c.Version < 7 {
+        return
+    }
+    bits := versionBits(c.Version)
+    for i := 0; i < 18; i++ {
+        dark := (bits>>i)&1 == 1
+        a, b := c.Size-11+i%3, i/3
+        c.setFunc(a, b, dark)
+        c.setFunc(b, a, dark)
+    }
+}
+
+// drawCodewords places data in the zigzag order, skipping function modules.
+func (c *Code) drawCodewords(data []byte) {
+    i := 0
+    for right := c.Size - 1; right >= 1; right -= 2 {
+        if right == 6 {
+            right = 5 // skip the vertical timing pattern
+        }
+        upward := (right+1)&2 == 0
+        for vert := 0; vert < c.Size; vert++ {
+            y := vert
+            if upward {
+                y = c.Size - 1 - vert
+            }
+            for j := 0; j < 2; j++ {
+                x := right - j
+                if c.isFunc[y][x] || i >= len(data)*8 {
+                    continue
+                }
+                c.modules[y][x] = (data[i>>3]>>(7-i&7))&1 == 1
+                i++
+            }
+        }
+    }
+}
+
+func maskBit(mask, x, y int) bool {
+    switch mask {
+    case 0:
+        return (x+y)%2 == 0
+    case 1:
+        return y%2 == 0
+    case 2:
+        return x%3 == 0
+    case 3:
+        return (x+y)%3 == 0
+    case 4:
+        return (x/3+y/2)%2 == 0
+    case 5:
+        return x*y%2+x*y%3 == 0
+    case 6:
+        return (x*y%2+x*y%3)%2 == 0
+    default:
+        return ((x+y)%2+x*y%3)%2 == 0
+    }
+}
+
+// applyMask XORs the mask over all non-function modules.
+func (c *Code) applyMask(mask int) {
+    for y := 0; y < c.Size; y++ {
+        for x := 0; x < c.Size; x++ {
+            if !c.isFunc[y][x] && maskBit(mask, x, y) {
+                c.modules[y][x] = !c.modules[y][x]
+            }
+        }
+    }
+}
+
+// penalty scores the symbol with the four rules of ISO/IEC 18004 8.8.2.
+func (c *Code) penalty() int {
+    n := c.Size
+    score := 0
+
+    line := func(get func(i int) bool) {
+        run := 1
+        for i := 1; i <= n; i++ {
+            if i < n && get(i) == get(i-1) {
+                run++
+                continue
+            }
+            if run >= 5 {
+                score += 3 + run - 5
+            }
+            run = 1
+        }
+        // 1:1:3:1:1 finder-like pattern with four light modules on one side
+        for i := 0; i+11 <= n; i++ {
+            a := []bool{true, false, true, true, true, false, true, false, false, false, false}
+            fwd, rev := true, true
+            for k := 0; k < 11; k++ {
+                if get(i+k) != a[k] {
+                    fwd = false
+                }
+                if get(i+k) != a[10-k] {
+                    rev = false
+                }
+            }
+            if fwd {
+                score += 40
+            }
+            if rev {
+                score += 40
+            }
+        }
+    }
+    for y := 0; y < n; y++ {
+        line(func(i int) bool { return c.modules[y][i] })
+    }
+    for x := 0; x < n; x++ {
+        line(func(i int) bool { return c.modules[i][x] })
+    }
+
+    dark := 0
+    for y := 0; y < n; y++ {
+        for x := 0; x < n; x++ {
+            v := c.modules[y][x]
+            if v {
+                dark++
+            }
+            if x+1 < n && y+1 < n && v == c.modules[y][x+1] && v == c.modules[y+1][x] && v == c.modules[y+1][x+1] {
+                score += 3
+            }
+        }
+    }
+
+    total := n * n
+    score += abs(dark*20-total*10) / total * 10
+    return score
+}
+
+// rsDivisor returns the generator polynomial of the given degree, highest
+// coefficient first and the leading 1 omitted.
+func rsDivisor(degree int) []byte {
+    result := make([]byte, degree)
+    result[degree-1] = 1
+    root := byte(1)
+    for i := 0; i < degree; i++ {
+        for j := range result {
+            result[j] = gfMul(result[j], root)
+            if j+1 < len(result) {
+                result[j] ^= result[j+1]
+            }
+        }
+        root = gfMul(root, 0x02)
+    }
+    return result
+}
+
+// rsRemainder returns the error correction codewords for data.
+func rsRemainder(data, divisor []byte) []byte {
+    result := make([]byte, len(divisor))
+    for _, b := range data {
+        factor := b ^ result[0]
+        copy(result, result[1:])
+        result[len(result)-1] = 0
+        for i, coef := range divisor {
+            result[i] ^= gfMul(coef, factor)
+        }
+    }
+    return result
+}
+
+// gfMul multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func gfMul(x, y byte) byte {
+    var z int
+    for i := 7; i >= 0; i-- {
+        z = (z << 1) ^ ((z >> 7) * 0x11D)
+        z ^= int((y>>i)&1) * int(x)
+    }
+    return byte(z)
+}
+
+func abs(v int) int {
+    if v < 0 {
+        return -v
+    }
+    return v
+}
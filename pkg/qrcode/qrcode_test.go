@@ -0,0 +1,225 @@
+package qrcode
+
+import (
+    "bytes"
+    "fmt"
+    "image/png"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestReedSolomon(t *testing.T) {
+    // "HELLO WORLD" as 1-M data codewords and their published EC codewords
+    data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+    want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+    got := rsRemainder(data, rsDivisor(10))
+    if !bytes.Equal(got, want) {
+        t.Fatalf("rsRemainder: want %v, got %v", want, got)
+    }
+}
+
+func TestFormatAndVersionBits(t *testing.T) {
+    if got := formatBits(0); got != 0x5412 {
+        t.Errorf("formatBits(M, 0): want 0x5412, got %#x", got)
+    }
+    if got := formatBits(1); got != 0x5125 {
+        t.Errorf("formatBits(M, 1): want 0x5125, got %#x", got)
+    }
+    if got := versionBits(7); got != 0x07C94 {
+        t.Errorf("versionBits(7): want 0x07C94, got %#x", got)
+    }
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+    payloads := []string{
+        "https://sn.ap/abc12345",
+        "https://go.brand-a.example/0123456789abcdefghijklmnopqrstuvwxyz/ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+        "https://l.brand-b.example/" + strings.Repeat("z", 180), // two block groups
+    }
+    for _, p := range payloads {
+        c, err := Encode([]byte(p))
+        if err != nil {
+            t.Fatalf("Encode(%q): %v", p, err)
+        }
+        if got := decode(t, c); got != p {
+            t.Errorf("round trip: want %q, got %q", p, got)
+        }
+    }
+
+    if _, err := Encode(make([]byte, 214)); err == nil {
+        t.Error("expected error for payload beyond version 10")
+    }
+}
+
+// TestReferenceSymbols compares whole symbols with ones produced by an
+// independent encoder (Kazuhiko Arase's QRCode for JavaScript) at level M.
+// Each file in testdata holds the payload and the rows of the symbol, "#"
+// for dark modules; the mask is fixed because encoders score masks
+// differently.
+func TestReferenceSymbols(t *testing.T) {
+    files, err := filepath.Glob(filepath.Join("testdata", "v*_mask*.txt"))
+    if err != nil || len(files) == 0 {
+        t.Fatalf("no reference symbols: %v", err)
+    }
+    for _, file := range files {
+        var version, mask int
+        if _, err := fmt.Sscanf(filepath.Base(file), "v%d_mask%d.txt", &version, &mask); err != nil {
+            t.Fatalf("%s: %v", file, err)
+        }
+        raw, err := os.ReadFile(file)
+        if err != nil {
+            t.Fatal(err)
+        }
+        lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+        payload, rows := lines[0], lines[1:]
+
+        c, err := encode([]byte(payload), mask)
+        if err != nil {
+            t.Fatalf("%s: %v", file, err)
+        }
+        if c.Version != version || c.Size != len(rows) {
+            t.Fatalf("%s: got version %d, size %d", file, c.Version, c.Size)
+        }
+        diffs := 0
+        for y, row := range rows {
+            for x := range row {
+                if c.Dark(x, y) != (row[x] == '#') {
+                    diffs++
+                }
+            }
+        }
+        if diffs > 0 {
+            t.Errorf("%s: %d modules differ from the reference", file, diffs)
+        }
+    }
+}
+
+func TestPNG(t *testing.T) {
+    c, err := Encode([]byte("https://sn.ap/x"))
+    if err != nil {
+        t.Fatalf("Encode: %v", err)
+    }
+    data, err := c.PNG(4)
+    if err != nil {
+        t.Fatalf("PNG: %v", err)
+    }
+    img, err := png.Decode(bytes.NewReader(data))
+    if err != nil {
+        t.Fatalf("decode png: %v", err)
+    }
+    if side := (c.Size + 2*quietZone) * 4; img.Bounds().Dx() != side {
+        t.Errorf("png width: want %d, got %d", side, img.Bounds().Dx())
+    }
+}
+
+// decode reads a symbol back: format info, unmasking, zigzag order,
+// de-interleaving and an RS check of every block.
+func decode(t *testing.T, c *Code) string {
+    t.Helper()
+
+    var bits int
+    for i := 0; i <= 5; i++ {
+        bits |= b2i(c.Dark(8, i)) << i
+    }
+    bits |= b2i(c.Dark(8, 7))<<6 | b2i(c.Dark(8, 8))<<7 | b2i(c.Dark(7, 8))<<8
+    for i := 9; i < 15; i++ {
+        bits |= b2i(c.Dark(14-i, 8)) << i
+    }
+    mask := -1
+    for m := 0; m < 8; m++ {
+        if formatBits(m) == bits {
+            mask = m
+        }
+    }
+    if mask < 0 {
+        t.Fatalf("unreadable format bits %#x", bits)
+    }
+
+    // Rebuild the function pattern map and read the codewords
+    ref := &Code{Version: c.Version, Size: c.Size, modules: newGrid(c.Size), isFunc: newGrid(c.Size)}
+    ref.drawFunctionPatterns()
+    var raw []byte
+    var cur byte
+    n := 0
+    for right := c.Size - 1; right >= 1; right -= 2 {
+        if right == 6 {
+            right = 5
+        }
+        upward := (right+1)&2 == 0
+        for vert := 0; vert < c.Size; vert++ {
+            y := vert
+            if upward {
+                y = c.Size - 1 - vert
+            }
+            for j := 0; j < 2; j++ {
+                x := right - j
+                if ref.isFunc[y][x] {
+                    continue
+                }
+                cur = cur<<1 | byte(b2i(c.Dark(x, y) != maskBit(mask, x, y)))
+                if n++; n%8 == 0 {
+                    raw = append(raw, cur)
+                    cur = 0
+                }
+            }
+        }
+    }
+
+    spec := levelM[c.Version]
+    var lens []int
+    for _, g := range spec.groups {
+        for i := 0; i < g[0]; i++ {
+            lens = append(lens, g[1])
+        }
+    }
+    blocks := make([][]byte, len(lens))
+    pos := 0
+    for i := 0; i < lens[len(lens)-1]; i++ {
+        for b, l := range lens {
+            if i < l {
+                blocks[b] = append(blocks[b], raw[pos])
+                pos++
+            }
+        }
+    }
+    divisor := rsDivisor(spec.ecPerBlock)
+    var data []byte
+    for b := range blocks {
+        ec := make([]byte, 0, spec.ecPerBlock)
+        for i := 0; i < spec.ecPerBlock; i++ {
+            ec = append(ec, raw[pos+i*len(blocks)+b])
+        }
+        if !bytes.Equal(rsRemainder(blocks[b], divisor), ec) {
+            t.Fatalf("block %d fails RS check", b)
+        }
+        data = append(data, blocks[b]...)
+    }
+
+    // Byte mode header, length, payload
+    readBits := func(off, width int) int {
+        v := 0
+        for i := 0; i < width; i++ {
+            v = v<<1 | int(data[(off+i)/8]>>(7-(off+i)%8)&1)
+        }
+        return v
+    }
+    if mode := readBits(0, 4); mode != 0x4 {
+        t.Fatalf("mode: want byte mode, got %#x", mode)
+    }
+    length := readBits(4, countBits(c.Version))
+    out := make([]byte, length)
+    for i := range out {
+        out[i] = byte(readBits(4+countBits(c.Version)+i*8, 8))
+    }
+    return string(out)
+}
+
+func b2i(b bool) int {
+    if b {
+        return 1
+    }
+    return 0
+}
@@ -0,0 +1,132 @@
+package util
+
+import (
+    "fmt"
+    "strings"
+    "unicode/utf8"
+)
+
+// Punycode parameters from RFC 3492
+const (
+    punyBase        = 36
+    punyTMin        = 1
+    punyTMax        = 26
+    punySkew        = 38
+    punyDamp        = 700
+    punyInitialBias = 72
+    punyInitialN    = 128
+)
+
+// ToASCII converts an internationalized host name to its ASCII form,
+// encoding every non-ASCII label with punycode and the "xn--" prefix.
+// Labels are lowercased but no further IDNA mapping is applied.
+func ToASCII(host string) (string, error) {
+    if !utf8.ValidString(host) {
+        return "", fmt.Errorf("host is not valid UTF-8")
+    }
+    labels := strings.Split(strings.ToLower(host), ".")
+    for i, label := range labels {
+        if isASCII(label) {
+            continue
+        }
+        encoded, err := punycodeEncode(label)
+        if err != nil {
+            return "", fmt.Errorf("label %q: %w", label, err)
+        }
+        labels[i] = "xn--" + encoded
+    }
+    return strings.Join(labels, "."), nil
+}
+
+func isASCII(s string) bool {
+    for i := 0; i < len(s); i++ {
+        if s[i] >= utf8.RuneSelf {
+            return false
+        }
+    }
+    return true
+}
+
+// punycodeEncode implements the encoding procedure of RFC 3492 section 6.3.
+func punycodeEncode(label string) (string, error) {
+    runes := []rune(label)
+    if len(runes) > 63 {
+        return "", fmt.Errorf("label too long")
+    }
+
+    var out strings.Builder
+    for _, r := range runes {
+        if r < utf8.RuneSelf {
+            out.WriteRune(r)
+        }
+    }
+    basic := out.Len()
+    handled := basic
+    if basic > 0 {
+        out.WriteByte('-')
+    }
+
+    n, delta, bias := rune(punyInitialN), 0, punyInitialBias
+    for handled < len(runes) {
+        m := rune(utf8.MaxRune + 1)
+        for _, r := range runes {
+            if r >= n && r < m {
+                m = r
+            }
+        }
+        delta += int(m-n) * (handled + 1)
+        n = m
+
+        for _, r := range runes {
+            if r < n {
+                delta++
+            }
+            if r != n {
+                continue
+            }
+            q := delta
+            for k := punyBase; ; k += punyBase {
+                t := k - bias
+                if t < punyTMin {
+                    t = punyTMin
+                } else if t > punyTMax {
+                    t = punyTMax
+                }
+                if q < t {
+                    break
+                }
+                out.WriteByte(punyDigit(t + (q-t)%(punyBase-t)))
+                q = (q - t) / (punyBase - t)
+            }
+            out.WriteByte(punyDigit(q))
+            bias = punyAdapt(delta, handled+1, handled == basic)
+            delta = 0
+            handled++
+        }
+        delta++
+        n++
+    }
+    return out.String(), nil
+}
+
+func punyAdapt(delta, numPoints int, first bool) int {
+    if first {
+        delta /= punyDamp
+    } else {
+        delta /= 2
+    }
+    delta += delta / numPoints
+    k := 0
+    for delta > ((punyBase-punyTMin)*punyTMax)/2 {
+        delta /= punyBase - punyTMin
+        k += punyBase
+    }
+    return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
+
+func punyDigit(d int) byte {
+    if d < 26 {
+        return byte('a' + d)
+    }
+    return byte('0' + d - 26)
+}
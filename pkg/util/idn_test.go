@@ -0,0 +1,29 @@
+package util
+
+import (
+    "testing"
+)
+
+func TestToASCII(t *testing.T) {
+    cases := map[string]string{
+        "example.com":       "example.com",
+        "Bücher.example":    "xn--bcher-kva.example",
+        "münchen.de":        "xn--mnchen-3ya.de",
+        "例え.テスト":            "xn--r8jz45g.xn--zckzah",
+        "ليهمابتكلموشعربي؟": "xn--egbpdaj6bu4bxfgehfvwxn",
+    }
+    for in, want := range cases {
+        got, err := ToASCII(in)
+        if err != nil {
+            t.Errorf("ToASCII(%q): %v", in, err)
+            continue
+        }
+        if got != want {
+            t.Errorf("ToASCII(%q): want %q, got %q", in, want, got)
+        }
+    }
+
+    if _, err := ToASCII("bad\xffhost"); err == nil {
+        t.Error("expected error for invalid UTF-8")
+    }
+}